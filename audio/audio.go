@@ -1,7 +1,10 @@
 package audio
 
 import (
+  "bytes"
   "fmt"
+  "io"
+  "io/fs"
   "os"
   //"log"
   "strings"
@@ -34,19 +37,44 @@ func Duration(path string) (float64, error) {
     return 0, err
   }
   defer f.Close()
+  return DurationReader(f, path)
+}
+
+// fsysの中のnameの音声ファイルの長さ
+func DurationFS(fsys fs.FS, name string) (float64, error) {
+  f, err := fsys.Open(name)
+  if err != nil {
+    return 0, err
+  }
+  defer f.Close()
+  return DurationReader(f, name)
+}
+
+// rから読んだ音声ファイルの長さ。形式はnameの拡張子で判断する。
+// oggとmp3は長さを求めるのにシークが必要なので、rがio.Seekerでなければ全て読み込んでから調べる。
+// デコーダーにはCloseを隠して渡すので、rがio.Closerでも閉じない
+func DurationReader(r io.Reader, name string) (float64, error) {
+  ext := strings.ToLower(filepath.Ext(name))
+  if _, ok := r.(io.Seeker); !ok && (ext == ".ogg" || ext == ".mp3") {
+    data, err := io.ReadAll(r)
+    if err != nil {
+      return 0, err
+    }
+    r = bytes.NewReader(data)
+  }
 
   var stream beep.StreamSeekCloser
   var format beep.Format
-  err = fmt.Errorf("not audio file: %s", path)
-  switch strings.ToLower(filepath.Ext(path)) {
+  err := fmt.Errorf("not audio file: %s", name)
+  switch ext {
   case ".wav":
-    stream, format, err = wav.Decode(f)
+    stream, format, err = wav.Decode(withoutClose(r))
   case ".ogg":
-    stream, format, err = vorbis.Decode(f)
+    stream, format, err = vorbis.Decode(nopCloser{r.(io.ReadSeeker)})
   case ".mp3":
-    stream, format, err = mp3.Decode(f)
+    stream, format, err = mp3.Decode(nopCloser{r.(io.ReadSeeker)})
   case ".flac":
-    stream, format, err = flac.Decode(f)
+    stream, format, err = flac.Decode(withoutClose(r))
   }
   if err == nil {
     defer stream.Close()
@@ -54,3 +82,20 @@ func Duration(path string) (float64, error) {
   }
   return 0, err
 }
+
+// デコーダーがCloseしてもrを閉じないように、シークできるままio.ReadCloserにする
+type nopCloser struct {
+  io.ReadSeeker
+}
+
+func (nopCloser) Close() error {
+  return nil
+}
+
+// wavとflacのデコーダーはrがio.CloserならCloseで閉じるので、Closeを隠す。シークできればシークできるままにする
+func withoutClose(r io.Reader) io.Reader {
+  if rs, ok := r.(io.ReadSeeker); ok {
+    return nopCloser{rs}
+  }
+  return struct{ io.Reader }{r}
+}
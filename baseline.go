@@ -0,0 +1,207 @@
+package checkbms
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// 既存のログを記録しておき、新しいログだけを報告するためのベースライン
+type Baseline struct {
+	Version int             `json:"version"`
+	Entries []BaselineEntry `json:"entries"`
+	matched map[baselineKey]int
+}
+
+// Sha256, Rule, Fingerprintでログを識別する。Path, Messageは人が読むための情報
+type BaselineEntry struct {
+	Sha256      string `json:"sha256"` // ログの対象のBMSファイルのハッシュ。BMSファイルに紐づかないフォルダのログは空
+	Rule        string `json:"rule"`
+	Fingerprint string `json:"fingerprint"`
+	Path        string `json:"path,omitempty"`
+	Message     string `json:"message"`
+}
+
+type baselineKey struct {
+	sha256      string
+	rule        string
+	fingerprint string
+}
+
+func (be BaselineEntry) key() baselineKey {
+	return baselineKey{sha256: be.Sha256, rule: be.Rule, fingerprint: be.Fingerprint}
+}
+
+const BASELINE_VERSION = 1
+
+func NewBaseline() *Baseline {
+	return &Baseline{Version: BASELINE_VERSION, Entries: []BaselineEntry{}}
+}
+
+func ReadBaseline(path string) (*Baseline, error) {
+	bytes, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	baseline := NewBaseline()
+	if err := json.Unmarshal(bytes, baseline); err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err.Error())
+	}
+	if baseline.Version != BASELINE_VERSION {
+		return nil, fmt.Errorf("%s: unsupported baseline version: %d", path, baseline.Version)
+	}
+	return baseline, nil
+}
+
+func WriteBaseline(w io.Writer, baseline *Baseline) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.SetEscapeHTML(false)
+	return encoder.Encode(baseline)
+}
+
+// SubLogs中の関連する行の番号。指紋からは除く
+var subLogLinePattern = regexp.MustCompile(`\(line \d+\)`)
+
+// 行番号に依存しない位置の指紋。分岐、オブジェ、英語のメッセージから作る。
+// 行番号はLogのLineに持ち、メッセージには含めない(行番号がずれるような編集ではSha256も変わる)
+func logFingerprint(log Log, scope string) string {
+	subLogs := subLogLinePattern.ReplaceAllString(strings.Join(log.SubLogs, "\n"), "(line)")
+	parts := []string{scope, log.Branch, log.Message, subLogs}
+	if log.Object != nil {
+		parts = append(parts, fmt.Sprintf("%s:%d:%d/%d:%s", log.Object.Channel, log.Object.Measure, log.Object.Numerator, log.Object.Denominator, log.Object.Value))
+	}
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(strings.Join(parts, "\x00"))))[:16]
+}
+
+func newBaselineEntry(log Log, sha256, scope string) BaselineEntry {
+	return BaselineEntry{
+		Sha256:      sha256,
+		Rule:        log.Rule,
+		Fingerprint: logFingerprint(log, scope),
+		Path:        log.Path,
+		Message:     log.Message,
+	}
+}
+
+// reportの各ログに対応するエントリを、reportのログの参照と共にfnに渡す
+func eachBaselineEntry(report *Report, fn func(logs *Logs, i int, entry BaselineEntry)) {
+	eachFile := func(result *BmsFileResult) {
+		for i, log := range result.Diagnostics {
+			fn(&result.Diagnostics, i, newBaselineEntry(log, result.Sha256, ""))
+		}
+	}
+	for d := range report.Directories {
+		dir := &report.Directories[d]
+		shas := map[string]string{}
+		for i := range dir.BmsFiles {
+			eachFile(&dir.BmsFiles[i])
+			shas[dir.BmsFiles[i].Path] = dir.BmsFiles[i].Sha256
+		}
+		for i := range dir.BmsonFiles {
+			eachFile(&dir.BmsonFiles[i])
+			shas[dir.BmsonFiles[i].Path] = dir.BmsonFiles[i].Sha256
+		}
+		// BMSファイルに紐づかないログはフォルダ名で区別する
+		for i, log := range dir.Diagnostics {
+			if sha, ok := shas[log.Path]; ok {
+				fn(&dir.Diagnostics, i, newBaselineEntry(log, sha, ""))
+			} else {
+				fn(&dir.Diagnostics, i, newBaselineEntry(log, "", filepath.Base(dir.Path)))
+			}
+		}
+	}
+	for i := range report.BmsFiles {
+		eachFile(&report.BmsFiles[i])
+	}
+	for i := range report.BmsonFiles {
+		eachFile(&report.BmsonFiles[i])
+	}
+}
+
+// reportの全てのログをベースラインに追加する
+func (b *Baseline) Add(report *Report) {
+	eachBaselineEntry(report, func(_ *Logs, _ int, entry BaselineEntry) {
+		b.Entries = append(b.Entries, entry)
+	})
+}
+
+// ベースラインにあるログをreportから取り除く。同じキーのログはベースラインにある数だけ取り除く
+func (b *Baseline) Filter(report *Report) {
+	if b.matched == nil {
+		b.matched = map[baselineKey]int{}
+	}
+	counts := map[baselineKey]int{}
+	for _, entry := range b.Entries {
+		counts[entry.key()]++
+	}
+	removed := map[*Logs]map[int]bool{}
+	eachBaselineEntry(report, func(logs *Logs, i int, entry BaselineEntry) {
+		key := entry.key()
+		if b.matched[key] < counts[key] {
+			b.matched[key]++
+			if removed[logs] == nil {
+				removed[logs] = map[int]bool{}
+			}
+			removed[logs][i] = true
+		}
+	})
+	for logs, indices := range removed {
+		remained := Logs{}
+		for i, log := range *logs {
+			if !indices[i] {
+				remained = append(remained, log)
+			}
+		}
+		*logs = remained
+	}
+}
+
+// Filterしたreportのどのログにも一致しなかった(修正された)エントリを返す
+func (b *Baseline) Fixed() (fixed []BaselineEntry) {
+	matched := map[baselineKey]int{}
+	for _, entry := range b.Entries {
+		key := entry.key()
+		if matched[key] < b.matched[key] {
+			matched[key]++
+			continue
+		}
+		fixed = append(fixed, entry)
+	}
+	return fixed
+}
+
+// 前回と今回のチェックのログを比べて、今回増えたログと前回から無くなったログを返す。
+// ベースラインと同じく行番号は比べないので、行がずれただけのログは変化無しとする
+func DiffLogs(before, after Logs) (appeared, disappeared Logs) {
+	key := func(log Log) string {
+		return strings.Join([]string{log.Path, log.Rule, string(log.Level), logFingerprint(log, "")}, "\x00")
+	}
+	counts := map[string]int{}
+	for _, log := range before {
+		counts[key(log)]++
+	}
+	for _, log := range after {
+		if k := key(log); counts[k] > 0 {
+			counts[k]--
+		} else {
+			appeared = append(appeared, log)
+		}
+	}
+	// 同じキーのログが複数あれば、後ろのものを無くなったとする
+	for i := len(before) - 1; i >= 0; i-- {
+		if k := key(before[i]); counts[k] > 0 {
+			counts[k]--
+			disappeared = append(disappeared, before[i])
+		}
+	}
+	for i, j := 0, len(disappeared)-1; i < j; i, j = i+1, j-1 {
+		disappeared[i], disappeared[j] = disappeared[j], disappeared[i]
+	}
+	return appeared, disappeared
+}
@@ -0,0 +1,125 @@
+package checkbms
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBaseline(t *testing.T) {
+	overlap := Log{Rule: "bms.note-overlap", Level: Error, Message: "Placed notes overlap", Path: "song/a.bms", Line: 4, Column: 8,
+		Object: &LogObject{Channel: "11", Measure: 1, Numerator: 0, Denominator: 1, Value: "02"}}
+	header := Log{Rule: "bms.header-missing", Level: Warning, Message: "#GENRE definition is missing", Path: "song/a.bms"}
+	unused := Log{Rule: "dir.file-unused", Level: Notice, Message: "This file is not used: x.wav", Path: "song/x.wav"}
+	newReport := func(bmsLogs, dirLogs Logs) *Report {
+		return &Report{Directories: []DirectoryResult{{
+			Path:        "song",
+			BmsFiles:    []BmsFileResult{{Path: "song/a.bms", Sha256: "abc", Diagnostics: bmsLogs}},
+			Diagnostics: dirLogs,
+		}}}
+	}
+
+	baseline := NewBaseline()
+	baseline.Add(newReport(Logs{overlap, header}, Logs{unused}))
+	var buf bytes.Buffer
+	if err := WriteBaseline(&buf, baseline); err != nil {
+		t.Fatal(err)
+	}
+	if len(baseline.Entries) != 3 {
+		t.Fatalf("entries count: got = %d, want = 3", len(baseline.Entries))
+	}
+
+	// 行番号が変わっても同じログとみなす。修正されたheaderは新しいログとして報告されず、fixedになる
+	movedOverlap := overlap
+	movedOverlap.Line = 5
+	otherUnused := Log{Rule: "dir.file-unused", Level: Notice, Message: "This file is not used: y.wav", Path: "song/y.wav"}
+	report := newReport(Logs{movedOverlap}, Logs{unused, otherUnused})
+	baseline.Filter(report)
+	dir := report.Directories[0]
+	if len(dir.BmsFiles[0].Diagnostics) != 0 {
+		t.Errorf("bms logs are not filtered: %+v", dir.BmsFiles[0].Diagnostics)
+	}
+	if len(dir.Diagnostics) != 1 || dir.Diagnostics[0].Message != otherUnused.Message {
+		t.Errorf("dir logs: got = %+v, want = [%+v]", dir.Diagnostics, otherUnused)
+	}
+	fixed := baseline.Fixed()
+	if len(fixed) != 1 || fixed[0].Rule != "bms.header-missing" {
+		t.Errorf("fixed: got = %+v", fixed)
+	}
+
+	// ハッシュが変われば別のログになる
+	changed := newReport(Logs{overlap}, nil)
+	changed.Directories[0].BmsFiles[0].Sha256 = "def"
+	path := filepath.Join(t.TempDir(), "baseline.json")
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	read, err := ReadBaseline(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	read.Filter(changed)
+	if len(changed.Directories[0].BmsFiles[0].Diagnostics) != 1 {
+		t.Errorf("log of changed file is filtered")
+	}
+}
+
+func TestDiffLogs(t *testing.T) {
+	overlap := Log{Rule: "bms.note-overlap", Level: Error, Message: "Placed notes overlap", Path: "song/a.bms", Line: 4,
+		Object: &LogObject{Channel: "11", Measure: 1, Numerator: 0, Denominator: 1, Value: "02"}}
+	movedOverlap := overlap
+	movedOverlap.Line = 10
+	header := Log{Rule: "bms.header-missing", Level: Warning, Message: "#GENRE definition is missing", Path: "song/a.bms"}
+	unused := Log{Rule: "dir.file-unused", Level: Notice, Message: "This file is not used: x.wav", Path: "song/x.wav"}
+
+	appeared, disappeared := DiffLogs(Logs{overlap, header, header}, Logs{movedOverlap, header, unused})
+	if len(appeared) != 1 || appeared[0].Rule != unused.Rule {
+		t.Errorf("appeared: got = %+v, want = [%+v]", appeared, unused)
+	}
+	if len(disappeared) != 1 || disappeared[0].Rule != header.Rule {
+		t.Errorf("disappeared: got = %+v, want = [%+v]", disappeared, header)
+	}
+
+	appeared, disappeared = DiffLogs(nil, Logs{overlap})
+	if len(appeared) != 1 || len(disappeared) != 0 {
+		t.Errorf("first run: appeared = %+v, disappeared = %+v", appeared, disappeared)
+	}
+}
+
+func TestDiffLogsWithShiftedLines(t *testing.T) {
+	lines := []string{
+		"%checkbms-disable bms.rank-unusual",
+		"invalid",
+		"#RANDOM 2",
+		"#IF 1", "#WAV01 a.wav", "#ENDIF",
+		"#IF 2", "#WAV01 b.wav", "#ENDIF",
+		"#IF 3", "#ENDIF",
+		"#ENDRANDOM",
+	}
+	check := func(lines []string) Logs {
+		bmsFile := newTestBmsFile("test.bms", lines...)
+		if err := bmsFile.ScanBmsFile(); err != nil {
+			t.Fatal(err)
+		}
+		CheckBmsFile(bmsFile)
+		return bmsFile.Logs
+	}
+	before := check(lines)
+	after := check(append([]string{"* comment"}, lines...))
+	for _, rule := range []string{"bms.suppression-unused", "bms.invalid-line", "bms.control-out-of-range", "bms.branch-header-not-unified"} {
+		found := false
+		for _, log := range after {
+			if log.Rule == rule {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("%s is not reported: %v", rule, after)
+		}
+	}
+	// 1行挿入して行番号だけがずれたログは変化無し
+	if appeared, disappeared := DiffLogs(before, after); len(appeared) != 0 || len(disappeared) != 0 {
+		t.Errorf("appeared = %v, disappeared = %v", appeared, disappeared)
+	}
+}
@@ -0,0 +1,679 @@
+package checkbms
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// 分岐の組み合わせがこの数を超える場合は、全列挙せずにこの数だけ抽出してチェックする
+var MaxBranchCombinations = 64
+
+var CONTROL_COMMANDS = []string{
+	"random", "rondam", "setrandom", "endrandom",
+	"if", "elseif", "else", "endif",
+	"switch", "setswitch", "case", "skip", "def", "endsw",
+}
+
+// 制御構文の行ならコマンド名(小文字)と値を返す
+func parseControlCommand(line string) (command, value string, ok bool) {
+	if !strings.HasPrefix(line, "#") {
+		return "", "", false
+	}
+	fields := strings.Fields(strings.ToLower(line[1:]))
+	if len(fields) == 0 {
+		return "", "", false
+	}
+	command = fields[0]
+	if command == "end" && len(fields) >= 2 && fields[1] == "if" { // #END IF
+		return "endif", "", true
+	}
+	for _, controlCommand := range CONTROL_COMMANDS {
+		if command == controlCommand {
+			if len(fields) >= 2 {
+				value = fields[1]
+			}
+			return command, value, true
+		}
+	}
+	return "", "", false
+}
+
+func hasControlCommand(lines []bmsLine) bool {
+	for _, line := range lines {
+		if _, _, ok := parseControlCommand(line.text); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// #RANDOM/#SWITCHで選ばれた値
+type branchDecision struct {
+	command string
+	max     int
+	value   int
+}
+
+func (bd branchDecision) string() string {
+	return fmt.Sprintf("#%s %d=%d", strings.ToUpper(bd.command), bd.max, bd.value)
+}
+
+func branchName(decisions []branchDecision) string {
+	strs := []string{}
+	for _, decision := range decisions {
+		strs = append(strs, decision.string())
+	}
+	return strings.Join(strs, ", ")
+}
+
+type controlFrame struct {
+	isSwitch     bool
+	parentActive bool
+	active       bool
+	matched      bool // #IF/#CASEのいずれかが既に選ばれたか
+	skipped      bool // #SKIPで#ENDSWまで抜けたか
+	value        int  // #SWITCHの値
+	randomDepth  int  // #IFの開始時点の#RANDOMの深さ
+}
+
+// 制御構文を評価して有効な行を返す。
+// #RANDOM/#SWITCHの値は、index番目(出現順)の値をchoose(index, max)で決める
+func evaluateControlFlow(lines []bmsLine, choose func(index, max int) int) (activeLines []bmsLine, decisions []branchDecision) {
+	randoms := []int{}
+	frames := []controlFrame{}
+	isActive := func() bool {
+		if len(frames) == 0 {
+			return true
+		}
+		return frames[len(frames)-1].active
+	}
+	currentRandom := func() int {
+		if len(randoms) == 0 {
+			return 0
+		}
+		return randoms[len(randoms)-1]
+	}
+	generate := func(command, valueStr string) int {
+		max, err := strconv.Atoi(valueStr)
+		if !isActive() || err != nil || max < 1 {
+			return 0
+		}
+		value := choose(len(decisions), max)
+		decisions = append(decisions, branchDecision{command: command, max: max, value: value})
+		return value
+	}
+	topFrame := func(isSwitch bool) *controlFrame {
+		if len(frames) > 0 && frames[len(frames)-1].isSwitch == isSwitch {
+			return &frames[len(frames)-1]
+		}
+		return nil
+	}
+
+	for _, line := range lines {
+		command, valueStr, ok := parseControlCommand(line.text)
+		if !ok {
+			if isActive() {
+				activeLines = append(activeLines, line)
+			}
+			continue
+		}
+		value, err := strconv.Atoi(valueStr)
+		hasValue := err == nil
+		switch command {
+		case "random", "rondam":
+			randoms = append(randoms, generate("random", valueStr))
+		case "setrandom":
+			if !isActive() {
+				value = 0
+			}
+			randoms = append(randoms, value)
+		case "endrandom":
+			if len(randoms) > 0 {
+				randoms = randoms[:len(randoms)-1]
+			}
+		case "if":
+			parentActive := isActive()
+			match := parentActive && hasValue && currentRandom() == value
+			frames = append(frames, controlFrame{parentActive: parentActive, active: match, matched: match, randomDepth: len(randoms)})
+		case "elseif":
+			if frame := topFrame(false); frame != nil {
+				match := frame.parentActive && !frame.matched && hasValue && currentRandom() == value
+				frame.active = match
+				frame.matched = frame.matched || match
+			}
+		case "else":
+			if frame := topFrame(false); frame != nil {
+				frame.active = frame.parentActive && !frame.matched
+				frame.matched = true
+			}
+		case "endif":
+			if frame := topFrame(false); frame != nil {
+				// #ENDRANDOMが省略された#IF内の#RANDOMは#ENDIFで閉じる
+				if len(randoms) > frame.randomDepth {
+					randoms = randoms[:frame.randomDepth]
+				}
+				frames = frames[:len(frames)-1]
+			}
+		case "switch", "setswitch":
+			parentActive := isActive()
+			switchValue := 0
+			if command == "switch" {
+				switchValue = generate("switch", valueStr)
+			} else if parentActive {
+				switchValue = value
+			}
+			frames = append(frames, controlFrame{isSwitch: true, parentActive: parentActive, value: switchValue})
+		case "case":
+			if frame := topFrame(true); frame != nil && !frame.skipped && !frame.active &&
+				frame.parentActive && hasValue && frame.value == value {
+				frame.active = true
+				frame.matched = true
+			}
+		case "def":
+			if frame := topFrame(true); frame != nil && !frame.skipped && !frame.active && !frame.matched && frame.parentActive {
+				frame.active = true
+				frame.matched = true
+			}
+		case "skip":
+			if frame := topFrame(true); frame != nil && frame.active {
+				frame.active = false
+				frame.skipped = true
+			}
+		case "endsw":
+			if topFrame(true) != nil {
+				frames = frames[:len(frames)-1]
+			}
+		}
+	}
+	return activeLines, decisions
+}
+
+type evaluatedBranch struct {
+	decisions []branchDecision
+	lines     []bmsLine
+}
+
+// 到達可能な分岐の組み合わせを列挙する。MaxBranchCombinationsを超える場合は抽出する
+func enumerateBranches(lines []bmsLine) (branches []evaluatedBranch, isSampled bool) {
+	choices := []int{}
+	for {
+		if len(branches) >= MaxBranchCombinations {
+			return sampleBranches(lines), true
+		}
+		activeLines, decisions := evaluateControlFlow(lines, func(index, max int) int {
+			if index < len(choices) && choices[index] <= max {
+				return choices[index]
+			}
+			return 1
+		})
+		branches = append(branches, evaluatedBranch{decisions: decisions, lines: activeLines})
+
+		// 最後の分岐から順に次の値へ進める
+		i := len(decisions) - 1
+		for ; i >= 0 && decisions[i].value >= decisions[i].max; i-- {
+		}
+		if i < 0 {
+			break
+		}
+		choices = make([]int, i+1)
+		for j := 0; j < i; j++ {
+			choices[j] = decisions[j].value
+		}
+		choices[i] = decisions[i].value + 1
+	}
+	return branches, false
+}
+
+func sampleBranches(lines []bmsLine) (branches []evaluatedBranch) {
+	r := rand.New(rand.NewSource(1)) // 結果が毎回同じになるようにシードを固定する
+	encountered := map[string]bool{}
+	for attempt := 0; len(branches) < MaxBranchCombinations && attempt < MaxBranchCombinations*10; attempt++ {
+		activeLines, decisions := evaluateControlFlow(lines, func(index, max int) int {
+			return r.Intn(max) + 1
+		})
+		name := branchName(decisions)
+		if encountered[name] {
+			continue
+		}
+		encountered[name] = true
+		branches = append(branches, evaluatedBranch{decisions: decisions, lines: activeLines})
+	}
+	return branches
+}
+
+// 分岐の組み合わせごとにBMSを読み込み、bmsFile.Branchesに格納する
+func (bmsFile *BmsFile) scanBranches(lines []bmsLine) {
+	evaluatedBranches, isSampled := enumerateBranches(lines)
+	bmsFile.Branches = nil
+	bmsFile.BranchesAreSampled = isSampled
+	for _, evaluatedBranch := range evaluatedBranches {
+		branch := NewBmsFile(&bmsFile.BmsFileBase)
+		branch.Keymode = 0
+		branch.TotalNotes = 0
+		branch.Logs = nil
+		branch.BranchName = branchName(evaluatedBranch.decisions)
+		dds, _ := branch.scanBmsLines(evaluatedBranch.lines)
+		branch.setTotalNotesAndKeymode()
+		branch.Logs.addResultLogs(dds)
+		bmsFile.Branches = append(bmsFile.Branches, *branch)
+	}
+	if isSampled {
+		bmsFile.Logs.addResultLogs(&sampledBranches{sampledCount: len(bmsFile.Branches)})
+	}
+}
+
+type sampledBranches struct {
+	sampledCount int
+}
+
+func (sb sampledBranches) Log() Log {
+	return Log{
+		Rule:       "bms.branch-sampled",
+		Level:      Notice,
+		Message:    fmt.Sprintf("There are too many #RANDOM branch combinations, so only %d sampled combinations are checked", sb.sampledCount),
+		Message_ja: fmt.Sprintf("#RANDOMの分岐の組み合わせが多すぎるため、抽出した%d通りのみチェックしています", sb.sampledCount),
+	}
+}
+
+// 分岐ごとのログをbmsFile.Logsにまとめる。全ての分岐で共通のログは分岐名を付けずに1つにまとめる
+func (bmsFile *BmsFile) addBranchLogs(branchLogs []Logs) {
+	type branchLog struct {
+		log           Log
+		branchIndexes []int
+	}
+	keys := []string{}
+	branchLogMap := map[string]*branchLog{}
+	for i, logs := range branchLogs {
+		for _, log := range logs {
+			// 位置が違えば別のログとして残す
+			key := fmt.Sprintf("%s\x00%s\x00%d\x00%d\x00%s", log.Rule, log.Path, log.Line, log.Column, log.String())
+			bl, ok := branchLogMap[key]
+			if !ok {
+				bl = &branchLog{log: log}
+				branchLogMap[key] = bl
+				keys = append(keys, key)
+			}
+			if len(bl.branchIndexes) == 0 || bl.branchIndexes[len(bl.branchIndexes)-1] != i {
+				bl.branchIndexes = append(bl.branchIndexes, i)
+			}
+		}
+	}
+	for _, key := range keys {
+		bl := branchLogMap[key]
+		log := bl.log
+		if len(bl.branchIndexes) < len(branchLogs) {
+			names := []string{}
+			for _, i := range bl.branchIndexes {
+				names = append(names, bmsFile.Branches[i].BranchName)
+			}
+			log.Branch = strings.Join(names, " / ")
+		}
+		bmsFile.Logs.add(log)
+	}
+}
+
+// 分岐があれば分岐ごとにcheckを実行してログをまとめる。分岐が無ければbmsFileにそのまま実行する
+func (bmsFile *BmsFile) checkEachBranch(check func(bmsFile *BmsFile)) {
+	if len(bmsFile.Branches) == 0 {
+		check(bmsFile)
+		return
+	}
+	branchLogs := []Logs{}
+	for i := range bmsFile.Branches {
+		branch := &bmsFile.Branches[i]
+		start := len(branch.Logs)
+		check(branch)
+		branchLogs = append(branchLogs, branch.Logs[start:])
+	}
+	bmsFile.addBranchLogs(branchLogs)
+}
+
+// 分岐があれば分岐ごとのBMSを、無ければbmsFile自身を返す
+func (bmsFile *BmsFile) branchesOrSelf() []*BmsFile {
+	if len(bmsFile.Branches) == 0 {
+		return []*BmsFile{bmsFile}
+	}
+	branches := []*BmsFile{}
+	for i := range bmsFile.Branches {
+		branches = append(branches, &bmsFile.Branches[i])
+	}
+	return branches
+}
+
+// 全ての分岐の定義を合わせたものを行順に返す。同じ行の定義は1つにまとめる。分岐が無ければbmsFileの定義
+// (分岐の外から読み込んだ定義は、分岐ごとに同じ番号を定義していると後のもので上書きされている)
+func (bmsFile *BmsFile) unionHeaderIndexedDefs(t objType) []indexedDefinition {
+	if len(bmsFile.Branches) == 0 {
+		return bmsFile.headerIndexedDefs(t)
+	}
+	defs := []indexedDefinition{}
+	encountered := map[int]bool{}
+	for _, branch := range bmsFile.Branches {
+		for _, def := range branch.headerIndexedDefs(t) {
+			if !encountered[def.Line] {
+				encountered[def.Line] = true
+				defs = append(defs, def)
+			}
+		}
+	}
+	sort.SliceStable(defs, func(i, j int) bool { return defs[i].Line < defs[j].Line })
+	return defs
+}
+
+// 全ての分岐のオブジェを合わせたものを時間順に返す。同じ位置に書かれたオブジェは1つにまとめる。分岐が無ければbmsFileのオブジェ。
+// オブジェの定義を引けるように、それぞれのオブジェを含む分岐も返す
+func (bmsFile *BmsFile) unionBmsObjs(t objType) (objs []bmsObj, owners []*BmsFile) {
+	type ownedObj struct {
+		obj   bmsObj
+		owner *BmsFile
+	}
+	ownedObjs := []ownedObj{}
+	encountered := map[[2]int]bool{}
+	for _, branch := range bmsFile.branchesOrSelf() {
+		for _, obj := range branch.bmsObjs(t) {
+			key := [2]int{obj.Line, obj.Column}
+			if !encountered[key] {
+				encountered[key] = true
+				ownedObjs = append(ownedObjs, ownedObj{obj: obj, owner: branch})
+			}
+		}
+	}
+	// sortBmsObjsと同じ順序
+	sort.Slice(ownedObjs, func(i, j int) bool { return ownedObjs[i].obj.Value < ownedObjs[j].obj.Value })
+	sort.SliceStable(ownedObjs, func(i, j int) bool { return ownedObjs[i].obj.compareTime(ownedObjs[j].obj) < 0 })
+	for _, oo := range ownedObjs {
+		objs = append(objs, oo.obj)
+		owners = append(owners, oo.owner)
+	}
+	return objs, owners
+}
+
+type unmatchedControlCommand struct {
+	lineNumber int
+	line       string
+	opener     string
+}
+
+func (uc unmatchedControlCommand) Log() Log {
+	return Log{
+		Rule:       "bms.control-unmatched",
+		Level:      Error,
+		Message:    fmt.Sprintf("%s has no corresponding %s: %s", strings.ToUpper(controlCommandName(uc.line)), uc.opener, uc.line),
+		Message_ja: fmt.Sprintf("%sに対応する%sがありません: %s", strings.ToUpper(controlCommandName(uc.line)), uc.opener, uc.line),
+		Line:       uc.lineNumber,
+	}
+}
+
+type unclosedControlBlock struct {
+	lineNumber int
+	line       string
+	closer     string
+}
+
+func (ub unclosedControlBlock) Log() Log {
+	return Log{
+		Rule:       "bms.control-unclosed",
+		Level:      Error,
+		Message:    fmt.Sprintf("%s is not closed by %s: %s", strings.ToUpper(controlCommandName(ub.line)), ub.closer, ub.line),
+		Message_ja: fmt.Sprintf("%sが%sで閉じられていません: %s", strings.ToUpper(controlCommandName(ub.line)), ub.closer, ub.line),
+		Line:       ub.lineNumber,
+	}
+}
+
+type invalidControlValue struct {
+	lineNumber int
+	line       string
+}
+
+func (iv invalidControlValue) Log() Log {
+	return Log{
+		Rule:       "bms.control-invalid-value",
+		Level:      Error,
+		Message:    fmt.Sprintf("%s has invalid value: %s", strings.ToUpper(controlCommandName(iv.line)), iv.line),
+		Message_ja: fmt.Sprintf("%sが無効な値です: %s", strings.ToUpper(controlCommandName(iv.line)), iv.line),
+		Line:       iv.lineNumber,
+	}
+}
+
+type outOfRangeBranchValue struct {
+	lineNumber int
+	line       string
+	generator  string // #RANDOM 2など
+}
+
+func (ov outOfRangeBranchValue) Log() Log {
+	return Log{
+		Rule:       "bms.control-out-of-range",
+		Level:      Warning,
+		Message:    fmt.Sprintf("%s value is out of range of %s, so it is never selected: %s", strings.ToUpper(controlCommandName(ov.line)), ov.generator, ov.line),
+		Message_ja: fmt.Sprintf("%sの値が%sの範囲外のため、選ばれることがありません: %s", strings.ToUpper(controlCommandName(ov.line)), ov.generator, ov.line),
+		Line:       ov.lineNumber,
+	}
+}
+
+type headerRedefinedInBranch struct {
+	lineNumber int
+	line       string
+	command    string
+}
+
+func (hr headerRedefinedInBranch) Log() Log {
+	return Log{
+		Rule:       "bms.header-redefined-in-branch",
+		Level:      Warning,
+		Message:    fmt.Sprintf("#%s is redefined inside a branch: %s", strings.ToUpper(hr.command), hr.line),
+		Message_ja: fmt.Sprintf("#%sが分岐の中で再定義されています: %s", strings.ToUpper(hr.command), hr.line),
+		Line:       hr.lineNumber,
+	}
+}
+
+func controlCommandName(line string) string {
+	if fields := strings.Fields(line); len(fields) > 0 {
+		return fields[0]
+	}
+	return line
+}
+
+// 制御構文のブロック構造を検証する
+func checkControlFlowStructure(lines []bmsLine) (ucs []unmatchedControlCommand, ubs []unclosedControlBlock, ivs []invalidControlValue, ovs []outOfRangeBranchValue, hrs []headerRedefinedInBranch) {
+	type generator struct {
+		line  string
+		max   int // 0なら範囲を検証しない(#SETRANDOMなど)
+		valid bool
+	}
+	type frame struct {
+		bmsLine
+		isSwitch    bool
+		hasElse     bool
+		generator   *generator
+		randomDepth int
+	}
+	randoms := []generator{}
+	frames := []frame{}
+	topFrame := func(isSwitch bool) *frame {
+		if len(frames) > 0 && frames[len(frames)-1].isSwitch == isSwitch {
+			return &frames[len(frames)-1]
+		}
+		return nil
+	}
+	checkRange := func(line bmsLine, value string, gen *generator) {
+		v, err := strconv.Atoi(value)
+		if err != nil {
+			ivs = append(ivs, invalidControlValue{lineNumber: line.number, line: line.text})
+		} else if gen != nil && gen.valid && gen.max > 0 && (v < 1 || v > gen.max) {
+			ovs = append(ovs, outOfRangeBranchValue{lineNumber: line.number, line: line.text, generator: gen.line})
+		}
+	}
+	newGenerator := func(line bmsLine, value string, isFixed bool) generator {
+		max, err := strconv.Atoi(value)
+		if err != nil || max < 1 {
+			ivs = append(ivs, invalidControlValue{lineNumber: line.number, line: line.text})
+			return generator{line: line.text}
+		}
+		if isFixed {
+			max = 0
+		}
+		return generator{line: line.text, max: max, valid: true}
+	}
+
+	// 分岐の外で定義されたヘッダー
+	definedHeaders := map[string]bool{}
+	for _, line := range lines {
+		command, value, ok := parseControlCommand(line.text)
+		if !ok {
+			if strings.HasPrefix(line.text, "#") {
+				for _, c := range COMMANDS {
+					if lower := strings.ToLower(line.text); strings.HasPrefix(lower, "#"+c.Name+" ") || lower == "#"+c.Name {
+						if len(frames) == 0 {
+							definedHeaders[c.Name] = true
+						} else if definedHeaders[c.Name] {
+							hrs = append(hrs, headerRedefinedInBranch{lineNumber: line.number, line: line.text, command: c.Name})
+						}
+						break
+					}
+				}
+			}
+			continue
+		}
+
+		var currentRandom *generator
+		if len(randoms) > 0 {
+			currentRandom = &randoms[len(randoms)-1]
+		}
+		switch command {
+		case "random", "rondam":
+			randoms = append(randoms, newGenerator(line, value, false))
+		case "setrandom":
+			randoms = append(randoms, newGenerator(line, value, true))
+		case "endrandom":
+			if len(randoms) == 0 {
+				ucs = append(ucs, unmatchedControlCommand{lineNumber: line.number, line: line.text, opener: "#RANDOM"})
+			} else {
+				randoms = randoms[:len(randoms)-1]
+			}
+		case "if":
+			if currentRandom == nil {
+				ucs = append(ucs, unmatchedControlCommand{lineNumber: line.number, line: line.text, opener: "#RANDOM"})
+			}
+			checkRange(line, value, currentRandom)
+			frames = append(frames, frame{bmsLine: line, generator: currentRandom, randomDepth: len(randoms)})
+		case "elseif", "else":
+			f := topFrame(false)
+			if f == nil {
+				ucs = append(ucs, unmatchedControlCommand{lineNumber: line.number, line: line.text, opener: "#IF"})
+				break
+			}
+			if f.hasElse {
+				ucs = append(ucs, unmatchedControlCommand{lineNumber: line.number, line: line.text, opener: "#IF"})
+			}
+			if command == "else" {
+				f.hasElse = true
+			} else {
+				checkRange(line, value, f.generator)
+			}
+		case "endif":
+			f := topFrame(false)
+			if f == nil {
+				ucs = append(ucs, unmatchedControlCommand{lineNumber: line.number, line: line.text, opener: "#IF"})
+				break
+			}
+			if len(randoms) > f.randomDepth {
+				randoms = randoms[:f.randomDepth]
+			}
+			frames = frames[:len(frames)-1]
+		case "switch", "setswitch":
+			gen := newGenerator(line, value, command == "setswitch")
+			frames = append(frames, frame{bmsLine: line, isSwitch: true, generator: &gen})
+		case "case", "def", "skip":
+			f := topFrame(true)
+			if f == nil {
+				ucs = append(ucs, unmatchedControlCommand{lineNumber: line.number, line: line.text, opener: "#SWITCH"})
+			} else if command == "case" {
+				checkRange(line, value, f.generator)
+			}
+		case "endsw":
+			if topFrame(true) == nil {
+				ucs = append(ucs, unmatchedControlCommand{lineNumber: line.number, line: line.text, opener: "#SWITCH"})
+			} else {
+				frames = frames[:len(frames)-1]
+			}
+		}
+	}
+	for _, f := range frames {
+		closer := "#ENDIF"
+		if f.isSwitch {
+			closer = "#ENDSW"
+		}
+		ubs = append(ubs, unclosedControlBlock{lineNumber: f.number, line: f.text, closer: closer})
+	}
+	return ucs, ubs, ivs, ovs, hrs
+}
+
+type branchValue struct {
+	branchName string
+	value      string
+	line       int // 定義されている行番号
+}
+
+type notUnifiedBranchHeader struct {
+	command string
+	values  []branchValue
+}
+
+func (nb notUnifiedBranchHeader) Log() Log {
+	log := Log{
+		Rule:       "bms.branch-header-not-unified",
+		Level:      Warning,
+		Message:    fmt.Sprintf("#%s differs between branches", strings.ToUpper(nb.command)),
+		Message_ja: fmt.Sprintf("#%sが分岐によって異なります", strings.ToUpper(nb.command)),
+		Line:       nb.values[0].line, // 最初の分岐での定義の行。他の分岐での行はSubLogsに書く
+		SubLogs:    []string{},
+		SubLogType: Detail,
+	}
+	for _, bv := range nb.values {
+		log.SubLogs = append(log.SubLogs, fmt.Sprintf("%s: %s (line %d)", bv.branchName, bv.value, bv.line))
+	}
+	return log
+}
+
+// 複数の分岐で定義されているヘッダーの値が分岐によって異なるものを返す
+func CheckBranchHeadersAreUnified(bmsFile *BmsFile) (nbs []notUnifiedBranchHeader) {
+	if len(bmsFile.Branches) <= 1 {
+		return nil
+	}
+	commands := []string{}
+	valuesMap := map[string][]branchValue{}
+	add := func(command, branchName, value string, line int) {
+		if _, ok := valuesMap[command]; !ok {
+			commands = append(commands, command)
+		}
+		valuesMap[command] = append(valuesMap[command], branchValue{branchName: branchName, value: value, line: line})
+	}
+	for _, command := range COMMANDS {
+		for _, branch := range bmsFile.Branches {
+			if value, ok := branch.Header[command.Name]; ok {
+				add(command.Name, branch.BranchName, value, branch.HeaderLines[command.Name])
+			}
+		}
+	}
+	for _, t := range []objType{Wav, Bmp, ExtendedBpm, Stop, Scroll} {
+		for _, branch := range bmsFile.Branches {
+			for _, def := range branch.headerIndexedDefs(t) {
+				add(def.command(), branch.BranchName, def.Value, def.Line)
+			}
+		}
+	}
+	for _, command := range commands {
+		values := valuesMap[command]
+		for _, bv := range values[1:] {
+			if bv.value != values[0].value {
+				nbs = append(nbs, notUnifiedBranchHeader{command: command, values: values})
+				break
+			}
+		}
+	}
+	return nbs
+}
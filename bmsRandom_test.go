@@ -0,0 +1,336 @@
+package checkbms
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func newTestBmsFile(path string, lines ...string) *BmsFile {
+	return NewBmsFile(&BmsFileBase{File: File{Path: path}, FullText: []byte(strings.Join(lines, "\r\n"))})
+}
+
+func TestScanBranches(t *testing.T) {
+	tests := []struct {
+		name      string
+		lines     []string
+		wantNames []string
+		wantWavs  []int // 分岐ごとのWAVオブジェ数
+	}{
+		{
+			name: "if else",
+			lines: []string{
+				"#RANDOM 2",
+				"#IF 1", "#00111:01", "#ELSE", "#00112:01", "#00113:01", "#ENDIF",
+				"#ENDRANDOM",
+			},
+			wantNames: []string{"#RANDOM 2=1", "#RANDOM 2=2"},
+			wantWavs:  []int{1, 2},
+		},
+		{
+			name: "nested random",
+			lines: []string{
+				"#RANDOM 2",
+				"#IF 1",
+				"#RANDOM 3", "#IF 3", "#00111:01", "#ENDIF", "#ENDRANDOM",
+				"#ENDIF",
+				"#ENDRANDOM",
+			},
+			wantNames: []string{"#RANDOM 2=1, #RANDOM 3=1", "#RANDOM 2=1, #RANDOM 3=2", "#RANDOM 2=1, #RANDOM 3=3", "#RANDOM 2=2"},
+			wantWavs:  []int{0, 0, 1, 0},
+		},
+		{
+			name: "elseif",
+			lines: []string{
+				"#RANDOM 3",
+				"#IF 1", "#00111:01", "#ELSEIF 2", "#00111:0101", "#ELSE", "#00111:010101", "#ENDIF",
+			},
+			wantNames: []string{"#RANDOM 3=1", "#RANDOM 3=2", "#RANDOM 3=3"},
+			wantWavs:  []int{1, 2, 3},
+		},
+		{
+			name: "setrandom",
+			lines: []string{
+				"#SETRANDOM 2",
+				"#IF 1", "#00111:01", "#ENDIF",
+				"#IF 2", "#00111:0101", "#ENDIF",
+			},
+			wantNames: []string{""},
+			wantWavs:  []int{2},
+		},
+		{
+			name: "switch fallthrough and skip",
+			lines: []string{
+				"#SWITCH 3",
+				"#CASE 1", "#00111:01",
+				"#CASE 2", "#00112:01", "#SKIP",
+				"#DEF", "#00113:0101",
+				"#ENDSW",
+			},
+			wantNames: []string{"#SWITCH 3=1", "#SWITCH 3=2", "#SWITCH 3=3"},
+			wantWavs:  []int{2, 1, 2},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			bmsFile := newTestBmsFile("test.bms", test.lines...)
+			if err := bmsFile.ScanBmsFile(); err != nil {
+				t.Fatal(err)
+			}
+			gotNames, gotWavs := []string{}, []int{}
+			for _, branch := range bmsFile.Branches {
+				gotNames = append(gotNames, branch.BranchName)
+				gotWavs = append(gotWavs, len(branch.BmsWavObjs))
+			}
+			if !reflect.DeepEqual(gotNames, test.wantNames) {
+				t.Errorf("names: got = %v, want = %v", gotNames, test.wantNames)
+			}
+			if !reflect.DeepEqual(gotWavs, test.wantWavs) {
+				t.Errorf("wavs: got = %v, want = %v", gotWavs, test.wantWavs)
+			}
+		})
+	}
+}
+
+func TestCheckBmsFileWithBranches(t *testing.T) {
+	bmsFile := newTestBmsFile("test.bms",
+		"#WAV01 a.wav",
+		"#RANDOM 2",
+		"#IF 1", "#WAV02 b.wav", "#00111:0102", "#00111:01", "#ENDIF",
+		"#IF 2", "#WAV02 c.wav", "#00111:02", "#ENDIF",
+	)
+	if err := bmsFile.ScanBmsFile(); err != nil {
+		t.Fatal(err)
+	}
+	for _, log := range bmsFile.Logs {
+		if strings.Contains(log.Message, "is duplicate") {
+			t.Errorf("#WAV02 in different branches must not be duplicate: %s", log.String())
+		}
+	}
+
+	CheckBmsFile(bmsFile)
+	overlapCount := 0
+	for _, log := range bmsFile.Logs {
+		if strings.HasPrefix(log.Message, "Placed notes overlap") {
+			overlapCount++
+			if log.Branch != "#RANDOM 2=1" {
+				t.Errorf("overlap branch: got = %s, want = #RANDOM 2=1", log.Branch)
+			}
+		}
+		if strings.HasPrefix(log.Message, "#TITLE definition is missing") && log.Branch != "" {
+			t.Errorf("log common to all branches must not have branch name: %s", log.String())
+		}
+	}
+	if overlapCount != 1 {
+		t.Errorf("overlap count: got = %d, want = 1", overlapCount)
+	}
+}
+
+func TestCheckControlFlowStructure(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines []string
+		want  string
+	}{
+		{
+			name:  "ok",
+			lines: []string{"#TITLE a", "#RANDOM 2", "#IF 1", "#ELSEIF 2", "#ELSE", "#ENDIF", "#ENDRANDOM"},
+			want:  "",
+		},
+		{
+			name:  "unclosed if",
+			lines: []string{"#RANDOM 2", "#IF 1", "#00111:01"},
+			want:  "2: ERROR: #IF is not closed by #ENDIF: #IF 1",
+		},
+		{
+			name:  "unmatched endif",
+			lines: []string{"#RANDOM 2", "#ENDIF"},
+			want:  "2: ERROR: #ENDIF has no corresponding #IF: #ENDIF",
+		},
+		{
+			name:  "random 0 and out of range",
+			lines: []string{"#RANDOM 0", "#ENDRANDOM", "#RANDOM 2", "#IF 3", "#ENDIF"},
+			want: "1: ERROR: #RANDOM has invalid value: #RANDOM 0\n" +
+				"4: WARNING: #IF value is out of range of #RANDOM 2, so it is never selected: #IF 3",
+		},
+		{
+			name:  "header redefined",
+			lines: []string{"#TITLE a", "#RANDOM 2", "#IF 1", "#TITLE b", "#ENDIF"},
+			want:  "4: WARNING: #TITLE is redefined inside a branch: #TITLE b",
+		},
+		{
+			name:  "unmatched case",
+			lines: []string{"#CASE 1", "#SWITCH 2", "#CASE 1", "#ENDSW", "#ENDSW"},
+			want: "1: ERROR: #CASE has no corresponding #SWITCH: #CASE 1\n" +
+				"5: ERROR: #ENDSW has no corresponding #SWITCH: #ENDSW",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			lines := []bmsLine{}
+			for i, text := range test.lines {
+				lines = append(lines, bmsLine{number: i + 1, text: text})
+			}
+			var logs Logs
+			logs.addResultLogs(checkControlFlowStructure(lines))
+			// 行番号はメッセージではなくLineで確かめる
+			strs := []string{}
+			for _, log := range logs {
+				strs = append(strs, fmt.Sprintf("%d: %s", log.Line, log.String()))
+			}
+			if got := strings.Join(strs, "\n"); got != test.want {
+				t.Errorf("got = %s\n\nwant = %s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestCheckBranchHeadersAreUnified(t *testing.T) {
+	bmsFile := newTestBmsFile("test.bms",
+		"#RANDOM 2",
+		"#IF 1", "#WAV01 a.wav", "#WAV02 only1.wav", "#ENDIF",
+		"#IF 2", "#WAV01 b.wav", "#ENDIF",
+	)
+	if err := bmsFile.ScanBmsFile(); err != nil {
+		t.Fatal(err)
+	}
+	want := []notUnifiedBranchHeader{{command: "wav01", values: []branchValue{
+		{branchName: "#RANDOM 2=1", value: "a.wav", line: 3},
+		{branchName: "#RANDOM 2=2", value: "b.wav", line: 7},
+	}}}
+	got := CheckBranchHeadersAreUnified(bmsFile)
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got = %v, want = %v", got, want)
+	}
+	log := got[0].Log()
+	if log.Line != 3 || !reflect.DeepEqual(log.SubLogs, []string{"#RANDOM 2=1: a.wav (line 3)", "#RANDOM 2=2: b.wav (line 7)"}) {
+		t.Errorf("log: line = %d, SubLogs = %q", log.Line, log.SubLogs)
+	}
+}
+
+func TestTotalNotesWithExclusiveBranches(t *testing.T) {
+	bmsFile := newTestBmsFile("test.bms",
+		"#RANDOM 2",
+		"#IF 1", "#00111:01010101", "#ENDIF",
+		"#IF 2", "#00112:01010101", "#ENDIF",
+		"#ENDRANDOM",
+	)
+	if err := bmsFile.ScanBmsFile(); err != nil {
+		t.Fatal(err)
+	}
+	for _, branch := range bmsFile.Branches {
+		if branch.TotalNotes != 4 {
+			t.Errorf("%s: TotalNotes = %d, want 4", branch.BranchName, branch.TotalNotes)
+		}
+	}
+	if bmsFile.TotalNotes != 4 || bmsFile.Keymode != 5 {
+		t.Errorf("TotalNotes, Keymode = %d, %d, want 4, 5", bmsFile.TotalNotes, bmsFile.Keymode)
+	}
+	if result := NewBmsFileResult(&bmsFile.BmsFileBase); result.TotalNotes != 4 {
+		t.Errorf("NewBmsFileResult: TotalNotes = %d, want 4", result.TotalNotes)
+	}
+}
+
+func TestAddBranchLogsKeepsPositions(t *testing.T) {
+	bmsFile := &BmsFile{Branches: []BmsFile{{BranchName: "#RANDOM 2=1"}, {BranchName: "#RANDOM 2=2"}}}
+	log := func(line int) Log {
+		return Log{Rule: "bms.note-overlap", Level: Error, Message: "Placed notes overlap", Line: line, Column: 8}
+	}
+	bmsFile.addBranchLogs([]Logs{{log(3), log(5)}, {log(3)}})
+	if len(bmsFile.Logs) != 2 {
+		t.Fatalf("logs: got = %v, want 2 logs", bmsFile.Logs)
+	}
+	if bmsFile.Logs[0].Line != 3 || bmsFile.Logs[0].Branch != "" {
+		t.Errorf("common log: got = line %d, branch %q", bmsFile.Logs[0].Line, bmsFile.Logs[0].Branch)
+	}
+	if bmsFile.Logs[1].Line != 5 || bmsFile.Logs[1].Branch != "#RANDOM 2=1" {
+		t.Errorf("branch log: got = line %d, branch %q", bmsFile.Logs[1].Line, bmsFile.Logs[1].Branch)
+	}
+}
+
+func TestCheckBmsDirectoryWithBranches(t *testing.T) {
+	branchChart := strings.Join([]string{
+		"#RANDOM 2",
+		"#IF 1", "#WAV02 b.wav", "#STAGEFILE s1.png", "#ENDIF",
+		"#IF 2", "#WAV02 c.wav", "#STAGEFILE s2.png", "#ENDIF",
+		"#ENDRANDOM",
+		"#00111:02",
+	}, "\r\n")
+	check := func(files map[string]string, doDiffCheck bool) (logs Logs) {
+		mapFS := fstest.MapFS{}
+		for name, text := range files {
+			mapFS[name] = &fstest.MapFile{Data: []byte(text)}
+		}
+		bmsDir, err := ScanBmsDirectoryFS(mapFS, "song", true, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		CheckBmsDirectory(bmsDir, doDiffCheck)
+		return bmsDir.Logs
+	}
+	hasLog := func(logs Logs, rule, text string) bool {
+		for _, log := range logs {
+			if log.Rule == rule && strings.Contains(log.Message, text) {
+				return true
+			}
+		}
+		return false
+	}
+
+	// いずれかの分岐で使われているファイルは使われている
+	logs := check(map[string]string{"song/a.bms": branchChart, "song/b.wav": "", "song/c.wav": "", "song/s1.png": "", "song/s2.png": ""}, false)
+	for _, log := range logs {
+		if log.Rule == "dir.file-unused" || log.Rule == "dir.file-not-found" {
+			t.Errorf("file used in a branch is reported: %+v", log)
+		}
+	}
+
+	// 分岐の中で定義されているファイルが無い
+	logs = check(map[string]string{"song/a.bms": branchChart, "song/c.wav": "", "song/s2.png": ""}, false)
+	for _, want := range []struct {
+		text string
+		line int
+	}{{"#WAV02 b.wav", 3}, {"#STAGEFILE s1.png", 4}} {
+		found := false
+		for _, log := range logs {
+			if log.Rule == "dir.file-not-found" && strings.Contains(log.Message, want.text) {
+				found = true
+				if log.Line != want.line {
+					t.Errorf("%s: line = %d, want %d", want.text, log.Line, want.line)
+				}
+			}
+		}
+		if !found {
+			t.Errorf("dir.file-not-found of %s is not reported: %v", want.text, logs)
+		}
+	}
+	if hasLog(logs, "dir.file-not-found", "c.wav") || hasLog(logs, "dir.file-not-found", "s2.png") {
+		t.Errorf("existing file is reported: %v", logs)
+	}
+
+	// 分岐の無い譜面との比較では、全ての分岐の定義と比べる
+	files := map[string]string{
+		"song/a.bms": branchChart,
+		"song/b.bms": "#WAV02 b.wav\r\n#STAGEFILE s1.png\r\n#00111:02",
+		"song/b.wav": "", "song/c.wav": "", "song/s1.png": "", "song/s2.png": "",
+	}
+	logs = check(files, true)
+	if !hasLog(logs, "dir.definition-diff", "There are 1 differences in WAV definitions") {
+		t.Errorf("dir.definition-diff is not reported: %v", logs)
+	}
+	if !hasLog(logs, "dir.definitions-not-unified", "#STAGEFILE") {
+		t.Errorf("dir.definitions-not-unified is not reported: %v", logs)
+	}
+	for _, log := range logs {
+		if log.Rule == "dir.definition-diff" && (len(log.SubLogs) != 1 || !strings.Contains(log.SubLogs[0], "#WAV02 c.wav")) {
+			t.Errorf("dir.definition-diff: SubLogs = %v, want only #WAV02 c.wav", log.SubLogs)
+		}
+		if log.Rule == "dir.object-diff" {
+			t.Errorf("same objects are reported as different: %+v", log)
+		}
+	}
+}
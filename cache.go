@@ -0,0 +1,232 @@
+package checkbms
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/Shimi9999/checkbms/audio"
+)
+
+// 前回の実行結果を保存しておき、変更の無い譜面、音声ファイル、フォルダのチェックを省くためのキャッシュ。
+// エントリはパスごとに1つで、内容のハッシュや更新日時が一致しなければ使わない
+
+// チェックの内容やログの形式が変わったら上げる。バージョンが違うキャッシュは読み捨てる
+const CACHE_VERSION = 1
+
+type Cache struct {
+	Version     int                            `json:"version"`
+	Charts      map[string]chartCacheEntry     `json:"charts"`      // キーはBMSファイルのパス
+	Assets      map[string]assetCacheEntry     `json:"assets"`      // キーは音声ファイルなどのパス
+	Directories map[string]directoryCacheEntry `json:"directories"` // キーはフォルダのパス
+	mu          sync.Mutex
+}
+
+// CheckBmsFile, CheckBmsonFileで設定を適用する前のログ
+type chartCacheEntry struct {
+	Sha256 string `json:"sha256"`
+	Config string `json:"config"` // configFingerprint
+	Logs   Logs   `json:"logs"`
+}
+
+type assetCacheEntry struct {
+	Size        int64   `json:"size"`
+	ModTime     int64   `json:"modTime"` // UnixNano
+	Duration    float64 `json:"duration"`
+	DecodeError string  `json:"decodeError,omitempty"` // デコードできなければそのエラー
+}
+
+type directoryCacheEntry struct {
+	Key    string          `json:"key"` // directoryCacheKey
+	Result DirectoryResult `json:"result"`
+}
+
+func NewCache() *Cache {
+	return &Cache{
+		Version:     CACHE_VERSION,
+		Charts:      map[string]chartCacheEntry{},
+		Assets:      map[string]assetCacheEntry{},
+		Directories: map[string]directoryCacheEntry{},
+	}
+}
+
+// ユーザーのキャッシュフォルダのcheckbms/cache.json
+func DefaultCachePath() (string, error) {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(cacheDir, "checkbms", "cache.json"), nil
+}
+
+// キャッシュファイルを読み込む。ファイルが無い、壊れている、バージョンが違う場合は空のキャッシュを返す
+func OpenCache(path string) (*Cache, error) {
+	bytes, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return NewCache(), nil
+		}
+		return nil, err
+	}
+	cache := NewCache()
+	if err := json.Unmarshal(bytes, cache); err != nil || cache.Version != CACHE_VERSION {
+		return NewCache(), nil
+	}
+	return cache, nil
+}
+
+// キャッシュファイルに書き込む。書き込み途中のファイルが読まれないように、一時ファイルから置き換える
+func (c *Cache) Save(path string) error {
+	c.mu.Lock()
+	bytes, err := json.Marshal(c)
+	c.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, bytes, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+func configFingerprint(config *Config) string {
+	bytes, _ := json.Marshal(config)
+	// JSONに含まれない設定
+	if config.IgnoreSuppressions {
+		bytes = append(bytes, "\x00ignoreSuppressions"...)
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(bytes))
+}
+
+// cがnilなら常に無い
+func (c *Cache) chartLogs(bmsFileBase *BmsFileBase, config *Config) (Logs, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.Charts[bmsFileBase.Path]
+	if !ok || entry.Sha256 != bmsFileBase.Sha256 || entry.Config != configFingerprint(config) {
+		return nil, false
+	}
+	return append(Logs{}, entry.Logs...), true
+}
+
+func (c *Cache) storeChartLogs(bmsFileBase *BmsFileBase, config *Config) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Charts[bmsFileBase.Path] = chartCacheEntry{Sha256: bmsFileBase.Sha256, Config: configFingerprint(config), Logs: append(Logs{}, bmsFileBase.Logs...)}
+}
+
+// audio.DurationFSの結果を、ファイルのサイズと更新日時が同じ間はキャッシュから返す。cがnilなら常にデコードする。
+// キャッシュのキーはloc.path
+func (c *Cache) audioDuration(loc scanLocation) (float64, error) {
+	if c == nil {
+		return audioDuration(loc)
+	}
+	info, err := fs.Stat(loc.fsys, loc.name)
+	if err != nil {
+		return 0, loc.pathError(err)
+	}
+	c.mu.Lock()
+	entry, ok := c.Assets[loc.path]
+	c.mu.Unlock()
+	if !ok || entry.Size != info.Size() || entry.ModTime != info.ModTime().UnixNano() {
+		entry = assetCacheEntry{Size: info.Size(), ModTime: info.ModTime().UnixNano()}
+		entry.Duration, err = audioDuration(loc)
+		if err != nil {
+			entry.DecodeError = loc.pathError(err).Error()
+		}
+		c.mu.Lock()
+		c.Assets[loc.path] = entry
+		c.mu.Unlock()
+	}
+	if entry.DecodeError != "" {
+		return entry.Duration, fmt.Errorf("%s", entry.DecodeError)
+	}
+	return entry.Duration, nil
+}
+
+// zipの無圧縮のエントリはシークできるので、全体を読み込まずに長さを求める
+func audioDuration(loc scanLocation) (float64, error) {
+	if f := zipFileOf(loc.fsys, loc.name); f != nil && f.Method == zip.Store {
+		r, err := f.OpenRaw()
+		if err != nil {
+			return 0, err
+		}
+		return audio.DurationReader(r, loc.name)
+	}
+	return audio.DurationFS(loc.fsys, loc.name)
+}
+
+// フォルダの全てのファイルから作るキー。直下のBMSファイルは内容のハッシュ、その他のファイルはサイズと更新日時を使う
+func directoryCacheKey(path string, config *Config, doDiffCheck bool) (string, error) {
+	members := []string{}
+	err := filepath.WalkDir(path, func(filePath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rPath, _ := filepath.Rel(path, filePath)
+		if d.IsDir() {
+			members = append(members, "d:"+rPath)
+			return nil
+		}
+		if filepath.Dir(filePath) == filepath.Clean(path) && IsBmsFile(d.Name()) {
+			bytes, err := os.ReadFile(filePath)
+			if err != nil {
+				return err
+			}
+			members = append(members, fmt.Sprintf("b:%s:%x", rPath, sha256.Sum256(bytes)))
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		members = append(members, fmt.Sprintf("f:%s:%d:%d", rPath, info.Size(), info.ModTime().UnixNano()))
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	sort.Strings(members)
+	key := fmt.Sprintf("%d\x00%s\x00%t\x00%s", CACHE_VERSION, configFingerprint(config), doDiffCheck, strings.Join(members, "\x00"))
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(key))), nil
+}
+
+func (c *Cache) directoryResult(path, key string) (DirectoryResult, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.Directories[path]
+	if !ok || entry.Key != key {
+		return DirectoryResult{}, false
+	}
+	return cloneDirectoryResult(entry.Result), true
+}
+
+func (c *Cache) storeDirectoryResult(path, key string, result DirectoryResult) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Directories[path] = directoryCacheEntry{Key: key, Result: cloneDirectoryResult(result)}
+}
+
+// Report.FilterLevelなどが要素を書き換えても、キャッシュの結果が変わらないようにする
+func cloneDirectoryResult(result DirectoryResult) DirectoryResult {
+	result.BmsFiles = append([]BmsFileResult{}, result.BmsFiles...)
+	result.BmsonFiles = append([]BmsFileResult{}, result.BmsonFiles...)
+	return result
+}
@@ -0,0 +1,93 @@
+package checkbms
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCacheChartLogs(t *testing.T) {
+	cache := NewCache()
+	newBmsFile := func() *BmsFile {
+		bmsFile := newTestBmsFile("test.bms", "#TITLE a", "#WAV01 a.wav", "#00111:01")
+		if err := bmsFile.ScanBmsFile(); err != nil {
+			t.Fatal(err)
+		}
+		bmsFile.Cache = cache
+		return bmsFile
+	}
+
+	first := newBmsFile()
+	CheckBmsFile(first)
+	if _, ok := cache.Charts["test.bms"]; !ok {
+		t.Fatalf("chart is not cached")
+	}
+
+	// キャッシュのログが使われることを確かめるために書き換える
+	entry := cache.Charts["test.bms"]
+	entry.Logs = Logs{{Rule: "bms.header-missing", Level: Error, Message: "cached"}}
+	cache.Charts["test.bms"] = entry
+	second := newBmsFile()
+	CheckBmsFile(second)
+	if len(second.Logs) != 1 || second.Logs[0].Message != "cached" || second.Logs[0].Path != "test.bms" {
+		t.Errorf("cached logs are not used: %v", second.Logs)
+	}
+
+	// 設定が変わればチェックし直す
+	third := newBmsFile()
+	third.Config = DefaultConfig()
+	third.Config.Thresholds.TotalOverRate = 2
+	CheckBmsFile(third)
+	if len(third.Logs) != len(first.Logs) {
+		t.Errorf("logs with another config: got = %d logs, want = %d", len(third.Logs), len(first.Logs))
+	}
+}
+
+func TestCheckDirectoriesWithCache(t *testing.T) {
+	root := newTestLibrary(t, 3)
+	cachePath := filepath.Join(t.TempDir(), "cache.json")
+	check := func() []DirectoryCheckResult {
+		cache, err := OpenCache(cachePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		results, err := CheckDirectoriesWithCache(context.Background(), root, 2, DefaultConfig(), false, cache)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := []DirectoryCheckResult{}
+		for result := range results {
+			if result.Err != nil {
+				t.Fatalf("%s: %s", result.Path, result.Err.Error())
+			}
+			got = append(got, result)
+		}
+		if err := cache.Save(cachePath); err != nil {
+			t.Fatal(err)
+		}
+		return got
+	}
+
+	first := check()
+	second := check()
+	for i := range second {
+		if second[i].Directory != nil {
+			t.Errorf("%s: cache is not used", second[i].Path)
+		}
+		if len(second[i].Result.BmsFiles) != 1 || len(second[i].Result.BmsFiles[0].Diagnostics) != len(first[i].Result.BmsFiles[0].Diagnostics) {
+			t.Errorf("%s: cached result differs: %v", second[i].Path, second[i].Result)
+		}
+	}
+
+	// 変更したフォルダだけチェックし直す
+	if err := os.WriteFile(filepath.Join(root, "song01", "a.bms"), []byte("#TITLE changed\r\n#ARTIST a\r\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	third := check()
+	for i, result := range third {
+		if isChanged := i == 1; (result.Directory != nil) != isChanged {
+			t.Errorf("%s: checked = %t, want = %t", result.Path, result.Directory != nil, isChanged)
+		}
+	}
+}
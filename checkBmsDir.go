@@ -8,7 +8,6 @@ import (
 	"sort"
 	"strings"
 
-	"github.com/Shimi9999/checkbms/audio"
 	"github.com/Shimi9999/checkbms/bmson"
 	"github.com/Shimi9999/checkbms/diff"
 )
@@ -68,6 +67,7 @@ type notExistFile struct {
 	bmsPath  string
 	filePath string
 	command  string
+	line     int // bmsPathの中で定義されている行番号
 }
 
 func notExistFileLog(nf notExistFile, isBmson bool) Log {
@@ -76,9 +76,13 @@ func notExistFileLog(nf notExistFile, isBmson bool) Log {
 		label = nf.command
 	}
 	return Log{
-		Level:      nf.level,
-		Message:    fmt.Sprintf("Defined file does not exist(%s): %s %s", relativePathFromBmsRoot(nf.dirPath, nf.bmsPath), label, nf.filePath),
-		Message_ja: fmt.Sprintf("定義されているファイルが実在しません(%s): %s %s", relativePathFromBmsRoot(nf.dirPath, nf.bmsPath), label, nf.filePath),
+		Rule:         "dir.file-not-found",
+		Level:        nf.level,
+		Message:      fmt.Sprintf("Defined file does not exist(%s): %s %s", relativePathFromBmsRoot(nf.dirPath, nf.bmsPath), label, nf.filePath),
+		Message_ja:   fmt.Sprintf("定義されているファイルが実在しません(%s): %s %s", relativePathFromBmsRoot(nf.dirPath, nf.bmsPath), label, nf.filePath),
+		Path:         nf.bmsPath,
+		Line:         nf.line,
+		RelatedPaths: []string{filepath.Join(nf.dirPath, nf.filePath)},
 	}
 }
 
@@ -86,13 +90,21 @@ func (nf notExistFile) Log() Log {
 	return notExistFileLog(nf, false)
 }
 
+// 分岐がある場合は、いずれかの分岐で定義されているファイルを全てチェックする
 func CheckDefinedFilesExist(bmsDir *Directory, bmsFile *BmsFile) (nfs []notExistFile) {
+	encountered := map[notExistFile]bool{}
 	check := func(commands []string, exts []string) {
-		for _, command := range commands {
-			val, ok := bmsFile.Header[command]
-			if ok && val != "" {
-				if !containsInNonBmsFiles(bmsDir, val, exts, false) {
-					nfs = append(nfs, notExistFile{level: Warning, dirPath: bmsDir.Path, bmsPath: bmsFile.Path, filePath: val, command: command})
+		for _, branch := range bmsFile.branchesOrSelf() {
+			for _, command := range commands {
+				val, ok := branch.Header[command]
+				if ok && val != "" {
+					if !containsInNonBmsFiles(bmsDir, val, exts, false) {
+						nf := notExistFile{level: Warning, dirPath: bmsDir.Path, bmsPath: bmsFile.Path, filePath: val, command: command, line: branch.HeaderLines[command]}
+						if !encountered[nf] {
+							encountered[nf] = true
+							nfs = append(nfs, nf)
+						}
+					}
 				}
 			}
 		}
@@ -107,10 +119,10 @@ func CheckDefinedFilesExist(bmsDir *Directory, bmsFile *BmsFile) (nfs []notExist
 
 //pathsOfdoNotExistWavs := []string{}
 func CheckDefinedWavFilesExist(bmsDir *Directory, bmsFile *BmsFile) (nfs []notExistFile) {
-	for _, def := range bmsFile.HeaderWav {
+	for _, def := range bmsFile.unionHeaderIndexedDefs(Wav) {
 		if def.Value != "" {
 			if !containsInNonBmsFiles(bmsDir, def.Value, AUDIO_EXTS, false) {
-				nfs = append(nfs, notExistFile{level: Error, dirPath: bmsDir.Path, bmsPath: bmsFile.Path, filePath: def.Value, command: def.command()})
+				nfs = append(nfs, notExistFile{level: Error, dirPath: bmsDir.Path, bmsPath: bmsFile.Path, filePath: def.Value, command: def.command(), line: def.Line})
 			}
 		}
 	}
@@ -118,14 +130,14 @@ func CheckDefinedWavFilesExist(bmsDir *Directory, bmsFile *BmsFile) (nfs []notEx
 }
 
 func CheckDefinedBmpFilesExist(bmsDir *Directory, bmsFile *BmsFile) (nfs []notExistFile) {
-	for _, def := range bmsFile.HeaderBmp {
+	for _, def := range bmsFile.unionHeaderIndexedDefs(Bmp) {
 		if def.Value != "" {
 			exts := IMAGE_EXTS
 			if hasExts(def.Value, MOVIE_EXTS) {
 				exts = append(MOVIE_EXTS, IMAGE_EXTS...)
 			}
 			if !containsInNonBmsFiles(bmsDir, def.Value, exts, false) {
-				nfs = append(nfs, notExistFile{level: Error, dirPath: bmsDir.Path, bmsPath: bmsFile.Path, filePath: def.Value, command: def.command()})
+				nfs = append(nfs, notExistFile{level: Error, dirPath: bmsDir.Path, bmsPath: bmsFile.Path, filePath: def.Value, command: def.command(), line: def.Line})
 			}
 		}
 	}
@@ -205,11 +217,13 @@ type notUnifiedDefinition struct {
 
 type notUnifiedDefinitions struct {
 	command string
+	dirPath string
 	defs    []notUnifiedDefinition
 }
 
 func (nd notUnifiedDefinitions) Log() Log {
 	log := Log{
+		Rule:       "dir.definitions-not-unified",
 		Level:      Warning,
 		Message:    fmt.Sprintf("%s are not unified", nd.command),
 		Message_ja: fmt.Sprintf("%sが統一されていません", nd.command),
@@ -218,6 +232,7 @@ func (nd notUnifiedDefinitions) Log() Log {
 	}
 	for _, def := range nd.defs {
 		log.SubLogs = append(log.SubLogs, fmt.Sprintf("%s: %s", def.bmsFilePath, def.value))
+		log.RelatedPaths = append(log.RelatedPaths, filepath.Join(nd.dirPath, def.bmsFilePath))
 	}
 	return log
 }
@@ -240,12 +255,23 @@ func CheckDefinitionsAreUnified(bmsDir *Directory) (nds []notUnifiedDefinitions)
 	valueAndPaths := make([][]notUnifiedDefinition, len(unifyCommands))
 	for i, uc := range unifyCommands {
 		if uc.bmsCommand != "" {
-			for _, bmsFile := range bmsDir.BmsFiles {
-				valueAndPaths[i] = append(valueAndPaths[i], notUnifiedDefinition{
-					bmsFilePath: relativePathFromBmsRoot(bmsDir.Path, bmsFile.Path),
-					value:       bmsFile.Header[uc.bmsCommand]})
-				if len(valueAndPaths[i]) >= 2 && valueAndPaths[i][len(valueAndPaths[i])-2].value != bmsFile.Header[uc.bmsCommand] {
-					unifyCommands[i].isNotUnified = true
+			for j := range bmsDir.BmsFiles {
+				// 分岐によって値が違う場合は、それぞれの値を並べる
+				values := []string{}
+				encountered := map[string]bool{}
+				for _, branch := range bmsDir.BmsFiles[j].branchesOrSelf() {
+					if value := branch.Header[uc.bmsCommand]; !encountered[value] {
+						encountered[value] = true
+						values = append(values, value)
+					}
+				}
+				for _, value := range values {
+					valueAndPaths[i] = append(valueAndPaths[i], notUnifiedDefinition{
+						bmsFilePath: relativePathFromBmsRoot(bmsDir.Path, bmsDir.BmsFiles[j].Path),
+						value:       value})
+					if len(valueAndPaths[i]) >= 2 && valueAndPaths[i][len(valueAndPaths[i])-2].value != value {
+						unifyCommands[i].isNotUnified = true
+					}
 				}
 			}
 		}
@@ -278,64 +304,124 @@ func CheckDefinitionsAreUnified(bmsDir *Directory) (nds []notUnifiedDefinitions)
 			} else if len(bmsDir.BmsonFiles) > 0 {
 				commandStr += "info." + uc.bmsonField
 			}
-			nds = append(nds, notUnifiedDefinitions{command: commandStr, defs: valueAndPaths[i]})
+			nds = append(nds, notUnifiedDefinitions{command: commandStr, dirPath: bmsDir.Path, defs: valueAndPaths[i]})
 		}
 	}
 	return nds
 }
 
 type unusedFile struct {
-	path string
+	dirPath string
+	path    string
 }
 
 func (uf unusedFile) Log() Log {
 	return Log{
+		Rule:       "dir.file-unused",
 		Level:      Notice,
 		Message:    fmt.Sprintf("This file is not used: %s", uf.path),
 		Message_ja: fmt.Sprintf("このファイルは使用されていません: %s", uf.path),
+		Path:       filepath.Join(uf.dirPath, uf.path),
 	}
 }
 
 func CheckUnusedFile(bmsDir *Directory) (ufs []unusedFile) {
-	ignoreExts := []string{".txt", ".zip", ".rar", ".lzh", ".7z"}
+	ignoreExts := configOrDefault(bmsDir.Config).Thresholds.UnusedFileIgnoredExts
 	for _, nonBmsFile := range bmsDir.NonBmsFiles {
-		if !nonBmsFile.UsedFromAny() && !hasExts(nonBmsFile.Path, ignoreExts) && !isPreview(bmsDir.Path, nonBmsFile.Path) {
-			ufs = append(ufs, unusedFile{path: relativePathFromBmsRoot(bmsDir.Path, nonBmsFile.Path)})
+		if !nonBmsFile.UsedFromAny() && !hasExts(nonBmsFile.Path, ignoreExts) && !isPreview(bmsDir.Path, nonBmsFile.Path) &&
+			filepath.Base(nonBmsFile.Path) != CONFIG_FILENAME {
+			ufs = append(ufs, unusedFile{dirPath: bmsDir.Path, path: relativePathFromBmsRoot(bmsDir.Path, nonBmsFile.Path)})
 		}
 	}
 	return ufs
 }
 
+type unreadableFile struct {
+	dirPath   string
+	scanError ScanError
+}
+
+func (uf unreadableFile) Log() Log {
+	path := relativePathFromBmsRoot(uf.dirPath, uf.scanError.Path)
+	return Log{
+		Rule:       "dir.file-unreadable",
+		Level:      Error,
+		Message:    fmt.Sprintf("This file cannot be read: %s (%s)", path, uf.scanError.Err.Error()),
+		Message_ja: fmt.Sprintf("このファイルを読み込めません: %s (%s)", path, uf.scanError.Err.Error()),
+		Path:       uf.scanError.Path,
+	}
+}
+
+func CheckUnreadableFiles(bmsDir *Directory) (ufs []unreadableFile) {
+	for _, se := range bmsDir.ScanErrors {
+		ufs = append(ufs, unreadableFile{dirPath: bmsDir.Path, scanError: se})
+	}
+	return ufs
+}
+
+type garbledZipFilename struct {
+	dirPath string
+	garbledZipName
+}
+
+func (gf garbledZipFilename) Log() Log {
+	path := relativePathFromBmsRoot(gf.dirPath, gf.path)
+	reason, reason_ja := "not Shift_JIS", "Shift_JISではありません"
+	if gf.isUTF8 {
+		reason, reason_ja = "UTF-8 without the UTF-8 flag", "UTF-8フラグの無いUTF-8です"
+	}
+	return Log{
+		Rule:       "dir.zip-filename-garbled",
+		Level:      Warning,
+		Message:    fmt.Sprintf("This filename in zip will be garbled when extracted on Japanese Windows: %s (%s)", path, reason),
+		Message_ja: fmt.Sprintf("このzip内のファイル名は日本語版Windowsで展開すると文字化けします: %s (%s)", path, reason_ja),
+		Path:       gf.path,
+	}
+}
+
+func CheckGarbledZipFilenames(bmsDir *Directory) (gfs []garbledZipFilename) {
+	for _, gn := range bmsDir.garbledZipNames {
+		gfs = append(gfs, garbledZipFilename{dirPath: bmsDir.Path, garbledZipName: gn})
+	}
+	return gfs
+}
+
 type emptyDirectory struct {
-	path string
+	dirPath string
+	path    string
 }
 
 func (ed emptyDirectory) Log() Log {
 	return Log{
+		Rule:       "dir.directory-empty",
 		Level:      Notice,
 		Message:    fmt.Sprintf("This directory is empty: %s", ed.path),
 		Message_ja: fmt.Sprintf("このフォルダは空です: %s", ed.path),
+		Path:       filepath.Join(ed.dirPath, ed.path),
 	}
 }
 
 func CheckEmptyDirectory(bmsDir *Directory) (eds []emptyDirectory) {
 	for _, dir := range bmsDir.Directories {
 		if len(dir.BmsFiles) == 0 && len(dir.NonBmsFiles) == 0 && len(dir.Directories) == 0 {
-			eds = append(eds, emptyDirectory{path: relativePathFromBmsRoot(bmsDir.Path, dir.Path)})
+			eds = append(eds, emptyDirectory{dirPath: bmsDir.Path, path: relativePathFromBmsRoot(bmsDir.Path, dir.Path)})
 		}
 	}
 	return eds
 }
 
 type environmentDependentFilename struct {
-	path string
+	dirPath string
+	path    string
 }
 
 func (ef environmentDependentFilename) Log() Log {
 	return Log{
+		Rule:       "dir.filename-environment-dependent",
 		Level:      Warning,
 		Message:    fmt.Sprintf("This filename has environment-dependent characters: %s", ef.path),
 		Message_ja: fmt.Sprintf("このファイル名は環境依存文字を含んでいます: %s", ef.path),
+		Path:       filepath.Join(ef.dirPath, ef.path),
 	}
 }
 
@@ -343,12 +429,12 @@ func (ef environmentDependentFilename) Log() Log {
 func CheckEnvironmentDependentFilename(bmsDir *Directory) (efs []environmentDependentFilename) {
 	for _, file := range bmsDir.BmsFiles {
 		if rPath := relativePathFromBmsRoot(bmsDir.Path, file.Path); containsMultibyteRune(rPath) {
-			efs = append(efs, environmentDependentFilename{path: rPath})
+			efs = append(efs, environmentDependentFilename{dirPath: bmsDir.Path, path: rPath})
 		}
 	}
 	for _, file := range bmsDir.NonBmsFiles {
 		if rPath := relativePathFromBmsRoot(bmsDir.Path, file.Path); (file.UsedFromAny() || strings.ToLower(filepath.Ext(file.Path)) == ".txt" || isPreview(bmsDir.Path, file.Path)) && containsMultibyteRune(rPath) {
-			efs = append(efs, environmentDependentFilename{path: rPath})
+			efs = append(efs, environmentDependentFilename{dirPath: bmsDir.Path, path: rPath})
 		}
 	}
 	return efs
@@ -356,24 +442,40 @@ func CheckEnvironmentDependentFilename(bmsDir *Directory) (efs []environmentDepe
 
 type over1MinuteAudioFile struct {
 	duration float64
+	limit    float64 // 秒
+	dirPath  string
 	path     string
 }
 
 func (oa over1MinuteAudioFile) Log() Log {
+	limitText, limitText_ja := "1 minute", "1分"
+	if oa.limit != 60.0 {
+		limitText = formatFloat(oa.limit) + "sec"
+		limitText_ja = formatFloat(oa.limit) + "秒"
+	}
 	return Log{
+		Rule:       "dir.audio-over-1-minute",
 		Level:      Warning,
-		Message:    fmt.Sprintf("This audio file is over 1 minute(%.1fsec): %s", oa.duration, oa.path),
-		Message_ja: fmt.Sprintf("この音声ファイルは1分以上あります(%.1fsec): %s", oa.duration, oa.path),
+		Message:    fmt.Sprintf("This audio file is over %s(%.1fsec): %s", limitText, oa.duration, oa.path),
+		Message_ja: fmt.Sprintf("この音声ファイルは%s以上あります(%.1fsec): %s", limitText_ja, oa.duration, oa.path),
+		Path:       filepath.Join(oa.dirPath, oa.path),
 	}
 }
 
 // must do after CheckDefinedWavFilesExist
 // TODO 引数としてUsedリストを受け取る？
 func CheckOver1MinuteAudioFile(bmsDir *Directory) (oas []over1MinuteAudioFile) {
+	limit := configOrDefault(bmsDir.Config).Thresholds.AudioDurationLimit
 	for _, file := range bmsDir.NonBmsFiles {
 		if file.Used_bms && hasExts(file.Path, AUDIO_EXTS) {
-			if d, _ := audio.Duration(file.Path); d >= 60.0 {
-				oas = append(oas, over1MinuteAudioFile{duration: d, path: relativePathFromBmsRoot(bmsDir.Path, file.Path)})
+			loc, err := bmsDir.fileLocation(file.Path)
+			if err != nil {
+				continue
+			}
+			d, _ := bmsDir.Cache.audioDuration(loc)
+			loc.close()
+			if d >= limit {
+				oas = append(oas, over1MinuteAudioFile{duration: d, limit: limit, dirPath: bmsDir.Path, path: relativePathFromBmsRoot(bmsDir.Path, file.Path)})
 			}
 		}
 	}
@@ -386,13 +488,16 @@ type sameHashBmsFiles struct {
 
 func (sb sameHashBmsFiles) Log() Log {
 	log := Log{
+		Rule:       "dir.bmsfiles-same",
 		Level:      Warning,
 		Message:    "These bmsfiles are same",
 		Message_ja: "これらのBMSファイルは同一です",
 		SubLogs:    []string{},
 		SubLogType: Detail,
+		Path:       sb.paths[0],
 	}
 	log.SubLogs = append(log.SubLogs, sb.paths...)
+	log.RelatedPaths = append(log.RelatedPaths, sb.paths...)
 	return log
 }
 
@@ -440,6 +545,16 @@ func groupsStrings(groups [][]string) (strs []string) {
 	return strs
 }
 
+// グループ内のbmsフォルダからの相対パスを、dirPathを含めたパスにして1つのスライスにまとめる
+func flattenGroups(dirPath string, groups [][]string) (paths []string) {
+	for _, group := range groups {
+		for _, path := range group {
+			paths = append(paths, filepath.Join(dirPath, path))
+		}
+	}
+	return paths
+}
+
 func groupStringSlice(pathAndStringss []pathAndStrings) (groups [][]string) {
 	pss := append([]pathAndStrings{}, pathAndStringss...)
 	for len(pss) > 0 {
@@ -460,16 +575,19 @@ func groupStringSlice(pathAndStringss []pathAndStrings) (groups [][]string) {
 
 type notUnifiedIndexedDefinition struct {
 	otype      objType
+	dirPath    string
 	pathGroups [][]string
 }
 
 func (ni notUnifiedIndexedDefinition) Log() Log {
 	return Log{
-		Level:      Warning,
-		Message:    fmt.Sprintf("#%sxx are not unified", strings.ToUpper(ni.otype.string())),
-		Message_ja: fmt.Sprintf("#%sxxが統一されていません", strings.ToUpper(ni.otype.string())),
-		SubLogs:    groupsStrings(ni.pathGroups),
-		SubLogType: Detail,
+		Rule:         "dir.indexed-definitions-not-unified",
+		Level:        Warning,
+		Message:      fmt.Sprintf("#%sxx are not unified", strings.ToUpper(ni.otype.string())),
+		Message_ja:   fmt.Sprintf("#%sxxが統一されていません", strings.ToUpper(ni.otype.string())),
+		SubLogs:      groupsStrings(ni.pathGroups),
+		SubLogType:   Detail,
+		RelatedPaths: flattenGroups(ni.dirPath, ni.pathGroups),
 	}
 }
 
@@ -486,12 +604,12 @@ func CheckIndexedDefinitionsAreUnified(bmsDir *Directory) (nis []notUnifiedIndex
 		for i := range bmsDir.BmsFiles {
 			definitions = append(definitions, pathAndStrings{
 				path: relativePathFromBmsRoot(bmsDir.Path, bmsDir.BmsFiles[i].Path),
-				strs: makeDefStrs(bmsDir.BmsFiles[i].headerIndexedDefs(otype))})
+				strs: makeDefStrs(bmsDir.BmsFiles[i].unionHeaderIndexedDefs(otype))})
 		}
 
 		groups := groupStringSlice(definitions)
 		if len(groups) > 1 {
-			nis = append(nis, notUnifiedIndexedDefinition{otype: otype, pathGroups: groups})
+			nis = append(nis, notUnifiedIndexedDefinition{otype: otype, dirPath: bmsDir.Path, pathGroups: groups})
 		}
 	}
 	return nis
@@ -499,16 +617,19 @@ func CheckIndexedDefinitionsAreUnified(bmsDir *Directory) (nis []notUnifiedIndex
 
 type notUnifiedObjectStructure struct {
 	otype      objType
+	dirPath    string
 	pathGroups [][]string
 }
 
 func (no notUnifiedObjectStructure) Log() Log {
 	return Log{
-		Level:      Warning,
-		Message:    fmt.Sprintf("%s object structures are not unified", strings.ToUpper(no.otype.string())),
-		Message_ja: fmt.Sprintf("%sオブジェ構成が統一されていません", strings.ToUpper(no.otype.string())),
-		SubLogs:    groupsStrings(no.pathGroups),
-		SubLogType: Detail,
+		Rule:         "dir.object-structures-not-unified",
+		Level:        Warning,
+		Message:      fmt.Sprintf("%s object structures are not unified", strings.ToUpper(no.otype.string())),
+		Message_ja:   fmt.Sprintf("%sオブジェ構成が統一されていません", strings.ToUpper(no.otype.string())),
+		SubLogs:      groupsStrings(no.pathGroups),
+		SubLogType:   Detail,
+		RelatedPaths: flattenGroups(no.dirPath, no.pathGroups),
 	}
 }
 
@@ -516,8 +637,9 @@ func CheckObjectStructuresAreUnified(bmsDir *Directory) (nos []notUnifiedObjectS
 	otypes := []objType{Bmp, Wav}
 	for _, otype := range otypes {
 		makeObjStrs := func(bmsFile *BmsFile) (objStrs []string) {
-			for _, obj := range bmsFile.bmsObjs(otype) {
-				if !obj.IsLNEnd && bmsFile.definedValue(otype, obj.value36()) != "" {
+			objs, owners := bmsFile.unionBmsObjs(otype)
+			for i, obj := range objs {
+				if !obj.IsLNEnd && owners[i].definedValue(otype, obj.value36()) != "" {
 					pos := obj.Position
 					pos.reduce()
 					objStrs = append(objStrs, fmt.Sprintf("%d-%d/%d %s", obj.Measure, pos.Numerator, pos.Denominator, obj.value36()))
@@ -534,23 +656,26 @@ func CheckObjectStructuresAreUnified(bmsDir *Directory) (nos []notUnifiedObjectS
 
 		groups := groupStringSlice(structures)
 		if len(groups) > 1 {
-			nos = append(nos, notUnifiedObjectStructure{otype: otype, pathGroups: groups})
+			nos = append(nos, notUnifiedObjectStructure{otype: otype, dirPath: bmsDir.Path, pathGroups: groups})
 		}
 	}
 	return nos
 }
 
 type notUnifiedSoundChannels struct {
+	dirPath    string
 	pathGroups [][]string
 }
 
 func (ns notUnifiedSoundChannels) Log() Log {
 	return Log{
-		Level:      Warning,
-		Message:    "Starting points of sound_channels are not unified",
-		Message_ja: "sound_channelsの音声開始地点が統一されていません",
-		SubLogs:    groupsStrings(ns.pathGroups),
-		SubLogType: Detail,
+		Rule:         "dir.sound-channels-not-unified",
+		Level:        Warning,
+		Message:      "Starting points of sound_channels are not unified",
+		Message_ja:   "sound_channelsの音声開始地点が統一されていません",
+		SubLogs:      groupsStrings(ns.pathGroups),
+		SubLogType:   Detail,
+		RelatedPaths: flattenGroups(ns.dirPath, ns.pathGroups),
 	}
 }
 
@@ -575,23 +700,26 @@ func CheckSoundChannelsAreUnified(bmsDir *Directory) (ns *notUnifiedSoundChannel
 
 	groups := groupStringSlice(pathAndStringss)
 	if len(groups) > 1 {
-		ns = &notUnifiedSoundChannels{pathGroups: groups}
+		ns = &notUnifiedSoundChannels{dirPath: bmsDir.Path, pathGroups: groups}
 	}
 
 	return ns
 }
 
 type notUnifiedBgaHeader struct {
+	dirPath    string
 	pathGroups [][]string
 }
 
 func (nb notUnifiedBgaHeader) Log() Log {
 	return Log{
-		Level:      Warning,
-		Message:    "bga_header are not unified",
-		Message_ja: "bga_headerが統一されていません",
-		SubLogs:    groupsStrings(nb.pathGroups),
-		SubLogType: Detail,
+		Rule:         "dir.bga-headers-not-unified",
+		Level:        Warning,
+		Message:      "bga_header are not unified",
+		Message_ja:   "bga_headerが統一されていません",
+		SubLogs:      groupsStrings(nb.pathGroups),
+		SubLogType:   Detail,
+		RelatedPaths: flattenGroups(nb.dirPath, nb.pathGroups),
 	}
 }
 
@@ -615,24 +743,27 @@ func CheckBgaHeadersAreUnified(bmsDir *Directory) (nb *notUnifiedBgaHeader) {
 
 	groups := groupStringSlice(pathAndStringss)
 	if len(groups) > 1 {
-		nb = &notUnifiedBgaHeader{pathGroups: groups}
+		nb = &notUnifiedBgaHeader{dirPath: bmsDir.Path, pathGroups: groups}
 	}
 
 	return nb
 }
 
 type notUnifiedBgaEvents struct {
+	dirPath    string
 	pathGroups [][]string
 	eventsName string
 }
 
 func (nb notUnifiedBgaEvents) Log() Log {
 	return Log{
-		Level:      Warning,
-		Message:    fmt.Sprintf("%s are not unified", nb.eventsName),
-		Message_ja: fmt.Sprintf("%sが統一されていません", nb.eventsName),
-		SubLogs:    groupsStrings(nb.pathGroups),
-		SubLogType: Detail,
+		Rule:         "dir.bga-events-not-unified",
+		Level:        Warning,
+		Message:      fmt.Sprintf("%s are not unified", nb.eventsName),
+		Message_ja:   fmt.Sprintf("%sが統一されていません", nb.eventsName),
+		SubLogs:      groupsStrings(nb.pathGroups),
+		SubLogType:   Detail,
+		RelatedPaths: flattenGroups(nb.dirPath, nb.pathGroups),
 	}
 }
 
@@ -664,7 +795,7 @@ func CheckBgaEventsAreUnified(bmsDir *Directory) (nbs []notUnifiedBgaEvents) {
 
 		groups := groupStringSlice(pathAndStringss)
 		if len(groups) > 1 {
-			nbs = append(nbs, notUnifiedBgaEvents{pathGroups: groups, eventsName: strings.ToLower(eventsName)})
+			nbs = append(nbs, notUnifiedBgaEvents{dirPath: bmsDir.Path, pathGroups: groups, eventsName: strings.ToLower(eventsName)})
 		}
 	}
 	return nbs
@@ -672,6 +803,7 @@ func CheckBgaEventsAreUnified(bmsDir *Directory) (nbs []notUnifiedBgaEvents) {
 
 type definitionDiff struct {
 	oType       objType
+	dirPath     string
 	pathI       string
 	pathJ       string
 	missingDefs []missingDef
@@ -684,11 +816,13 @@ type missingDef struct {
 
 func (dd definitionDiff) Log() Log {
 	log := Log{
-		Level:      Warning,
-		Message:    fmt.Sprintf("There are %d differences in %s definitions: %s %s", len(dd.missingDefs), dd.oType.string(), dd.pathI, dd.pathJ),
-		Message_ja: fmt.Sprintf("%s定義に%d個の違いがあります: %s %s", dd.oType.string(), len(dd.missingDefs), dd.pathI, dd.pathJ),
-		SubLogs:    []string{},
-		SubLogType: Detail,
+		Rule:         "dir.definition-diff",
+		Level:        Warning,
+		Message:      fmt.Sprintf("There are %d differences in %s definitions: %s %s", len(dd.missingDefs), dd.oType.string(), dd.pathI, dd.pathJ),
+		Message_ja:   fmt.Sprintf("%s定義に%d個の違いがあります: %s %s", dd.oType.string(), len(dd.missingDefs), dd.pathI, dd.pathJ),
+		SubLogs:      []string{},
+		SubLogType:   Detail,
+		RelatedPaths: []string{filepath.Join(dd.dirPath, dd.pathI), filepath.Join(dd.dirPath, dd.pathJ)},
 	}
 	for _, mDef := range dd.missingDefs {
 		log.SubLogs = append(log.SubLogs, fmt.Sprintf("Missing(%s): %s", mDef.path, mDef.value)) // TODO 日本語対応
@@ -701,7 +835,7 @@ func CheckDefinitionDiff(bmsDirPath string, bmsFileI, bmsFileJ *BmsFile) (dds []
 		return nil
 	}
 	diffDefs := func(t objType, iBmsFile, jBmsFile *BmsFile) {
-		iDefs, jDefs := iBmsFile.headerIndexedDefs(t), jBmsFile.headerIndexedDefs(t)
+		iDefs, jDefs := iBmsFile.unionHeaderIndexedDefs(t), jBmsFile.unionHeaderIndexedDefs(t)
 		iDefStrs, jDefStrs := []string{}, []string{}
 		for _, def := range iDefs {
 			iDefStrs = append(iDefStrs, fmt.Sprintf("#%s %s", strings.ToUpper(def.command()), def.Value))
@@ -726,7 +860,7 @@ func CheckDefinitionDiff(bmsDirPath string, bmsFileI, bmsFileJ *BmsFile) (dds []
 					i++
 				}
 			}
-			dds = append(dds, definitionDiff{oType: t,
+			dds = append(dds, definitionDiff{oType: t, dirPath: bmsDirPath,
 				pathI: relativePathFromBmsRoot(bmsDirPath, iBmsFile.Path), pathJ: relativePathFromBmsRoot(bmsDirPath, jBmsFile.Path),
 				missingDefs: missingDefs})
 		}
@@ -738,6 +872,7 @@ func CheckDefinitionDiff(bmsDirPath string, bmsFileI, bmsFileJ *BmsFile) (dds []
 
 type objectDiff struct {
 	oType       objType
+	dirPath     string
 	pathI       string
 	pathJ       string
 	missingObjs []missingObj
@@ -750,11 +885,13 @@ type missingObj struct {
 
 func (od objectDiff) Log() Log {
 	log := Log{
-		Level:      Warning,
-		Message:    fmt.Sprintf("There are %d differences in %s objects: %s, %s", len(od.missingObjs), od.oType.string(), od.pathI, od.pathJ),
-		Message_ja: fmt.Sprintf("%sオブジェに%d個の違いがあります: %s %s", od.oType.string(), len(od.missingObjs), od.pathI, od.pathJ),
-		SubLogs:    []string{},
-		SubLogType: Detail,
+		Rule:         "dir.object-diff",
+		Level:        Warning,
+		Message:      fmt.Sprintf("There are %d differences in %s objects: %s, %s", len(od.missingObjs), od.oType.string(), od.pathI, od.pathJ),
+		Message_ja:   fmt.Sprintf("%sオブジェに%d個の違いがあります: %s %s", od.oType.string(), len(od.missingObjs), od.pathI, od.pathJ),
+		SubLogs:      []string{},
+		SubLogType:   Detail,
+		RelatedPaths: []string{filepath.Join(od.dirPath, od.pathI), filepath.Join(od.dirPath, od.pathJ)},
 	}
 	for _, mObj := range od.missingObjs {
 		log.SubLogs = append(log.SubLogs, fmt.Sprintf("Missing(%s): %s", mObj.path, mObj.value)) // TODO 日本語対応
@@ -768,7 +905,9 @@ func CheckObjectDiff(bmsDirPath string, bmsFileI, bmsFileJ *BmsFile) (ods []obje
 	}
 	diffObjs := func(t objType, iBmsFile, jBmsFile *BmsFile) {
 		missingObjs := []missingObj{}
-		iObjs, jObjs := iBmsFile.bmsObjs(t), jBmsFile.bmsObjs(t)
+		// 分岐がある場合は全ての分岐のオブジェを比べ、定義はそのオブジェを含む分岐から引く
+		iObjs, iOwners := iBmsFile.unionBmsObjs(t)
+		jObjs, jOwners := jBmsFile.unionBmsObjs(t)
 		ii, jj := 0, 0
 		for ii < len(iObjs) && jj < len(jObjs) {
 			iObj, jObj := iObjs[ii], jObjs[jj]
@@ -780,35 +919,36 @@ func CheckObjectDiff(bmsDirPath string, bmsFileI, bmsFileJ *BmsFile) (ods []obje
 				jj++
 				continue
 			}
-			if iObj.time() == jObj.time() && iObj.Value == jObj.Value {
+			cmp := iObj.compareTime(jObj)
+			if cmp == 0 && iObj.Value == jObj.Value {
 				ii++
 				jj++
-			} else if iObj.time() < jObj.time() || (iObj.time() == jObj.time() && iObj.Value < jObj.Value) {
-				if iBmsFile.definedValue(t, iObj.value36()) != "" {
-					missingObjs = append(missingObjs, missingObj{path: relativePathFromBmsRoot(bmsDirPath, jBmsFile.Path), value: iObj.string(iBmsFile)})
+			} else if cmp < 0 || (cmp == 0 && iObj.Value < jObj.Value) {
+				if iOwners[ii].definedValue(t, iObj.value36()) != "" {
+					missingObjs = append(missingObjs, missingObj{path: relativePathFromBmsRoot(bmsDirPath, jBmsFile.Path), value: iObj.string(iOwners[ii])})
 				}
 				ii++
 			} else {
-				if jBmsFile.definedValue(t, jObj.value36()) != "" {
-					missingObjs = append(missingObjs, missingObj{path: relativePathFromBmsRoot(bmsDirPath, iBmsFile.Path), value: jObj.string(jBmsFile)})
+				if jOwners[jj].definedValue(t, jObj.value36()) != "" {
+					missingObjs = append(missingObjs, missingObj{path: relativePathFromBmsRoot(bmsDirPath, iBmsFile.Path), value: jObj.string(jOwners[jj])})
 				}
 				jj++
 			}
 		}
 		for ; ii < len(iObjs); ii++ {
 			iObj := iObjs[ii]
-			if !iObj.IsLNEnd && iBmsFile.definedValue(t, iObj.value36()) != "" {
-				missingObjs = append(missingObjs, missingObj{path: relativePathFromBmsRoot(bmsDirPath, jBmsFile.Path), value: iObj.string(iBmsFile)})
+			if !iObj.IsLNEnd && iOwners[ii].definedValue(t, iObj.value36()) != "" {
+				missingObjs = append(missingObjs, missingObj{path: relativePathFromBmsRoot(bmsDirPath, jBmsFile.Path), value: iObj.string(iOwners[ii])})
 			}
 		}
 		for ; jj < len(jObjs); jj++ {
 			jObj := jObjs[jj]
-			if !jObj.IsLNEnd && jBmsFile.definedValue(t, jObj.value36()) != "" {
-				missingObjs = append(missingObjs, missingObj{path: relativePathFromBmsRoot(bmsDirPath, iBmsFile.Path), value: jObj.string(jBmsFile)})
+			if !jObj.IsLNEnd && jOwners[jj].definedValue(t, jObj.value36()) != "" {
+				missingObjs = append(missingObjs, missingObj{path: relativePathFromBmsRoot(bmsDirPath, iBmsFile.Path), value: jObj.string(jOwners[jj])})
 			}
 		}
 		if len(missingObjs) > 0 {
-			ods = append(ods, objectDiff{oType: t,
+			ods = append(ods, objectDiff{oType: t, dirPath: bmsDirPath,
 				pathI: relativePathFromBmsRoot(bmsDirPath, iBmsFile.Path), pathJ: relativePathFromBmsRoot(bmsDirPath, jBmsFile.Path),
 				missingObjs: missingObjs})
 		}
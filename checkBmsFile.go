@@ -11,51 +11,92 @@ import (
 	"sort"
 	"strconv"
 	"strings"
-
-	"golang.org/x/text/encoding/japanese"
-	"golang.org/x/text/transform"
+	"unicode"
 )
 
 type duplicateDefinition struct {
-	command  string
-	oldValue string
-	newValue string
+	command    string
+	oldValue   string
+	newValue   string
+	lineNumber int // 後から定義された行番号
 }
 
 func (dd duplicateDefinition) Log() Log {
 	return Log{
+		Rule:       "bms.definition-duplicate",
 		Level:      Warning,
 		Message:    fmt.Sprintf("#%s is duplicate: old= %s, new= %s", strings.ToUpper(dd.command), dd.oldValue, dd.newValue),
 		Message_ja: fmt.Sprintf("#%sが重複しています: old= %s, new= %s", strings.ToUpper(dd.command), dd.oldValue, dd.newValue),
+		Line:       dd.lineNumber,
 	}
 }
 
 type invalidLine struct {
-	lineNumber int
+	lineNumber int // 1始まり
 	line       string
 }
 
 func (il invalidLine) Log() Log {
 	return Log{
+		Rule:       "bms.invalid-line",
 		Level:      Error,
-		Message:    fmt.Sprintf("Invalid line(%d): %s", il.lineNumber, il.line),
-		Message_ja: fmt.Sprintf("この行は無効です(%d): %s", il.lineNumber, il.line),
+		Message:    fmt.Sprintf("Invalid line: %s", il.line),
+		Message_ja: fmt.Sprintf("この行は無効です: %s", il.line),
+		Line:       il.lineNumber,
 	}
 }
 
-type bmsFileCharsetIsUtf8 struct {
+type undecodableLine struct {
+	lineNumber int
+	encoding   Encoding
+	raw        []byte // デコード前の行
+}
+
+const MAX_UNDECODABLE_BYTES = 64
+
+func (ul undecodableLine) Log() Log {
+	hex := fmt.Sprintf("% X", ul.raw)
+	if len(ul.raw) > MAX_UNDECODABLE_BYTES {
+		hex = fmt.Sprintf("% X ...", ul.raw[:MAX_UNDECODABLE_BYTES])
+	}
+	return Log{
+		Rule:       "bms.line-undecodable",
+		Level:      Error,
+		Message:    fmt.Sprintf("Line cannot be decoded as %s: %s", ul.encoding, hex),
+		Message_ja: fmt.Sprintf("この行は%sとしてデコードできません: %s", ul.encoding, hex),
+		Line:       ul.lineNumber,
+	}
+}
+
+type bmsFileCharset struct {
+	encoding         Encoding
 	hasMultibyteRune bool
 }
 
-func (bu bmsFileCharsetIsUtf8) Log() Log {
-	if bu.hasMultibyteRune {
+func (bc bmsFileCharset) Log() Log {
+	if bc.encoding != UTF8 {
+		log := Log{
+			Rule:       "bms.charset-not-shift-jis",
+			Level:      Error,
+			Message:    fmt.Sprintf("Bmsfile charset is %s, not Shift-JIS. Players that display the header correctly: %s", bc.encoding, bc.encoding.players()),
+			Message_ja: fmt.Sprintf("BMSファイルの文字コードがShift-JISではなく%sです。ヘッダーを正しく表示できるプレイヤー: %s", bc.encoding, bc.encoding.players()),
+		}
+		if len(ENCODING_PLAYERS[bc.encoding]) == 0 {
+			log.Message = fmt.Sprintf("Bmsfile charset is %s, not Shift-JIS. No major player displays the header correctly", bc.encoding)
+			log.Message_ja = fmt.Sprintf("BMSファイルの文字コードがShift-JISではなく%sです。ヘッダーを正しく表示できる主なプレイヤーはありません", bc.encoding)
+		}
+		return log
+	}
+	if bc.hasMultibyteRune {
 		return Log{
+			Rule:       "bms.charset-utf8",
 			Level:      Error,
-			Message:    "Bmsfile charset is UTF-8, not Shift-JIS, and contains multibyte characters",
-			Message_ja: "BMSファイルの文字コードがShift-JISではなくUTF-8です。またマルチバイト文字を含んでいます",
+			Message:    "Bmsfile charset is UTF-8, not Shift-JIS, and contains multibyte characters. Players that display the header correctly: " + UTF8.players(),
+			Message_ja: "BMSファイルの文字コードがShift-JISではなくUTF-8です。またマルチバイト文字を含んでいます。ヘッダーを正しく表示できるプレイヤー: " + UTF8.players(),
 		}
 	} else {
 		return Log{
+			Rule:       "bms.charset-utf8",
 			Level:      Notice,
 			Message:    "Bmsfile charset is UTF-8, not Shift-JIS",
 			Message_ja: "BMSファイルの文字コードがShift-JISではなくUTF-8です",
@@ -63,14 +104,20 @@ func (bu bmsFileCharsetIsUtf8) Log() Log {
 	}
 }
 
+type bmsLine struct {
+	number int // 行番号(1始まり)
+	indent int // textの前で取り除いた空白のバイト数
+	text   string
+}
+
 func (bmsFile *BmsFile) ScanBmsFile() error {
 	if bmsFile.FullText == nil {
 		return fmt.Errorf("FullText is empty: %s", bmsFile.Path)
 	}
 
-	var dds []duplicateDefinition
-	var ils []invalidLine
-	var bu *bmsFileCharsetIsUtf8
+	// 文字コードはファイルごとに一度だけ判定する
+	bmsFile.Encoding = DetectEncoding(bmsFile.FullText)
+	decoder := bmsFile.Encoding.decoder()
 
 	const (
 		initialBufSize = 10000
@@ -80,30 +127,80 @@ func (bmsFile *BmsFile) ScanBmsFile() error {
 	buf := make([]byte, initialBufSize)
 	scanner.Buffer(buf, maxBufSize)
 
-	hasUtf8Bom := false
 	hasMultibyteRune := false
-	randomCommands := []string{"random", "if", "endif"}
+	lines := []bmsLine{}
+	uls := []undecodableLine{}
 	for lineNumber := 0; scanner.Scan(); lineNumber++ {
-		if lineNumber == 0 && bytes.HasPrefix(([]byte)(scanner.Text()), []byte{0xef, 0xbb, 0xbf}) {
-			hasUtf8Bom = true
-		}
-		if bytes.Equal(([]byte)(scanner.Text()), []byte{0xef, 0xbb, 0xbf}) {
-			// entrust isUTF8()
-			continue
+		text := scanner.Text()
+		if lineNumber == 0 {
+			text = strings.TrimPrefix(text, string(UTF8_BOM))
 		}
 
-		trimmedText := strings.TrimSpace(scanner.Text())
+		trimmedText := strings.TrimSpace(text)
 		if trimmedText == "" {
 			continue
 		}
-		line, _, err := transform.String(japanese.ShiftJIS.NewDecoder(), trimmedText)
+		// デコードできない行はログにして、デコードできた部分で読み込みを続ける
+		line, err := bmsFile.Encoding.decodeLine(decoder, trimmedText)
 		if err != nil {
-			return fmt.Errorf("Shift-JIS decode error: " + err.Error())
+			uls = append(uls, undecodableLine{lineNumber: lineNumber + 1, encoding: bmsFile.Encoding, raw: []byte(trimmedText)})
 		}
 		if !hasMultibyteRune && containsMultibyteRune(line) {
 			hasMultibyteRune = true
 		}
+		indent := len(text) - len(strings.TrimLeftFunc(text, unicode.IsSpace))
+		lines = append(lines, bmsLine{number: lineNumber + 1, indent: indent, text: line})
+	}
+	if scanner.Err() != nil {
+		return fmt.Errorf("BMSfile scan error: " + scanner.Err().Error())
+	}
+
+	dds, ils := bmsFile.scanBmsLines(lines)
+	bmsFile.setTotalNotesAndKeymode()
+
+	// #RANDOMなどの制御構文がある場合は、分岐の組み合わせごとにBMSを読み込む
+	// 重複定義は分岐ごとに判定する(#IFと#ELSEで同じ#WAVxxを定義するのは重複ではない)
+	if hasControlCommand(lines) {
+		bmsFile.scanBranches(lines)
+		branchLogs := []Logs{}
+		for _, branch := range bmsFile.Branches {
+			branchLogs = append(branchLogs, branch.Logs)
+		}
+		bmsFile.addBranchLogs(branchLogs)
+		dds = nil
+		// 分岐の外から読み込んだ値は全ての分岐を合わせたものになるので、ノーツ数とキーモードは最初の組み合わせのものにする
+		if len(bmsFile.Branches) > 0 {
+			bmsFile.TotalNotes, bmsFile.Keymode = bmsFile.Branches[0].TotalNotes, bmsFile.Branches[0].Keymode
+		}
+	}
+
+	for _, result := range dds {
+		bmsFile.Logs = append(bmsFile.Logs, result.Log())
+	}
+	for _, result := range ils {
+		bmsFile.Logs = append(bmsFile.Logs, result.Log())
+	}
+	bmsFile.Logs.addResultLogs(uls)
+	sps, iss := parseSuppressions(lines)
+	bmsFile.suppressions = sps
+	bmsFile.Logs.addResultLogs(iss)
+	bmsFile.Logs.addResultLogs(checkControlFlowStructure(lines))
+	bmsFile.Logs.addResultLogs(CheckBranchHeadersAreUnified(bmsFile))
+	if bmsFile.Encoding != ShiftJIS {
+		bmsFile.Logs = append(bmsFile.Logs, bmsFileCharset{encoding: bmsFile.Encoding, hasMultibyteRune: hasMultibyteRune}.Log())
+	}
+	bmsFile.Logs.setPath(bmsFile.Path)
+	/*bmsFile.Logs.addLogFromResult(dds)
+	bmsFile.Logs.addLogFromResult(ils)
+	bmsFile.Logs.addLogFromResult(bu)*/
+
+	return nil
+}
 
+// 行を読み込んでbmsFile.Bmsに格納する。制御構文の行は正しい行として読み飛ばす
+func (bmsFile *BmsFile) scanBmsLines(lines []bmsLine) (dds []duplicateDefinition, ils []invalidLine) {
+	for _, bmsLine := range lines {
+		line := bmsLine.text
 		if strings.HasPrefix(line, "*") || strings.HasPrefix(line, "%") { // skip comment/meta line
 			goto correctLine
 		}
@@ -118,10 +215,11 @@ func (bmsFile *BmsFile) ScanBmsFile() error {
 					}
 					val, ok := bmsFile.Header[command.Name]
 					if ok {
-						dds = append(dds, duplicateDefinition{command: command.Name, oldValue: val, newValue: data})
+						dds = append(dds, duplicateDefinition{command: command.Name, oldValue: val, newValue: data, lineNumber: bmsLine.number})
 					}
 					if !ok || (ok && data != "") { // 重複しても空文字だったら値を採用しない
 						bmsFile.Header[command.Name] = data
+						bmsFile.HeaderLines[command.Name] = bmsLine.number
 					}
 					goto correctLine
 				}
@@ -139,16 +237,17 @@ func (bmsFile *BmsFile) ScanBmsFile() error {
 						isDuplicate := false
 						for i := range *defs {
 							if (*defs)[i].equalCommand(lineCommand) {
-								dds = append(dds, duplicateDefinition{command: lineCommand, oldValue: (*defs)[i].Value, newValue: data})
+								dds = append(dds, duplicateDefinition{command: lineCommand, oldValue: (*defs)[i].Value, newValue: data, lineNumber: bmsLine.number})
 								if data != "" {
 									(*defs)[i].Value = data
+									(*defs)[i].Line = bmsLine.number
 								}
 								isDuplicate = true
 								break
 							}
 						}
 						if !isDuplicate {
-							*defs = append(*defs, indexedDefinition{CommandName: lineCommand[:len(lineCommand)-2], Index: lineCommand[len(lineCommand)-2:], Value: data})
+							*defs = append(*defs, indexedDefinition{CommandName: lineCommand[:len(lineCommand)-2], Index: lineCommand[len(lineCommand)-2:], Value: data, Line: bmsLine.number})
 						}
 					}
 					switch command.Name {
@@ -170,9 +269,11 @@ func (bmsFile *BmsFile) ScanBmsFile() error {
 				measure, _ := strconv.Atoi(line[1:4])
 				channel := strings.ToLower(line[4:6])
 				data := strings.TrimSpace(line[7:])
+				// オブジェの値の1文字目の列番号
+				dataColumn := bmsLine.indent + len(line) - len(strings.TrimLeftFunc(line[7:], unicode.IsSpace)) + 1
 				if channel == "02" {
 					if regexp.MustCompile(`^\d+(?:\.\d+)?$`).MatchString(data) {
-						bmsFile.BmsMeasureLengths = append(bmsFile.BmsMeasureLengths, measureLength{Measure: measure, LengthStr: data})
+						bmsFile.BmsMeasureLengths = append(bmsFile.BmsMeasureLengths, measureLength{Measure: measure, LengthStr: data, Line: bmsLine.number})
 						goto correctLine
 					}
 				} else {
@@ -201,7 +302,8 @@ func (bmsFile *BmsFile) ScanBmsFile() error {
 								continue
 							}
 							pos := fraction{i, len(data) / 2}
-							obj := bmsObj{ObjType: channelType, Channel: channel, Measure: measure, Position: pos, Value: int(val)}
+							obj := bmsObj{ObjType: channelType, Channel: channel, Measure: measure, Position: pos, Value: int(val),
+								Line: bmsLine.number, Column: dataColumn + i*2}
 							switch channelType {
 							case Wav:
 								bmsFile.BmsWavObjs = append(bmsFile.BmsWavObjs, obj)
@@ -223,37 +325,22 @@ func (bmsFile *BmsFile) ScanBmsFile() error {
 					}
 				}
 			}
-			for _, command := range randomCommands {
-				if strings.HasPrefix(strings.ToLower(line), "#"+command+" ") || strings.ToLower(line) == ("#"+command) {
-					// TODO: #IF対応
-					goto correctLine
-				}
+			if _, _, ok := parseControlCommand(line); ok {
+				goto correctLine
 			}
 		}
 
-		ils = append(ils, invalidLine{lineNumber: lineNumber, line: line})
+		ils = append(ils, invalidLine{lineNumber: bmsLine.number, line: line})
 
 	correctLine:
 	}
-	if scanner.Err() != nil {
-		return fmt.Errorf("BMSfile scan error: " + scanner.Err().Error())
-	}
+	return dds, ils
+}
 
+func (bmsFile *BmsFile) setTotalNotesAndKeymode() {
 	bmsFile.sortBmsObjs()
 	bmsFile.setIsLNEnd()
 
-	isUtf8 := hasUtf8Bom
-	if !isUtf8 {
-		var err error
-		isUtf8, err = isUTF8(bmsFile.FullText)
-		if err != nil {
-			isUtf8 = false
-		}
-	}
-	if isUtf8 {
-		bu = &bmsFileCharsetIsUtf8{hasMultibyteRune: hasMultibyteRune}
-	}
-
 	chmap := map[string]bool{"7k": false, "10k": false, "14k": false}
 	lnCount := 0
 	for _, obj := range bmsFile.BmsWavObjs {
@@ -298,21 +385,6 @@ func (bmsFile *BmsFile) ScanBmsFile() error {
 	} else {
 		bmsFile.Keymode = 5
 	}
-
-	for _, result := range dds {
-		bmsFile.Logs = append(bmsFile.Logs, result.Log())
-	}
-	for _, result := range ils {
-		bmsFile.Logs = append(bmsFile.Logs, result.Log())
-	}
-	if bu != nil {
-		bmsFile.Logs = append(bmsFile.Logs, bu.Log())
-	}
-	/*bmsFile.Logs.addLogFromResult(dds)
-	bmsFile.Logs.addLogFromResult(ils)
-	bmsFile.Logs.addLogFromResult(bu)*/
-
-	return nil
 }
 
 /*type missingDefinition struct {
@@ -337,9 +409,13 @@ func (md missingDefinition) Log() Log {
 // 1: 高すぎ
 func JudgeOverTotal(total float64, totalNotes, keymode int) int {
 	// TODO 適切な基準値は？
+	return JudgeOverTotalWithRate(total, totalNotes, keymode, DefaultConfig().Thresholds.TotalOverRate)
+}
+
+// 標準のTOTALのoverRate倍より高いか、1/overRate倍より低ければ過剰とする
+func JudgeOverTotalWithRate(total float64, totalNotes, keymode int, overRate float64) int {
 	defaultTotal := CalculateDefaultTotal(totalNotes, keymode)
 	totalPerNotes := total / float64(totalNotes)
-	overRate := 1.6
 	if total > defaultTotal*overRate && totalPerNotes > 0.35 {
 		return 1
 	} else if total < defaultTotal/overRate && totalPerNotes < 0.2 {
@@ -349,8 +425,10 @@ func JudgeOverTotal(total float64, totalNotes, keymode int) int {
 }
 
 func CheckHeaderCommands(bmsFile *BmsFile) (logs Logs) {
+	config := configOrDefault(bmsFile.Config)
 	for _, command := range COMMANDS {
 		val, ok := bmsFile.Header[command.Name]
+		line := bmsFile.HeaderLines[command.Name]
 		if !ok {
 			if command.Necessity != Unnecessary {
 				alertLevel := Error
@@ -358,6 +436,7 @@ func CheckHeaderCommands(bmsFile *BmsFile) (logs Logs) {
 					alertLevel = Warning
 				}
 				logs = append(logs, Log{
+					Rule:       "bms.header-missing",
 					Level:      alertLevel,
 					Message:    fmt.Sprintf("#%s definition is missing", strings.ToUpper(command.Name)),
 					Message_ja: fmt.Sprintf("#%s定義が見つかりません", strings.ToUpper(command.Name)),
@@ -365,80 +444,94 @@ func CheckHeaderCommands(bmsFile *BmsFile) (logs Logs) {
 			}
 		} else if val == "" {
 			logs = append(logs, Log{
+				Rule:       "bms.header-empty",
 				Level:      Warning,
 				Message:    fmt.Sprintf("#%s value is empty", strings.ToUpper(command.Name)),
 				Message_ja: fmt.Sprintf("#%sの値が空です", strings.ToUpper(command.Name)),
+				Line:       line,
 			})
 		} else if isInRange, err := command.isInRange(val); err != nil || !isInRange {
 			/*if err != nil {
 				fmt.Printf("DEBUG ERROR: isInRange return error(%s): command= %s, value= %s\n", err.Error(), command.Name, val)
 			}*/
 			logs = append(logs, Log{
+				Rule:       "bms.header-invalid",
 				Level:      Error,
 				Message:    fmt.Sprintf("#%s has invalid value: %s", strings.ToUpper(command.Name), val),
 				Message_ja: fmt.Sprintf("#%sが無効な値です: %s", strings.ToUpper(command.Name), val),
+				Line:       line,
 			})
 		} else if command.Name == "rank" { // TODO ここらへんはCommand型のCheck関数的なものに置き換えたい？
 			rank, _ := strconv.Atoi(val)
-			rankText := ""
-			if rank == 0 {
-				rankText = "0(VERY HARD)"
-			} else if rank == 1 {
-				rankText = "1(HARD)"
-			} else if rank == 4 {
-				rankText = "4(VERY EASY)"
+			rankText := strconv.Itoa(rank)
+			if rankName, ok := RANK_NAMES[rank]; ok {
+				rankText += "(" + rankName + ")"
 			}
-			if rankText != "" {
+			if level := config.Thresholds.RankLevels[strconv.Itoa(rank)]; level != "" {
 				logs = append(logs, Log{
-					Level:      Notice,
+					Rule:       "bms.rank-unusual",
+					Level:      level,
 					Message:    fmt.Sprintf("#RANK is %s", rankText),
 					Message_ja: fmt.Sprintf("#RANKが%sです", rankText),
+					Line:       line,
 				})
 			}
 		} else if command.Name == "total" {
 			total, _ := strconv.ParseFloat(val, 64)
 			if total < 100 {
 				logs = append(logs, Log{
+					Rule:       "bms.total-under-100",
 					Level:      Warning,
 					Message:    fmt.Sprintf("#TOTAL is under 100: %s", val),
 					Message_ja: fmt.Sprintf("#TOTALが100未満です: %s", val),
+					Line:       line,
 				})
 			} else if bmsFile.TotalNotes > 0 {
-				totalJudge := JudgeOverTotal(total, bmsFile.TotalNotes, bmsFile.Keymode)
+				totalJudge := JudgeOverTotalWithRate(total, bmsFile.TotalNotes, bmsFile.Keymode, config.Thresholds.TotalOverRate)
 				if totalJudge > 0 {
 					logs = append(logs, Log{
+						Rule:       "bms.total-too-high",
 						Level:      Notice,
 						Message:    fmt.Sprintf("#TOTAL is very high(TotalNotes=%d): %s", bmsFile.TotalNotes, val),
 						Message_ja: fmt.Sprintf("#TOTALがかなり高いです(トータルノーツ=%d): %s", bmsFile.TotalNotes, val),
+						Line:       line,
 					})
 				} else if totalJudge < 0 {
 					logs = append(logs, Log{
+						Rule:       "bms.total-too-low",
 						Level:      Notice,
 						Message:    fmt.Sprintf("#TOTAL is very low(TotalNotes=%d): %s", bmsFile.TotalNotes, val),
 						Message_ja: fmt.Sprintf("#TOTALがかなり低いです(トータルノーツ=%d): %s", bmsFile.TotalNotes, val),
+						Line:       line,
 					})
 				}
 			}
 		} else if command.Name == "difficulty" {
 			if val == "0" {
 				logs = append(logs, Log{
+					Rule:       "bms.difficulty-undefined",
 					Level:      Warning,
 					Message:    "#DIFFICULTY is 0(Undefined)",
 					Message_ja: "#DIFFICULTYが0(未定義)です",
+					Line:       line,
 				})
 			}
 		} else if command.Name == "defexrank" {
 			logs = append(logs, Log{
+				Rule:       "bms.defexrank-defined",
 				Level:      Notice,
 				Message:    "#DEFEXRANK is defined: " + val,
 				Message_ja: "#DEFEXRANKが定義されています: " + val,
+				Line:       line,
 			})
 		} else if command.Name == "lntype" {
 			if val == "2" {
 				logs = append(logs, Log{
+					Rule:       "bms.lntype-deprecated",
 					Level:      Warning,
 					Message:    "#LNTYPE 2(MGQ) is deprecated",
 					Message_ja: "#LNTYPE 2(MGQ)は非推奨です",
+					Line:       line,
 				})
 			}
 		}
@@ -447,14 +540,17 @@ func CheckHeaderCommands(bmsFile *BmsFile) (logs Logs) {
 }
 
 type titleAndSubtitleHaveSameText struct {
-	subtitle string
+	subtitle   string
+	lineNumber int
 }
 
 func (t titleAndSubtitleHaveSameText) Log() Log {
 	return Log{
+		Rule:       "bms.title-contains-subtitle",
 		Level:      Warning,
 		Message:    "The end of #TITLE contains the same string as #SUBTITLE: " + t.subtitle,
 		Message_ja: "#TITLEの末尾に#SUBTITLEと同じ文字列を含んでいます:" + t.subtitle,
+		Line:       t.lineNumber,
 	}
 }
 
@@ -463,7 +559,7 @@ func CheckTitleAndSubtitleHaveSameText(bmsFile *BmsFile) (ts *titleAndSubtitleHa
 	subtitle, ok2 := bmsFile.Header["subtitle"]
 	// TODO 括弧を取り外す＆括弧を付ける？
 	if ok1 && ok2 && subtitle != "" && strings.HasSuffix(strings.ToLower(title), strings.ToLower(subtitle)) {
-		ts = &titleAndSubtitleHaveSameText{subtitle: subtitle}
+		ts = &titleAndSubtitleHaveSameText{subtitle: subtitle, lineNumber: bmsFile.HeaderLines["subtitle"]}
 	}
 	return ts
 }
@@ -478,6 +574,7 @@ func (md missingIndexedDefinition) Log() Log {
 		alertLevel = Warning
 	}
 	return Log{
+		Rule:       "bms.indexed-definition-missing",
 		Level:      alertLevel,
 		Message:    fmt.Sprintf("#%sxx definition is missing", strings.ToUpper(md.command.Name)),
 		Message_ja: fmt.Sprintf("#%sxxの定義が見つかりません", strings.ToUpper(md.command.Name)),
@@ -490,9 +587,11 @@ type emptyDefinition struct {
 
 func (ed emptyDefinition) Log() Log {
 	return Log{
+		Rule:       "bms.indexed-definition-empty",
 		Level:      Warning,
 		Message:    fmt.Sprintf("#%s value is empty", strings.ToUpper(ed.definition.command())),
 		Message_ja: fmt.Sprintf("#%sの値が空です", strings.ToUpper(ed.definition.command())),
+		Line:       ed.definition.Line,
 	}
 }
 
@@ -502,9 +601,11 @@ type invalidValueOfIndexedCommand struct {
 
 func (iv invalidValueOfIndexedCommand) Log() Log {
 	return Log{
+		Rule:       "bms.indexed-definition-invalid",
 		Level:      Error,
 		Message:    fmt.Sprintf("#%s has invalid value: %s", strings.ToUpper(iv.definition.command()), iv.definition.Value),
 		Message_ja: fmt.Sprintf("#%sが無効な値です: %s", strings.ToUpper(iv.definition.command()), iv.definition.Value),
+		Line:       iv.definition.Line,
 	}
 }
 
@@ -514,11 +615,13 @@ type noWavExtDefs struct {
 
 func (nwd noWavExtDefs) Log() Log {
 	return Log{
+		Rule:  "bms.wav-non-wav-extension",
 		Level: Notice,
 		Message: fmt.Sprintf("#WAV definition has non-.wav extension(*%d): %s %s etc...",
 			len(nwd.noWavExtDefs), strings.ToUpper(nwd.noWavExtDefs[0].command()), nwd.noWavExtDefs[0].Value),
 		Message_ja: fmt.Sprintf("#WAVに拡張子.wavでない定義があります(*%d): %s %s etc...",
 			len(nwd.noWavExtDefs), strings.ToUpper(nwd.noWavExtDefs[0].command()), nwd.noWavExtDefs[0].Value),
+		Line: nwd.noWavExtDefs[0].Line,
 	} // TODO SubLogに表示する？必要なさそう
 }
 
@@ -554,6 +657,7 @@ type totalnotesIsZero struct{}
 
 func (tz totalnotesIsZero) Log() Log {
 	return Log{
+		Rule:       "bms.totalnotes-zero",
 		Level:      Error,
 		Message:    "TotalNotes is 0",
 		Message_ja: "トータルノーツ数が0です",
@@ -574,11 +678,15 @@ type wavObjsIn0thMeasure struct {
 
 func (wo wavObjsIn0thMeasure) Log() Log {
 	log := Log{
+		Rule:       "bms.note-in-0th-measure",
 		Level:      Warning,
 		Message:    "Note exists in 0th measure",
 		Message_ja: "0小節目にノーツが配置されています",
 		SubLogs:    []string{}, //[]SubLog{},
 		SubLogType: List,
+		Line:       wo.wavObjs[0].Line,
+		Column:     wo.wavObjs[0].Column,
+		Object:     wo.wavObjs[0].logObject(wo.bmsFile),
 	}
 	for _, wavObj := range wo.wavObjs {
 		//log.SubLogs = append(log.SubLogs, SubLog{Message: fmt.Sprintf("%s", wavObj.string(wo.bmsFile))})
@@ -623,11 +731,15 @@ func (puo *placedUndefinedObj) initObjValues() {
 
 func (puo placedUndefinedObj) Log() Log {
 	log := Log{
+		Rule:       "bms.object-undefined",
 		Level:      Warning,
 		Message:    fmt.Sprintf("Placed %s object is undefined", puo.oType.string()),
 		Message_ja: fmt.Sprintf("配置されている%sオブジェが未定義です", puo.oType.string()),
 		SubLogs:    []string{}, //[]SubLog{},
 		SubLogType: List,
+		Line:       puo.objs[0].Line,
+		Column:     puo.objs[0].Column,
+		Object:     puo.objs[0].logObject(nil),
 	}
 	/*if puo.objValues == nil {
 		puo.initObjValues()
@@ -646,11 +758,13 @@ type definedUnplacedObj struct {
 
 func (duo definedUnplacedObj) Log() Log {
 	log := Log{
+		Rule:       "bms.definition-unplaced",
 		Level:      Warning,
 		Message:    fmt.Sprintf("Defined %s object is not placed", duo.oType.string()),
 		Message_ja: fmt.Sprintf("定義されている%sオブジェが未配置です", duo.oType.string()),
 		SubLogs:    []string{}, //[]SubLog{},
 		SubLogType: List,
+		Line:       duo.defs[0].Line,
 	}
 	for _, def := range duo.defs {
 		//log.SubLogs = append(log.SubLogs, SubLog{Message: fmt.Sprintf("%s (%s)", strings.ToUpper(def.Index), def.Value)})
@@ -714,21 +828,24 @@ func CheckPlacedObjIsDefinedAndDefinedHeaderIsPlaced(bmsFile *BmsFile) (puos []p
 }
 
 type unusedMineSound struct {
-	value string
+	value      string
+	lineNumber int
 }
 
 func (um unusedMineSound) Log() Log {
 	return Log{
+		Rule:       "bms.mine-sound-unused",
 		Level:      Warning,
 		Message:    fmt.Sprintf("Defined mine explision wav(#WAV00) is not used: %s", um.value),
 		Message_ja: fmt.Sprintf("定義されている地雷爆発音(#WAV00)は使用されていません: %s", um.value),
+		Line:       um.lineNumber,
 	}
 }
 
 func CheckSoundOfMineExplosionIsUsed(bmsFile *BmsFile) *unusedMineSound {
 	for _, def := range bmsFile.HeaderWav {
 		if def.Index == "00" && len(bmsFile.BmsMineObjs) == 0 {
-			return &unusedMineSound{value: def.Value}
+			return &unusedMineSound{value: def.Value, lineNumber: def.Line}
 		}
 	}
 	return nil
@@ -748,10 +865,14 @@ func (dw duplicateWavs) Log() Log {
 		dw.measure, dw.position.Numerator, dw.position.Denominator, strings.ToUpper(dw.wav),
 		dw.bmsFile.definedValue(Wav, strings.ToUpper(dw.wav)), len(dw.objs))
 	log := Log{
+		Rule:       "bms.wav-duplicate",
 		Level:      Warning,
 		Message:    "Placed WAV objects are duplicate: " + str,
 		Message_ja: "WAVオブジェが重複して配置されています: " + str,
 		//SubLogs:    []string{}, //[]SubLog{},
+		Line:   dw.objs[len(dw.objs)-1].Line,
+		Column: dw.objs[len(dw.objs)-1].Column,
+		Object: dw.objs[len(dw.objs)-1].logObject(dw.bmsFile),
 	}
 	//for _, dupWav := range dw.objs {
 	/*log.SubLogs = append(log.SubLogs, SubLog{Message: fmt.Sprintf("#%03d (%d/%d) %s (%s) * %d",
@@ -799,7 +920,8 @@ func CheckWavDuplicate(bmsFile *BmsFile) (dupWavs []duplicateWavs) {
 }
 
 type overlapNotes struct {
-	objs []bmsObj
+	objs    []bmsObj
+	bmsFile *BmsFile
 }
 
 func (on overlapNotes) Log() Log {
@@ -811,9 +933,13 @@ func (on overlapNotes) Log() Log {
 	}
 	overlapStr := fmt.Sprintf("#%03d (%d/%d) %s", on.objs[0].Measure, fp.Numerator, fp.Denominator, objsStr)
 	return Log{
+		Rule:       "bms.note-overlap",
 		Level:      Error,
 		Message:    fmt.Sprintf("Placed notes overlap: %s", overlapStr),
 		Message_ja: fmt.Sprintf("配置されているノーツが重なり合っています: %s", overlapStr),
+		Line:       on.objs[len(on.objs)-1].Line,
+		Column:     on.objs[len(on.objs)-1].Column,
+		Object:     on.objs[len(on.objs)-1].logObject(on.bmsFile),
 	}
 }
 
@@ -825,7 +951,7 @@ func CheckNoteOverlap(bmsFile *BmsFile) (ons []overlapNotes) {
 		}
 	}
 	allNotes := append(notBgmWavObjs, bmsFile.BmsMineObjs...)
-	sort.Slice(allNotes, func(i, j int) bool { return allNotes[i].time() < allNotes[j].time() })
+	sort.Slice(allNotes, func(i, j int) bool { return allNotes[i].compareTime(allNotes[j]) < 0 })
 	boi := newBmsObjsIterator(allNotes) // TODO イテレータ内でソートすべき？
 	for momentObjs := boi.next(); len(momentObjs) > 0; momentObjs = boi.next() {
 		laneObjs := make([][]bmsObj, 20)
@@ -839,7 +965,7 @@ func CheckNoteOverlap(bmsFile *BmsFile) (ons []overlapNotes) {
 		}
 		for _, objs := range laneObjs {
 			if len(objs) > 1 {
-				ons = append(ons, overlapNotes{objs: objs})
+				ons = append(ons, overlapNotes{objs: objs, bmsFile: bmsFile})
 			}
 		}
 	}
@@ -859,9 +985,13 @@ func (nl noteInLN) Log() Log {
 		noteType_ja = "地雷"
 	}
 	return Log{
+		Rule:       "bms.note-in-ln",
 		Level:      Error,
 		Message:    fmt.Sprintf("%s note is in LN: %s in %s", noteType, nl.containedObj.string(nil), nl.lnStart.string(nil)),
 		Message_ja: fmt.Sprintf("%sノーツがLNの中に配置されています: %s in %s", noteType_ja, nl.containedObj.string(nil), nl.lnStart.string(nil)), // TODO inを日本語にする？
+		Line:       nl.containedObj.Line,
+		Column:     nl.containedObj.Column,
+		Object:     nl.containedObj.logObject(nil),
 	}
 }
 
@@ -872,9 +1002,13 @@ type endMissingLN struct {
 
 func (el endMissingLN) Log() Log {
 	return Log{
+		Rule:       "bms.ln-end-missing",
 		Level:      Error,
 		Message:    fmt.Sprintf("End of LN is missing: %s", el.lnStart.string(el.bmsFile)),
 		Message_ja: fmt.Sprintf("LNの終端がありません: %s", el.lnStart.string(el.bmsFile)),
+		Line:       el.lnStart.Line,
+		Column:     el.lnStart.Column,
+		Object:     el.lnStart.logObject(el.bmsFile),
 	}
 }
 
@@ -886,7 +1020,7 @@ func CheckEndOfLNExistsAndNotesInLN(bmsFile *BmsFile) (nls []noteInLN, els []end
 		}
 	}
 	nmObjs := append(noteObjs, bmsFile.BmsMineObjs...)
-	sort.Slice(nmObjs, func(i, j int) bool { return nmObjs[i].time() < nmObjs[j].time() })
+	sort.Slice(nmObjs, func(i, j int) bool { return nmObjs[i].compareTime(nmObjs[j]) < 0 })
 	boi := newBmsObjsIterator(nmObjs)
 	ongoingLNs := map[string]*bmsObj{}
 	// ノーツ内包ログをレーンごとに貯めておき、LN終端が見つかったらログを確定させる
@@ -939,7 +1073,7 @@ func CheckEndOfLNExistsAndNotesInLN(bmsFile *BmsFile) (nls []noteInLN, els []end
 			ongoingLNsSlice = append(ongoingLNsSlice, ln)
 		}
 	}
-	sort.Slice(ongoingLNsSlice, func(i, j int) bool { return ongoingLNsSlice[i].time() < ongoingLNsSlice[j].time() })
+	sort.Slice(ongoingLNsSlice, func(i, j int) bool { return ongoingLNsSlice[i].compareTime(*ongoingLNsSlice[j]) < 0 })
 	for _, lnStart := range ongoingLNsSlice {
 		els = append(els, endMissingLN{lnStart: lnStart, bmsFile: bmsFile})
 	}
@@ -954,9 +1088,13 @@ type invalidBpmObj struct {
 func (ib invalidBpmObj) Log() Log {
 	objStr := fmt.Sprintf("%s (#%03d (%d/%d))", strings.ToUpper(ib.obj.value36()), ib.obj.Measure, ib.obj.Position.Numerator, ib.obj.Position.Denominator)
 	return Log{
+		Rule:       "bms.bpm-object-invalid",
 		Level:      Error,
 		Message:    fmt.Sprintf("BPM object has invalid value: %s", objStr),
 		Message_ja: fmt.Sprintf("BPMオブジェの値が無効です: %s", objStr),
+		Line:       ib.obj.Line,
+		Column:     ib.obj.Column,
+		Object:     ib.obj.logObject(nil),
 	}
 }
 
@@ -976,9 +1114,11 @@ type invalidMeasureLength struct {
 
 func (im invalidMeasureLength) Log() Log {
 	return Log{
+		Rule:       "bms.measure-length-invalid",
 		Level:      Error,
 		Message:    fmt.Sprintf("#%03d measure length has invalid value: %s", im.mlen.Measure, im.mlen.LengthStr),
 		Message_ja: fmt.Sprintf("#%03d小節の小節長の値が無効です: %s", im.mlen.Measure, im.mlen.LengthStr),
+		Line:       im.mlen.Line,
 	}
 }
 
@@ -992,16 +1132,18 @@ func (dm duplicateMeasureLength) Log() Log {
 		lens += ", " + dm.mlens[j].LengthStr
 	}
 	return Log{
+		Rule:       "bms.measure-length-duplicate",
 		Level:      Warning,
 		Message:    fmt.Sprintf("#%03d measure length is duplicate: %s", dm.mlens[0].Measure, lens),
 		Message_ja: fmt.Sprintf("#%03d小節の小節長が重複しています: %s", dm.mlens[0].Measure, lens),
+		Line:       dm.mlens[len(dm.mlens)-1].Line,
 	}
 }
 
 func CheckMeasureLength(bmsFile *BmsFile) (ims []invalidMeasureLength, dms []duplicateMeasureLength) {
 	duplicateMlens := []measureLength{}
 	for i, mlen := range bmsFile.BmsMeasureLengths {
-		if mlen.length() <= 0 {
+		if mlen.rat().Sign() <= 0 {
 			ims = append(ims, invalidMeasureLength{mlen: &mlen})
 		}
 		duplicateMlens = append(duplicateMlens, mlen)
@@ -1022,6 +1164,10 @@ type withoutKeysoundMoments struct {
 }
 
 func (wm withoutKeysoundMoments) Log() Log {
+	return wm.log("bms.moment-without-keysound")
+}
+
+func (wm withoutKeysoundMoments) log(rule string) Log {
 	audioText := ""
 	audioText_ja := ""
 	if wm.wavFileIsExist {
@@ -1030,6 +1176,7 @@ func (wm withoutKeysoundMoments) Log() Log {
 	}
 	momentText := fmt.Sprintf("%.1f%%(%d/%d)", float64(wm.noWavMomentCount)/float64(wm.momentCount)*100, wm.noWavMomentCount, wm.momentCount)
 	return Log{
+		Rule:       rule,
 		Level:      Warning,
 		Message:    fmt.Sprintf("Moments without keysound%s exist: %s", audioText, momentText),
 		Message_ja: fmt.Sprintf("キー音%sの無い瞬間があります: %s", audioText_ja, momentText),
@@ -1053,6 +1200,7 @@ func (wn withoutKeysoundNotes) Log() Log {
 	notesText := fmt.Sprintf("%.1f%%(%d/%d)",
 		float64(len(wn.noWavObjs)+len(wn.noWavLnObjs)/2)/float64(wn.totalNotesCount)*100, len(wn.noWavObjs)+len(wn.noWavLnObjs)/2, wn.totalNotesCount)
 	return Log{
+		Rule:       "bms.note-without-keysound",
 		Level:      Notice,
 		Message:    fmt.Sprintf("Notes without keysound%s exist: %s", audioText, notesText),
 		Message_ja: fmt.Sprintf("キー音%sの無いノーツがあります: %s", audioText_ja, notesText),
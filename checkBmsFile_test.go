@@ -3,6 +3,7 @@ package checkbms
 import (
 	"fmt"
 	"math"
+	"math/big"
 	"reflect"
 	"strconv"
 	"strings"
@@ -10,7 +11,50 @@ import (
 )
 
 func TestScanBmsFile(t *testing.T) {
+	bmsFile := newTestBmsFile("test.bms",
+		"#TITLE test",
+		"",
+		"#WAV01 a.wav",
+		"  #00111: 0001",
+		"#00102:0.75",
+		"#WAV01 b.wav",
+		"invalid",
+	)
+	if err := bmsFile.ScanBmsFile(); err != nil {
+		t.Fatal(err)
+	}
 
+	if got := bmsFile.HeaderLines["title"]; got != 1 {
+		t.Errorf("title line: got = %d, want = 1", got)
+	}
+	if got := bmsFile.HeaderWav[0].Line; got != 6 {
+		t.Errorf("#WAV01 line: got = %d, want = 6", got)
+	}
+	if len(bmsFile.BmsWavObjs) != 1 {
+		t.Fatalf("wav objs: got = %d, want = 1", len(bmsFile.BmsWavObjs))
+	}
+	if obj := bmsFile.BmsWavObjs[0]; obj.Line != 4 || obj.Column != 13 {
+		t.Errorf("obj position: got = %d:%d, want = 4:13", obj.Line, obj.Column)
+	}
+	if got := bmsFile.BmsMeasureLengths[0].Line; got != 5 {
+		t.Errorf("measure length line: got = %d, want = 5", got)
+	}
+
+	wantLocations := map[string]string{
+		"#WAV01 is duplicate: old= a.wav, new= b.wav": "test.bms:6",
+		"Invalid line: invalid":                       "test.bms:7",
+	}
+	for _, log := range bmsFile.Logs {
+		if want, ok := wantLocations[log.Message]; ok {
+			if got := log.Location(); got != want {
+				t.Errorf("location of %s: got = %s, want = %s", log.Message, got, want)
+			}
+			delete(wantLocations, log.Message)
+		}
+	}
+	for message := range wantLocations {
+		t.Errorf("log is missing: %s", message)
+	}
 }
 
 func TestCheckHeaderCommands(t *testing.T) {
@@ -465,3 +509,35 @@ func TestCheckIndexedDefinitionsHaveInvalidValue(t *testing.T) {
 		})
 	}
 }
+
+func TestBmsObjsIteratorGroupsEqualPositions(t *testing.T) {
+	bmsFile := newTestBmsFile("test.bms",
+		"#WAV01 a.wav",
+		"#WAV02 b.wav",
+		"#00102:0.75",
+		"#00111:000100",
+		"#00111:000002000000",
+		"#00112:01",
+	)
+	if err := bmsFile.ScanBmsFile(); err != nil {
+		t.Fatal(err)
+	}
+	if ims, dms := CheckMeasureLength(bmsFile); ims != nil || dms != nil {
+		t.Errorf("CheckMeasureLength: got = %v, %v\nwant = nil, nil", ims, dms)
+	}
+	if got := bmsFile.BmsMeasureLengths[0].rat(); got.Cmp(big.NewRat(3, 4)) != 0 {
+		t.Errorf("measure length: got = %v, want = 3/4", got)
+	}
+
+	// 1/3と2/6は同じ時間
+	boi := newBmsObjsIterator(bmsFile.BmsWavObjs)
+	if got := len(boi.next()); got != 1 {
+		t.Errorf("first moment: got = %d objs, want = 1", got)
+	}
+	if got := len(boi.next()); got != 2 {
+		t.Errorf("second moment: got = %d objs, want = 2", got)
+	}
+	if ons := CheckNoteOverlap(bmsFile); len(ons) != 1 {
+		t.Errorf("CheckNoteOverlap: got = %v, want 1 overlap", ons)
+	}
+}
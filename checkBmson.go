@@ -20,7 +20,9 @@ func (bmsonFile *BmsonFile) ScanBmsonFile() error {
 		return fmt.Errorf("FullText is empty: %s", bmsonFile.Path)
 	}
 
+	bmsonFile.Encoding = UTF8
 	bmsonData, logs, err := ScanBmson(bmsonFile.FullText)
+	logs.setPath(bmsonFile.Path)
 	bmsonFile.Logs = logs
 	if err != nil {
 		bmsonFile.IsInvalid = true
@@ -81,6 +83,7 @@ func (i invalidField) Log() Log {
 		val = fmt.Sprintf("\"%s\"", str)
 	}
 	return Log{
+		Rule:       "bmson.field-invalid",
 		Level:      Warning,
 		Message:    fmt.Sprintf("Invalid field name: {\"%s\":%v} in %s", i.fieldName, val, i.locationName),
 		Message_ja: fmt.Sprintf("無効なフィールド名です: {\"%s\":%v} in %s", i.fieldName, val, i.locationName),
@@ -103,6 +106,7 @@ type invalidType struct {
 func (i invalidType) Log() Log {
 	fieldName := removeRootFromFieldName(i.fieldName)
 	return Log{
+		Rule:       "bmson.type-invalid",
 		Level:      Error,
 		Message:    fmt.Sprintf("%s has invalid value (type error): %v", fieldName, i.value),
 		Message_ja: fmt.Sprintf("%sが無効な値です (型エラー): %v", fieldName, i.value),
@@ -117,6 +121,7 @@ type duplicateField struct {
 func (d duplicateField) Log() Log {
 	fieldName := removeRootFromFieldName(d.fieldName)
 	log := Log{
+		Rule:       "bmson.field-duplicate",
 		Level:      Warning,
 		Message:    fmt.Sprintf("Duplicate field: %s * %d", fieldName, len(d.values)),
 		Message_ja: fmt.Sprintf("フィールドが重複しています: %s * %d", fieldName, len(d.values)),
@@ -341,6 +346,7 @@ type nilValue struct {
 func (v nilValue) Log() Log {
 	fieldName := removeRootFromFieldName(v.fieldName)
 	log := Log{
+		Rule:       "bmson.value-missing",
 		Level:      v.level,
 		Message:    fmt.Sprintf("%s has no value", fieldName),
 		Message_ja: fmt.Sprintf("%sに値がありません", fieldName),
@@ -360,6 +366,7 @@ type emptyValue struct {
 func (v emptyValue) Log() Log {
 	fieldName := removeRootFromFieldName(v.fieldName)
 	log := Log{
+		Rule:       "bmson.value-empty",
 		Level:      v.level,
 		Message:    fmt.Sprintf("%s value is empty", fieldName),
 		Message_ja: fmt.Sprintf("%sの値が空です", fieldName),
@@ -379,6 +386,7 @@ type outOfRangeValue struct {
 func (v outOfRangeValue) Log() Log {
 	fieldName := removeRootFromFieldName(v.fieldName)
 	return Log{
+		Rule:       "bmson.value-out-of-range",
 		Level:      Error,
 		Message:    fmt.Sprintf("%s has invalid value (out of range): %v", fieldName, v.value),
 		Message_ja: fmt.Sprintf("%sが無効な値です (定義範囲外): %v", fieldName, v.value),
@@ -619,6 +627,7 @@ var structRules = map[string]structRule{
 func ScanBmson(bytes []byte) (bmsonData *bmson.Bmson, logs Logs, _ error) {
 	invalidBmsonFormatLog := func(err error) {
 		logs = append(logs, Log{
+			Rule:       "bmson.format-invalid",
 			Level:      Error,
 			Message:    fmt.Sprintf("Invalid bmson format: %s", err.Error()),
 			Message_ja: fmt.Sprintf("bmsonのフォーマットが無効です: %s", err.Error()),
@@ -654,6 +663,18 @@ func CheckBmsonFile(bmsonFile *BmsonFile) {
 		return
 	}
 
+	config := configOrDefault(bmsonFile.Config)
+	if logs, ok := bmsonFile.Cache.chartLogs(&bmsonFile.BmsFileBase, config); ok {
+		bmsonFile.Logs = logs
+	} else {
+		checkBmsonFile(bmsonFile)
+		bmsonFile.Cache.storeChartLogs(&bmsonFile.BmsFileBase, config)
+	}
+	bmsonFile.Logs = config.apply(bmsonFile.Logs)
+	bmsonFile.Logs.setPath(bmsonFile.Path)
+}
+
+func checkBmsonFile(bmsonFile *BmsonFile) {
 	bmsonFile.Logs.addResultLogs(CheckBmsonInfo(bmsonFile))
 	bmsonFile.Logs.addResultLogs(CheckTitleTextsAreDuplicate(bmsonFile))
 	//bmsonFile.Logs.addResultLogs(CheckSoundChannelNameIsInvalid(bmsonFile))
@@ -683,12 +704,14 @@ func CheckBmsonInfo(bmsonFile *BmsonFile) (logs Logs) {
 			judgeRank := fv.Float()
 			if judgeRank >= 125 {
 				logs = append(logs, Log{
+					Rule:       "bmson.judge-rank-too-high",
 					Level:      Notice,
 					Message:    fmt.Sprintf("info.judge_rank is very high: %s", formatFloat(judgeRank)),
 					Message_ja: fmt.Sprintf("info.judge_rankがかなり高いです: %s", formatFloat(judgeRank)),
 				})
 			} else if judgeRank <= 50 {
 				logs = append(logs, Log{
+					Rule:       "bmson.judge-rank-too-low",
 					Level:      Notice,
 					Message:    fmt.Sprintf("info.judge_rank is very low: %s", formatFloat(judgeRank)),
 					Message_ja: fmt.Sprintf("info.judge_rankがかなり低いです: %s", formatFloat(judgeRank)),
@@ -699,20 +722,23 @@ func CheckBmsonInfo(bmsonFile *BmsonFile) (logs Logs) {
 			total := CalculateDefaultTotal(bmsonFile.TotalNotes, bmsonFile.Keymode) * bmsonTotal / 100
 			if total < 100 {
 				logs = append(logs, Log{
+					Rule:       "bmson.total-under-100",
 					Level:      Warning,
 					Message:    fmt.Sprintf("Real total value is under 100: Defined:%s Real:%.2f", formatFloat(bmsonTotal), total),
 					Message_ja: fmt.Sprintf("実際のTotal値が100未満です: 定義:%s 実際:%.2f ", formatFloat(bmsonTotal), total),
 				})
 			} else if bmsonFile.TotalNotes > 0 {
-				totalJudge := JudgeOverTotal(total, bmsonFile.TotalNotes, bmsonFile.Keymode)
+				totalJudge := JudgeOverTotalWithRate(total, bmsonFile.TotalNotes, bmsonFile.Keymode, configOrDefault(bmsonFile.Config).Thresholds.TotalOverRate)
 				if totalJudge > 0 {
 					logs = append(logs, Log{
+						Rule:       "bmson.total-too-high",
 						Level:      Notice,
 						Message:    fmt.Sprintf("info.total is very high(TotalNotes=%d): Defined:%s Real:%.2f", bmsonFile.TotalNotes, formatFloat(bmsonTotal), total),
 						Message_ja: fmt.Sprintf("info.totalがかなり高いです(トータルノーツ=%d): 定義:%s 実際:%.2f", bmsonFile.TotalNotes, formatFloat(bmsonTotal), total),
 					})
 				} else if totalJudge < 0 {
 					logs = append(logs, Log{
+						Rule:       "bmson.total-too-low",
 						Level:      Notice,
 						Message:    fmt.Sprintf("info.total is very low(TotalNotes=%d): Defined:%s Real:%.2f", bmsonFile.TotalNotes, formatFloat(bmsonTotal), total),
 						Message_ja: fmt.Sprintf("info.totalがかなり低いです(トータルノーツ=%d): 定義:%s 実際:%.2f", bmsonFile.TotalNotes, formatFloat(bmsonTotal), total),
@@ -737,6 +763,7 @@ type titleTextsAreDuplicate struct {
 
 func (t titleTextsAreDuplicate) Log() Log {
 	return Log{
+		Rule:       "bmson.title-texts-duplicate",
 		Level:      Warning,
 		Message:    fmt.Sprintf("info.%s and info.%s contain the same string: %s, %s", t.fieldName1, t.fieldName2, t.title1, t.title2),
 		Message_ja: fmt.Sprintf("info.%sとinfo.%sが同じ文字列を含んでいます: %s, %s", t.fieldName1, t.fieldName2, t.title1, t.title2),
@@ -769,6 +796,7 @@ type invalidSoundChannelName struct {
 
 func (i invalidSoundChannelName) Log() Log {
 	return Log{
+		Rule:       "bmson.sound-channel-name-invalid",
 		Level:      Warning,
 		Message:    fmt.Sprintf("sound_channels[%d].name is invalid value: %s", i.index, i.name),
 		Message_ja: fmt.Sprintf("sound_channels[%d].nameが無効な値です: %s", i.index, i.name),
@@ -791,6 +819,7 @@ type nonNotesSoundChannel struct {
 
 func (n nonNotesSoundChannel) Log() Log {
 	return Log{
+		Rule:       "bmson.sound-channel-no-notes",
 		Level:      Warning,
 		Message:    fmt.Sprintf("sound_channels[%d].notes is empty: name:%s", n.index, n.name),
 		Message_ja: fmt.Sprintf("sound_channels[%d].notesが空です: name:%s", n.index, n.name),
@@ -812,6 +841,7 @@ type noWavSoundChannels struct {
 
 func (nw noWavSoundChannels) Log() Log {
 	return Log{
+		Rule:  "bmson.sound-channel-non-wav-extension",
 		Level: Notice,
 		Message: fmt.Sprintf("sound_channels has filenames non-.wav extension(*%d): %s etc...",
 			len(nw.noWavSoundChannels), nw.noWavSoundChannels[0].Name),
@@ -840,6 +870,7 @@ type placedUndefinedBgaIds struct {
 
 func (b placedUndefinedBgaIds) Log() Log {
 	log := Log{
+		Rule:       "bmson.bga-id-undefined",
 		Level:      Warning,
 		Message:    fmt.Sprintf("Placed %s.id is undefined", b.eventName),
 		Message_ja: fmt.Sprintf("配置されている%s.idが未定義です", b.eventName),
@@ -891,6 +922,7 @@ type definedUnplacedBgaHeader struct {
 
 func (b definedUnplacedBgaHeader) Log() Log {
 	log := Log{
+		Rule:       "bmson.bga-header-unplaced",
 		Level:      Warning,
 		Message:    "Defined bga_header is not placed",
 		Message_ja: "定義されているbga_headerが未配置です",
@@ -940,6 +972,7 @@ type duplicateBgaHeaderId struct {
 
 func (d duplicateBgaHeaderId) Log() Log {
 	log := Log{
+		Rule:       "bmson.bga-header-id-duplicate",
 		Level:      Warning,
 		Message:    fmt.Sprintf("bga_header has duplicate id: %d * %d", d.id, len(d.indexedHeaders)),
 		Message_ja: fmt.Sprintf("bga_headerでidが重複しています: %d * %d", d.id, len(d.indexedHeaders)),
@@ -985,6 +1018,7 @@ type yDuplicate struct {
 
 func (d yDuplicate) Log() Log {
 	log := Log{
+		Rule:       "bmson.y-duplicate",
 		Level:      Warning,
 		Message:    fmt.Sprintf("%s has duplicate y values: %d * %d", d.fieldName, d.yValue, len(d.yObjects)),
 		Message_ja: fmt.Sprintf("%sでy値が重複しています: %d * %d", d.fieldName, d.yValue, len(d.yObjects)),
@@ -1109,6 +1143,7 @@ type soundNotesIn0thMeasure struct {
 
 func (sn soundNotesIn0thMeasure) Log() Log {
 	log := Log{
+		Rule:       "bmson.note-in-0th-measure",
 		Level:      Warning,
 		Message:    "Note exists in 0th measure",
 		Message_ja: "0小節目にノーツが配置されています",
@@ -1152,6 +1187,7 @@ type firstNoteHasContinueFlag struct {
 func (f firstNoteHasContinueFlag) Log() Log {
 	chStr := fmt.Sprintf("sound_channels[%d](%s)", f.index, f.soundChannel.Name)
 	return Log{
+		Rule:       "bmson.first-note-continue",
 		Level:      Warning,
 		Message:    fmt.Sprintf("First note of sound channel(%s[0]) has c:true", chStr),
 		Message_ja: fmt.Sprintf("サウンドチャンネルの最初のノーツ(%s[0])がc:trueになっています", chStr),
@@ -1177,6 +1213,7 @@ type outOfLaneNotes struct {
 
 func (n outOfLaneNotes) Log() Log {
 	log := Log{
+		Rule:       "bmson.note-out-of-lane",
 		Level:      Warning,
 		Message:    "note.x is out of lane range",
 		Message_ja: "ノーツのx位置がレーンの範囲外です",
@@ -1240,6 +1277,7 @@ func (n noteInLNBmson) Log() Log {
 		noteType_ja = "ロング"
 	}
 	return Log{
+		Rule:       "bmson.note-in-ln",
 		Level:      Error,
 		Message:    fmt.Sprintf("%s note is in LN: %s in %s", noteType, n.containedNote.string(), n.ln.string()),
 		Message_ja: fmt.Sprintf("%sノーツがLNの中に配置されています: %s in %s", noteType_ja, n.containedNote.string(), n.ln.string()),
@@ -1290,6 +1328,10 @@ type withoutKeysoundMomentsBmson struct {
 	withoutKeysoundMoments
 }
 
+func (wm withoutKeysoundMomentsBmson) Log() Log {
+	return wm.log("bmson.moment-without-keysound")
+}
+
 type withoutKeysoundNotesBmson struct {
 	wavFileIsExist  bool
 	noWavNotes      []soundNote
@@ -1306,6 +1348,7 @@ func (wn withoutKeysoundNotesBmson) Log() Log {
 	notesText := fmt.Sprintf("%.1f%%(%d/%d)",
 		float64(len(wn.noWavNotes))/float64(wn.totalNotesCount)*100, len(wn.noWavNotes), wn.totalNotesCount)
 	return Log{
+		Rule:       "bmson.note-without-keysound",
 		Level:      Notice,
 		Message:    fmt.Sprintf("Notes without keysound%s exist: %s", audioText, notesText),
 		Message_ja: fmt.Sprintf("キー音%sの無いノーツがあります: %s", audioText_ja, notesText),
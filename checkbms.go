@@ -2,8 +2,10 @@ package checkbms
 
 import (
 	"crypto/sha256"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"math"
 	"math/big"
 	"os"
@@ -16,7 +18,6 @@ import (
 	"unicode/utf8"
 
 	"github.com/Shimi9999/checkbms/bmson"
-	"github.com/saintfish/chardet"
 )
 
 type File struct {
@@ -33,6 +34,35 @@ type Directory struct {
 	NonBmsFiles []NonBmsFile
 	Directories []Directory
 	Logs        Logs
+	Config      *Config     // nilならデフォルトの設定。BMSファイルのConfigがnilならこれが使われる
+	ScanErrors  []ScanError // 読み込めなかったファイルやフォルダ。読み込めたものだけでチェックする
+	Cache       *Cache      // nilならキャッシュしない。BMSファイルのCacheがnilならこれが使われる
+
+	garbledZipNames []garbledZipName // zipから読み込んだ場合の、展開すると文字化けする名前
+	fsys            fs.FS            // 音声ファイルなどを読むfs.FS。nilならPathから開く
+	fsysName        string           // fsysの中でのこのフォルダの名前
+	zip             *zipArchive      // fsysがパスから開いたzipなら、Closeで閉じるそのzip
+}
+
+// 読み込めなかったファイルやフォルダ
+type ScanError struct {
+	Path string
+	Err  error
+}
+
+func (se ScanError) Error() string {
+	return se.Path + ": " + se.Err.Error()
+}
+
+// ScanDirectoryで読み込めなかったフォルダの一覧
+type ScanErrors []ScanError
+
+func (ses ScanErrors) Error() string {
+	strs := []string{}
+	for _, se := range ses {
+		strs = append(strs, se.Error())
+	}
+	return fmt.Sprintf("%d directories cannot be read: %s", len(ses), strings.Join(strs, ", "))
 }
 
 func newDirectory(path string) *Directory {
@@ -67,6 +97,7 @@ type indexedDefinition struct {
 	CommandName string
 	Index       string
 	Value       string
+	Line        int // 定義されている行番号
 }
 
 func (id indexedDefinition) command() string {
@@ -116,10 +147,14 @@ type BmsFileBase struct {
 	Keymode    int // 5, 7, 9, 10, 14, 24, 48
 	TotalNotes int
 	Logs       Logs
+	Config     *Config  // nilならデフォルトの設定
+	Encoding   Encoding // 検出した文字コード。bmsonはUTF-8
+	Cache      *Cache   // nilならキャッシュしない
 }
 
 type Bms struct {
 	Header             map[string]string
+	HeaderLines        map[string]int // Headerの値が定義されている行番号
 	HeaderWav          []indexedDefinition
 	HeaderBmp          []indexedDefinition
 	HeaderExtendedBpm  []indexedDefinition
@@ -138,12 +173,17 @@ type Bms struct {
 type BmsFile struct {
 	BmsFileBase
 	Bms
+	Branches           []BmsFile // #RANDOMなどの分岐の組み合わせごとのBMS。制御構文が無ければnil
+	BranchName         string    // 分岐の組み合わせ名 (Branchesの要素のみ)
+	BranchesAreSampled bool      // 組み合わせが多すぎるため、Branchesが一部を抽出したものになっているか
+	suppressions       []suppression
 }
 
 func NewBmsFile(bmsFileBase *BmsFileBase) *BmsFile {
 	var bf BmsFile
 	bf.BmsFileBase = *bmsFileBase
 	bf.Header = make(map[string]string)
+	bf.HeaderLines = make(map[string]int)
 	return &bf
 }
 func (bf BmsFile) headerIndexedDefs(t objType) []indexedDefinition {
@@ -191,7 +231,7 @@ func (bf BmsFile) definedValue(t objType, index string) string {
 func (bf *BmsFile) sortBmsObjs() {
 	sortObjs := func(objs []bmsObj) {
 		sort.Slice(objs, func(i, j int) bool { return objs[i].Value < objs[j].Value })
-		sort.SliceStable(objs, func(i, j int) bool { return objs[i].time() < objs[j].time() })
+		sort.SliceStable(objs, func(i, j int) bool { return objs[i].compareTime(objs[j]) < 0 })
 	}
 	sortObjs(bf.BmsWavObjs)
 	sortObjs(bf.BmsBmpObjs)
@@ -312,6 +352,14 @@ func (f fraction) value() float64 {
 	}
 	return float64(f.Numerator) / float64(f.Denominator)
 }
+
+// 誤差の無い値。1/3と2/6は等しくなる
+func (f fraction) rat() *big.Rat {
+	if f.Denominator == 0 {
+		return big.NewRat(-1, 1)
+	}
+	return big.NewRat(int64(f.Numerator), int64(f.Denominator))
+}
 func (f *fraction) reduce() {
 	bigNme := big.NewInt(int64(f.Numerator))
 	bigDnm := big.NewInt(int64(f.Denominator))
@@ -331,10 +379,18 @@ type bmsObj struct {
 	Position fraction
 	Value    int // 36進数→10進数
 	IsLNEnd  bool
+	Line     int // 配置されている行番号
+	Column   int // 配置されている列番号(オブジェの値の1文字目)
+}
+
+// 小節番号と小節内の位置を合わせた、誤差の無い時間
+func (bo bmsObj) time() *big.Rat {
+	return new(big.Rat).Add(big.NewRat(int64(bo.Measure), 1), bo.Position.rat())
 }
 
-func (bo bmsObj) time() float64 {
-	return float64(bo.Measure) + bo.Position.value()
+// boがotherより前なら負、同時なら0、後なら正
+func (bo bmsObj) compareTime(other bmsObj) int {
+	return bo.time().Cmp(other.time())
 }
 func (bo bmsObj) value36() string {
 	val := strconv.FormatInt(int64(bo.Value), 36)
@@ -343,6 +399,21 @@ func (bo bmsObj) value36() string {
 	}
 	return val
 }
+
+// bmsFileがnilでなければ、定義の値も含める
+func (bo bmsObj) logObject(bmsFile *BmsFile) *LogObject {
+	lo := LogObject{
+		Channel:     strings.ToUpper(bo.Channel),
+		Measure:     bo.Measure,
+		Numerator:   bo.Position.Numerator,
+		Denominator: bo.Position.Denominator,
+		Value:       strings.ToUpper(bo.value36()),
+	}
+	if bmsFile != nil {
+		lo.Definition = bmsFile.definedValue(bo.ObjType, bo.value36())
+	}
+	return &lo
+}
 func (bo bmsObj) string(bmsFile *BmsFile) string {
 	val := bo.value36()
 	definedValue := ""
@@ -356,17 +427,28 @@ func (bo bmsObj) string(bmsFile *BmsFile) string {
 type measureLength struct {
 	Measure   int
 	LengthStr string
+	Line      int
+}
+
+// 誤差の無い小節長。0.75は3/4になる。数値でなければ0
+func (ml measureLength) rat() *big.Rat {
+	length, ok := new(big.Rat).SetString(ml.LengthStr)
+	if !ok {
+		return new(big.Rat)
+	}
+	return length
 }
 
 func (ml measureLength) length() float64 {
-	length, _ := strconv.ParseFloat(ml.LengthStr, 64)
+	length, _ := ml.rat().Float64()
 	return length
 }
 
+// 同じ時間のオブジェをまとめて返す。bmsObjsは時間順にソートされている必要がある
 type bmsObjsIterator struct {
 	bmsObjs []bmsObj
 	index   int
-	time    float64
+	time    *big.Rat
 }
 
 func newBmsObjsIterator(bmsObjs []bmsObj) *bmsObjsIterator {
@@ -380,7 +462,7 @@ func newBmsObjsIterator(bmsObjs []bmsObj) *bmsObjsIterator {
 func (boi *bmsObjsIterator) next() (momentObjs []bmsObj) {
 	momentObjs = []bmsObj{}
 	for ; boi.index < len(boi.bmsObjs); boi.index++ {
-		if boi.time == boi.bmsObjs[boi.index].time() {
+		if boi.time.Cmp(boi.bmsObjs[boi.index].time()) == 0 {
 			momentObjs = append(momentObjs, boi.bmsObjs[boi.index])
 		} else {
 			boi.time = boi.bmsObjs[boi.index].time()
@@ -413,6 +495,33 @@ func (al AlertLevel) String_ja() string {
 	return ""
 }
 
+// 重要度。大きいほど重要
+func (al AlertLevel) severity() int {
+	switch al {
+	case Error:
+		return 3
+	case Warning:
+		return 2
+	case Notice:
+		return 1
+	}
+	return 0
+}
+
+// alがlevel以上の重要度か
+func (al AlertLevel) IsAtLeast(level AlertLevel) bool {
+	return al.severity() >= level.severity()
+}
+
+// error, warning, noticeなどの文字列(大文字小文字は区別しない)をAlertLevelにする
+func ParseAlertLevel(str string) (AlertLevel, error) {
+	level := AlertLevel(strings.ToUpper(str))
+	if level.severity() == 0 {
+		return "", fmt.Errorf("invalid alert level: %s", str)
+	}
+	return level, nil
+}
+
 type SubLogType int
 
 const (
@@ -420,12 +529,60 @@ const (
 	Detail
 )
 
+func (t SubLogType) MarshalText() ([]byte, error) {
+	if t == Detail {
+		return []byte("detail"), nil
+	}
+	return []byte("list"), nil
+}
+
+func (t *SubLogType) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "list":
+		*t = List
+	case "detail":
+		*t = Detail
+	default:
+		return fmt.Errorf("Invalid SubLogType: %s", text)
+	}
+	return nil
+}
+
 type Log struct {
-	Level      AlertLevel
-	Message    string
-	Message_ja string
-	SubLogs    []string
-	SubLogType SubLogType
+	Rule         string     `json:"rule"` // ルールID(bms.note-overlapなど)。RULESを参照
+	Level        AlertLevel `json:"level"`
+	Message      string     `json:"message"`
+	Message_ja   string     `json:"message_ja"`
+	SubLogs      []string   `json:"subLogs,omitempty"`
+	SubLogType   SubLogType `json:"subLogType"`
+	Branch       string     `json:"branch,omitempty"`       // #RANDOMの分岐の組み合わせ名。全ての分岐で共通のログなら空
+	Path         string     `json:"path,omitempty"`         // ログの原因となったファイルのパス
+	Line         int        `json:"line,omitempty"`         // ログの原因となった行番号(1始まり)。不明なら0
+	Column       int        `json:"column,omitempty"`       // ログの原因となった列番号(1始まり)。不明なら0
+	Object       *LogObject `json:"object,omitempty"`       // ログの原因となったオブジェ。無ければnil
+	RelatedPaths []string   `json:"relatedPaths,omitempty"` // ログに関係する他のファイルのパス
+}
+
+// ログの原因となったオブジェの情報
+type LogObject struct {
+	Channel     string `json:"channel"`
+	Measure     int    `json:"measure"`
+	Numerator   int    `json:"numerator"` // 小節内の位置 Numerator/Denominator
+	Denominator int    `json:"denominator"`
+	Value       string `json:"value"`                // オブジェの値(36進数、大文字)
+	Definition  string `json:"definition,omitempty"` // オブジェの値に対応する定義の値(#WAVxxのファイル名など)
+}
+
+// "path:line:column"形式の位置を返す。行番号が不明ならpathのみ
+func (log Log) Location() string {
+	location := log.Path
+	if log.Line > 0 {
+		location += fmt.Sprintf(":%d", log.Line)
+		if log.Column > 0 {
+			location += fmt.Sprintf(":%d", log.Column)
+		}
+	}
+	return location
 }
 
 func (log Log) String() string {
@@ -439,6 +596,9 @@ func (log Log) StringWithLang(lang string) (str string) {
 		message = log.Message_ja
 		level = log.Level.String_ja()
 	}
+	if log.Branch != "" {
+		level += " (" + log.Branch + ")"
+	}
 	if len(log.SubLogs) > 0 {
 		// ListならログにSubLogをくっつけて複製、Detailならログの次にSubLogを補足ログとして追加
 		if log.SubLogType == List {
@@ -460,12 +620,37 @@ func (log Log) StringWithLang(lang string) (str string) {
 	return str
 }
 
+// SubLogsを含めたメッセージを1つの文字列にする
+func (log Log) FullMessage(lang string) string {
+	message := log.Message
+	if lang == "ja" && log.Message_ja != "" {
+		message = log.Message_ja
+	}
+	if len(log.SubLogs) > 0 {
+		if log.SubLogType == List {
+			message += ": " + strings.Join(log.SubLogs, ", ")
+		} else {
+			message += "\n  " + strings.Join(log.SubLogs, "\n  ")
+		}
+	}
+	return message
+}
+
 type Logs []Log
 
 func (logs *Logs) add(log Log) {
 	*logs = append(*logs, log)
 }
 
+// Pathが未設定のログにpathを設定する
+func (logs Logs) setPath(path string) {
+	for i := range logs {
+		if logs[i].Path == "" {
+			logs[i].Path = path
+		}
+	}
+}
+
 // checkResultのスライス/ポインタ、もしくはLogのスライスからLogを追加する
 func (logs *Logs) addResultLog(argResult interface{}) {
 	argValue := reflect.ValueOf(argResult)
@@ -625,6 +810,9 @@ var COMMANDS = []Command{
 	{"comment", String, Unnecessary, nil},
 }
 
+// #RANKの値の名前
+var RANK_NAMES = map[int]string{0: "VERY HARD", 1: "HARD", 2: "NORMAL", 3: "EASY", 4: "VERY EASY"}
+
 var INDEXED_COMMANDS = []Command{
 	{"wav", Path, Necessary, AUDIO_EXTS},
 	{"bmp", Path, Unnecessary, BMP_EXTS},
@@ -667,50 +855,241 @@ func matchChannel(ch string, channels []string) bool {
 	return false
 }
 
+// path以下のBMSフォルダを全て読み込む。読み込めないフォルダがあっても残りのフォルダを読み込み、
+// 読み込めたフォルダと共にScanErrorsを返す。pathそのものが読み込めなければそのエラーを返す。
+// pathがzipファイルなら、展開せずにzipの中を読み込む。その場合は使い終わったフォルダのCloseを呼ぶ
 func ScanDirectory(path string) ([]Directory, error) {
+	loc, err := openScanLocation(path)
+	if err != nil {
+		return nil, err
+	}
+	defer loc.close()
+	return loc.scanDirectory()
+}
+
+// fsysの中のnameのフォルダ以下にあるBMSフォルダを全て読み込む。ScanDirectoryのfs.FS版。
+// 読み込んだフォルダやファイルのPathは、nameからのパスをOSの区切り文字にしたものになる
+func ScanDirectoryFS(fsys fs.FS, name string) ([]Directory, error) {
+	return newFSScanLocation(fsys, name).scanDirectory()
+}
+
+// path以下のBMSフォルダのパスを、ScanDirectoryと同じ順で返す。
+// 読み込めないフォルダがあれば、見つかったパスと共にScanErrorsを返す。pathそのものが読み込めなければそのエラーを返す
+func FindBmsDirectories(path string) ([]string, error) {
+	loc, err := openScanLocation(path)
+	if err != nil {
+		return nil, err
+	}
+	defer loc.close()
+
+	dirLocs, err := loc.findBmsDirectories()
+	if dirLocs == nil {
+		return nil, err
+	}
+	dirPaths := []string{}
+	for _, dirLoc := range dirLocs {
+		dirPaths = append(dirPaths, dirLoc.path)
+	}
+	return dirPaths, err
+}
+
+// pathのフォルダを読み込む。pathそのものが読み込めなければエラーを返す。
+// 読み込めないファイルや内部のフォルダはScanErrorsに入れて、残りを読み込む。
+// pathがzipファイルなら、zipの中のBMSフォルダ(1つだけの場合)を読み込む。zipの場合は使い終わったらCloseを呼ぶ
+func ScanBmsDirectory(path string, isRootDir, doScan bool) (*Directory, error) {
+	loc, err := openScanLocation(path)
+	if err != nil {
+		return nil, err
+	}
+	defer loc.close()
+
+	if loc.zip != nil && loc.name == "." && isRootDir {
+		// 曲フォルダはzipの中のフォルダにあることが多い
+		dirLocs, _ := loc.findBmsDirectories()
+		if len(dirLocs) != 1 {
+			return nil, fmt.Errorf("zip must have one bms folder, but has %d: %s", len(dirLocs), path)
+		}
+		loc = dirLocs[0]
+	}
+	return loc.scanBmsDirectory(isRootDir, doScan)
+}
+
+// fsysの中のnameのフォルダを読み込む。ScanBmsDirectoryのfs.FS版
+func ScanBmsDirectoryFS(fsys fs.FS, name string, isRootDir, doScan bool) (*Directory, error) {
+	return newFSScanLocation(fsys, name).scanBmsDirectory(isRootDir, doScan)
+}
+
+func ReadBmsFileBase(path string) (bmsFileBase *BmsFileBase, _ error) {
+	loc, err := openScanLocation(path)
+	if err != nil {
+		return nil, fmt.Errorf("BMSfile open error: " + err.Error())
+	}
+	defer loc.close()
+	return loc.readBmsFileBase()
+}
+
+// fsysの中のnameのBMSファイルを読み込む。ReadBmsFileBaseのfs.FS版
+func ReadBmsFileBaseFS(fsys fs.FS, name string) (*BmsFileBase, error) {
+	return newFSScanLocation(fsys, name).readBmsFileBase()
+}
+
+// 読み込むファイルやフォルダの場所。nameはfsysの中での名前、pathはログなどに使うパス
+type scanLocation struct {
+	fsys fs.FS
+	name string
+	path string
+	zip  *zipArchive // zipファイルの中ならそのzip
+}
+
+// pathを読み込む場所を開く。pathがzipファイルか、zipファイルの中のパスならzipを開く。使い終わったらcloseを呼ぶ
+func openScanLocation(path string) (scanLocation, error) {
+	if zipPath, name, ok := splitZipPath(path); ok {
+		archive, err := openZipArchive(zipPath)
+		if err != nil {
+			return scanLocation{}, err
+		}
+		return scanLocation{fsys: archive, name: name, path: path, zip: archive}, nil
+	}
+	cleanPath := filepath.Clean(path)
+	if filepath.Dir(cleanPath) == cleanPath { // ルートフォルダ
+		return scanLocation{fsys: os.DirFS(cleanPath), name: ".", path: path}, nil
+	}
+	return scanLocation{fsys: os.DirFS(filepath.Dir(cleanPath)), name: filepath.Base(cleanPath), path: path}, nil
+}
+
+// fs.FSの中を読み込む場所。パスはnameをOSの区切り文字にしたもの
+func newFSScanLocation(fsys fs.FS, name string) scanLocation {
+	return scanLocation{fsys: fsys, name: name, path: filepath.FromSlash(name)}
+}
+
+func (loc scanLocation) close() {
+	if loc.zip != nil {
+		loc.zip.Close()
+	}
+}
+
+func (loc scanLocation) join(elem string) scanLocation {
+	name := elem
+	if loc.name != "." {
+		name = loc.name + "/" + elem
+	}
+	return scanLocation{fsys: loc.fsys, name: name, path: filepath.Join(loc.path, elem), zip: loc.zip}
+}
+
+// エラーのパスを、fsysの中の名前からログなどに使うパスにする
+func (loc scanLocation) pathError(err error) error {
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		pathErr.Path = loc.path
+	}
+	return err
+}
+
+func (loc scanLocation) readDir() ([]fs.DirEntry, error) {
+	files, err := fs.ReadDir(loc.fsys, loc.name)
+	return files, loc.pathError(err)
+}
+
+func (loc scanLocation) scanDirectory() ([]Directory, error) {
+	dirLocs, err := loc.findBmsDirectories()
+	var scanErrors ScanErrors
+	if err != nil && !errors.As(err, &scanErrors) {
+		return nil, err
+	}
 	bmsDirs := []Directory{}
-	if IsBmsDirectory(path) {
-		bmsDir, err := ScanBmsDirectory(path, true, true)
+	for _, dirLoc := range dirLocs {
+		bmsDir, err := dirLoc.scanBmsDirectory(true, true)
 		if err != nil {
-			return nil, err
+			scanErrors = append(scanErrors, ScanError{Path: dirLoc.path, Err: err})
+			continue
 		}
 		bmsDirs = append(bmsDirs, *bmsDir)
-	} else {
-		files, err := os.ReadDir(path)
+	}
+
+	if len(scanErrors) > 0 {
+		return bmsDirs, scanErrors
+	}
+	return bmsDirs, nil
+}
+
+func (loc scanLocation) isBmsDirectory() bool {
+	files, err := loc.readDir()
+	if err != nil {
+		return false
+	}
+	for _, f := range files {
+		if IsBmsFile(f.Name()) {
+			return true
+		}
+	}
+	return false
+}
+
+func (loc scanLocation) findBmsDirectories() ([]scanLocation, error) {
+	if _, err := loc.readDir(); err != nil {
+		return nil, err
+	}
+	dirLocs := []scanLocation{}
+	var scanErrors ScanErrors
+	var findDirectories func(loc scanLocation)
+	findDirectories = func(loc scanLocation) {
+		if loc.isBmsDirectory() {
+			dirLocs = append(dirLocs, loc)
+			return
+		}
+		files, err := loc.readDir()
 		if err != nil {
-			return nil, err
+			scanErrors = append(scanErrors, ScanError{Path: loc.path, Err: err})
+			return
 		}
 		for _, f := range files {
 			if f.IsDir() {
-				_bmsDirs, err := ScanDirectory(filepath.Join(path, f.Name()))
-				if err != nil {
-					return nil, err
-				}
-				bmsDirs = append(bmsDirs, _bmsDirs...)
+				findDirectories(loc.join(f.Name()))
 			}
 		}
 	}
+	findDirectories(loc)
 
-	return bmsDirs, nil
+	if len(scanErrors) > 0 {
+		return dirLocs, scanErrors
+	}
+	return dirLocs, nil
 }
 
-func ScanBmsDirectory(path string, isRootDir, doScan bool) (*Directory, error) {
-	dir := newDirectory(path)
-	files, _ := os.ReadDir(path)
+func (loc scanLocation) scanBmsDirectory(isRootDir, doScan bool) (*Directory, error) {
+	dir := newDirectory(loc.path)
+	files, err := loc.readDir()
+	if err != nil {
+		return nil, err
+	}
+	addScanError := func(path string, err error) {
+		dir.ScanErrors = append(dir.ScanErrors, ScanError{Path: path, Err: err})
+	}
+	if loc.zip == nil {
+		dir.fsys, dir.fsysName = loc.fsys, loc.name
+	} else if isRootDir {
+		dir.garbledZipNames = loc.zip.garbledNamesIn(loc.name)
+		// チェックで音声ファイルなどを読むので、Closeが呼ばれるまでzipを開いておく
+		loc.zip.retain()
+		dir.fsys, dir.fsysName, dir.zip = loc.fsys, loc.name, loc.zip
+	}
 
 	for _, f := range files {
-		filePath := filepath.Join(path, f.Name())
+		fileLoc := loc.join(f.Name())
+		filePath := fileLoc.path
 		if isRootDir && IsBmsFile(f.Name()) { // TODO isRootDirいる？on/off付ける？
-			bmsFileBase, err := ReadBmsFileBase(filePath)
+			bmsFileBase, err := fileLoc.readBmsFileBase()
 			if err != nil {
-				return nil, err
+				addScanError(filePath, err)
+				continue
 			}
 			if IsBmsonFile(filePath) {
 				bmsonFile := NewBmsonFile(bmsFileBase)
 				if doScan {
 					err := bmsonFile.ScanBmsonFile()
 					if err != nil {
-						return nil, err
+						addScanError(filePath, err)
+						continue
 					}
 				}
 				dir.BmsonFiles = append(dir.BmsonFiles, *bmsonFile)
@@ -719,19 +1098,22 @@ func ScanBmsDirectory(path string, isRootDir, doScan bool) (*Directory, error) {
 				if doScan {
 					err := bmsFile.ScanBmsFile()
 					if err != nil {
-						return nil, err
+						addScanError(filePath, err)
+						continue
 					}
 				}
 				dir.BmsFiles = append(dir.BmsFiles, *bmsFile)
 			}
 		} else if f.IsDir() {
-			innnerDir, err := ScanBmsDirectory(filePath, false, doScan)
+			innnerDir, err := fileLoc.scanBmsDirectory(false, doScan)
 			if err != nil {
-				return nil, err
+				addScanError(filePath, err)
+				continue
 			}
 			dir.Directories = append(dir.Directories, *innnerDir)
 			dir.NonBmsFiles = append(dir.NonBmsFiles, innnerDir.NonBmsFiles...)
 			dir.Directories = append(dir.Directories, innnerDir.Directories...)
+			dir.ScanErrors = append(dir.ScanErrors, innnerDir.ScanErrors...)
 		} else {
 			dir.NonBmsFiles = append(dir.NonBmsFiles, *newNonBmsFile(filePath))
 		}
@@ -740,19 +1122,19 @@ func ScanBmsDirectory(path string, isRootDir, doScan bool) (*Directory, error) {
 	return dir, nil
 }
 
-func ReadBmsFileBase(path string) (bmsFileBase *BmsFileBase, _ error) {
-	file, err := os.Open(path)
+func (loc scanLocation) readBmsFileBase() (bmsFileBase *BmsFileBase, _ error) {
+	file, err := loc.fsys.Open(loc.name)
 	if err != nil {
-		return nil, fmt.Errorf("BMSfile open error: " + err.Error())
+		return nil, fmt.Errorf("BMSfile open error: " + loc.pathError(err).Error())
 	}
 	defer file.Close()
 
 	bmsFileBase = &BmsFileBase{}
-	bmsFileBase.Path = path
+	bmsFileBase.Path = loc.path
 
 	fullText, err := io.ReadAll(file)
 	if err != nil {
-		return nil, fmt.Errorf("BMSfile ReadAll error: " + err.Error())
+		return nil, fmt.Errorf("BMSfile ReadAll error: " + loc.pathError(err).Error())
 	}
 	bmsFileBase.FullText = fullText
 	bmsFileBase.Sha256 = fmt.Sprintf("%x", sha256.Sum256(bmsFileBase.FullText))
@@ -761,6 +1143,19 @@ func ReadBmsFileBase(path string) (bmsFileBase *BmsFileBase, _ error) {
 }
 
 func CheckBmsFile(bmsFile *BmsFile) {
+	config := configOrDefault(bmsFile.Config)
+	if logs, ok := bmsFile.Cache.chartLogs(&bmsFile.BmsFileBase, config); ok {
+		bmsFile.Logs = logs
+	} else {
+		bmsFile.checkEachBranch(checkBmsFile)
+		bmsFile.Cache.storeChartLogs(&bmsFile.BmsFileBase, config)
+	}
+	bmsFile.applySuppressions()
+	bmsFile.Logs = config.apply(bmsFile.Logs)
+	bmsFile.Logs.setPath(bmsFile.Path)
+}
+
+func checkBmsFile(bmsFile *BmsFile) {
 	bmsFile.Logs.addResultLogs(CheckHeaderCommands(bmsFile))
 	bmsFile.Logs.addResultLogs(CheckTitleAndSubtitleHaveSameText(bmsFile))
 	bmsFile.Logs.addResultLogs(CheckIndexedDefinitionsHaveInvalidValue(bmsFile))
@@ -777,6 +1172,24 @@ func CheckBmsFile(bmsFile *BmsFile) {
 }
 
 func CheckBmsDirectory(bmsDir *Directory, doDiffCheck bool) {
+	config := configOrDefault(bmsDir.Config)
+	for i := range bmsDir.BmsFiles {
+		if bmsDir.BmsFiles[i].Config == nil {
+			bmsDir.BmsFiles[i].Config = config
+		}
+		if bmsDir.BmsFiles[i].Cache == nil {
+			bmsDir.BmsFiles[i].Cache = bmsDir.Cache
+		}
+	}
+	for i := range bmsDir.BmsonFiles {
+		if bmsDir.BmsonFiles[i].Config == nil {
+			bmsDir.BmsonFiles[i].Config = config
+		}
+		if bmsDir.BmsonFiles[i].Cache == nil {
+			bmsDir.BmsonFiles[i].Cache = bmsDir.Cache
+		}
+	}
+
 	for i := range bmsDir.BmsFiles {
 		CheckBmsFile(&bmsDir.BmsFiles[i])
 
@@ -803,7 +1216,9 @@ func CheckBmsDirectory(bmsDir *Directory, doDiffCheck bool) {
 				}
 				return true
 			}
-			bmsDir.BmsFiles[i].Logs.addResultLogs(CheckWithoutKeysound(&bmsDir.BmsFiles[i], wavFileIsExist))
+			bmsDir.BmsFiles[i].checkEachBranch(func(bmsFile *BmsFile) {
+				bmsFile.Logs.addResultLogs(CheckWithoutKeysound(bmsFile, wavFileIsExist))
+			})
 		}
 	}
 
@@ -840,6 +1255,8 @@ func CheckBmsDirectory(bmsDir *Directory, doDiffCheck bool) {
 		}
 	}
 
+	bmsDir.Logs.addResultLogs(CheckUnreadableFiles(bmsDir))
+	bmsDir.Logs.addResultLogs(CheckGarbledZipFilenames(bmsDir))
 	bmsDir.Logs.addResultLogs(CheckDefinitionsAreUnified(bmsDir))
 	bmsDir.Logs.addResultLogs(CheckUnusedFile(bmsDir))
 	bmsDir.Logs.addResultLogs(CheckEmptyDirectory(bmsDir))
@@ -864,6 +1281,19 @@ func CheckBmsDirectory(bmsDir *Directory, doDiffCheck bool) {
 			}
 		}
 	}
+
+	for i := range bmsDir.BmsFiles {
+		bmsDir.Logs = bmsDir.BmsFiles[i].suppress(bmsDir.Logs, bmsDir.BmsFiles[i].Path)
+		bmsDir.BmsFiles[i].applySuppressions()
+		bmsDir.BmsFiles[i].Logs = configOrDefault(bmsDir.BmsFiles[i].Config).apply(bmsDir.BmsFiles[i].Logs)
+		bmsDir.BmsFiles[i].Logs.setPath(bmsDir.BmsFiles[i].Path)
+	}
+	for i := range bmsDir.BmsonFiles {
+		bmsDir.BmsonFiles[i].Logs = configOrDefault(bmsDir.BmsonFiles[i].Config).apply(bmsDir.BmsonFiles[i].Logs)
+		bmsDir.BmsonFiles[i].Logs.setPath(bmsDir.BmsonFiles[i].Path)
+	}
+	bmsDir.Logs = config.apply(bmsDir.Logs)
+	bmsDir.Logs.setPath(bmsDir.Path)
 }
 
 func hasExts(path string, exts []string) bool {
@@ -887,33 +1317,44 @@ func IsBmsonFile(path string) bool {
 }
 
 func IsBmsDirectory(path string) bool {
-	files, err := os.ReadDir(path)
+	loc, err := openScanLocation(path)
 	if err != nil {
 		return false
 	}
-	for _, f := range files {
-		if IsBmsFile(f.Name()) {
-			return true
-		}
-	}
-	return false
+	defer loc.close()
+	return loc.isBmsDirectory()
 }
 
-func containsMultibyteRune(text string) bool {
-	return len(text) != utf8.RuneCountInString(text)
+// fsysの中のnameのフォルダにBMSファイルがあるか。IsBmsDirectoryのfs.FS版
+func IsBmsDirectoryFS(fsys fs.FS, name string) bool {
+	return newFSScanLocation(fsys, name).isBmsDirectory()
 }
 
-func isUTF8(fBytes []byte) (bool, error) {
-	det := chardet.NewTextDetector()
-	detResult, err := det.DetectBest(fBytes)
-	if err != nil {
-		fmt.Println("Detect error:", err.Error())
-		return false, err
+// zipから読み込んだフォルダが開いているzipを閉じる。zip以外から読み込んだフォルダでは何もしない。
+// 閉じた後もチェックはできるが、音声ファイルなどを読むたびにzipを開き直す
+func (bmsDir *Directory) Close() error {
+	if bmsDir.zip == nil {
+		return nil
 	}
-	if detResult.Charset == "UTF-8" {
-		return true, nil
+	err := bmsDir.zip.Close()
+	bmsDir.fsys, bmsDir.fsysName, bmsDir.zip = nil, "", nil
+	return err
+}
+
+// bmsDirの中のファイルを読み込む場所。使い終わったらcloseを呼ぶ
+func (bmsDir *Directory) fileLocation(path string) (scanLocation, error) {
+	if bmsDir.fsys == nil {
+		return openScanLocation(path)
 	}
-	return false, nil
+	rel, err := filepath.Rel(bmsDir.Path, path)
+	if err != nil || !filepath.IsLocal(rel) {
+		return scanLocation{}, fmt.Errorf("file is not in the folder: %s", path)
+	}
+	return scanLocation{fsys: bmsDir.fsys, name: bmsDir.fsysName, path: bmsDir.Path}.join(filepath.ToSlash(rel)), nil
+}
+
+func containsMultibyteRune(text string) bool {
+	return len(text) != utf8.RuneCountInString(text)
 }
 
 func removeDuplicate(args []string) []string {
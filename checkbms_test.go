@@ -0,0 +1,146 @@
+package checkbms
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"testing/fstest"
+
+	"github.com/Shimi9999/checkbms/audio"
+)
+
+func TestScanDirectoryContinuesOnScanErrors(t *testing.T) {
+	root := t.TempDir()
+	for _, dir := range []string{"ok", "partial"} {
+		if err := os.Mkdir(filepath.Join(root, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(root, dir, "a.bms"), []byte("#TITLE a\r\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 開けないBMSファイル
+	if err := os.Symlink(filepath.Join(root, "nonexistent"), filepath.Join(root, "partial", "b.bms")); err != nil {
+		t.Skip("symlink is not supported:", err)
+	}
+
+	bmsDirs, err := ScanDirectory(root)
+	if err != nil {
+		t.Fatalf("ScanDirectory: %s", err.Error())
+	}
+	if len(bmsDirs) != 2 {
+		t.Fatalf("directories: got = %d, want = 2", len(bmsDirs))
+	}
+	partial := bmsDirs[1]
+	if len(partial.BmsFiles) != 1 || len(partial.ScanErrors) != 1 || partial.ScanErrors[0].Path != filepath.Join(root, "partial", "b.bms") {
+		t.Fatalf("partial: got = %d files, scan errors %v", len(partial.BmsFiles), partial.ScanErrors)
+	}
+
+	CheckBmsDirectory(&partial, false)
+	found := false
+	for _, log := range partial.Logs {
+		if log.Rule == "dir.file-unreadable" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("dir.file-unreadable is not reported: %v", partial.Logs)
+	}
+
+	_, err = ScanDirectory(filepath.Join(root, "nonexistent"))
+	var scanErrors ScanErrors
+	if err == nil || errors.As(err, &scanErrors) {
+		t.Errorf("ScanDirectory of nonexistent path: got = %v, want the read error", err)
+	}
+}
+
+// 16bitモノラル、8000Hzで無音のWAVファイル
+func newTestWav(seconds float64) []byte {
+	const sampleRate = 8000
+	dataSize := uint32(seconds*sampleRate) * 2
+	var buf bytes.Buffer
+	buf.WriteString("RIFF")
+	binary.Write(&buf, binary.LittleEndian, 36+dataSize)
+	buf.WriteString("WAVEfmt ")
+	binary.Write(&buf, binary.LittleEndian, []any{uint32(16), uint16(1), uint16(1), uint32(sampleRate), uint32(sampleRate * 2), uint16(2), uint16(16)})
+	buf.WriteString("data")
+	binary.Write(&buf, binary.LittleEndian, dataSize)
+	buf.Write(make([]byte, dataSize))
+	return buf.Bytes()
+}
+
+func TestScanDirectoryFS(t *testing.T) {
+	files := map[string][]byte{
+		"songs/song/a.bms":          []byte("#TITLE a\r\n#WAV01 long.wav\r\n#WAV02 missing.wav\r\n#00111:0102\r\n"),
+		"songs/song/long.wav":       newTestWav(1),
+		"songs/song/sub/unused.png": []byte("png"),
+		"songs/readme.txt":          []byte("readme"),
+	}
+	mapFS := fstest.MapFS{}
+	entries := []testZipEntry{}
+	root := t.TempDir()
+	for name, data := range files {
+		mapFS[name] = &fstest.MapFile{Data: data}
+		entries = append(entries, testZipEntry{name: name, body: string(data)})
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	config := DefaultConfig()
+	config.Thresholds.AudioDurationLimit = 0.5
+
+	check := func(fsys fs.FS) DirectoryResult {
+		if !IsBmsDirectoryFS(fsys, "songs/song") || IsBmsDirectoryFS(fsys, "songs") {
+			t.Errorf("%T: IsBmsDirectoryFS is wrong", fsys)
+		}
+		bmsDirs, err := ScanDirectoryFS(fsys, "songs")
+		if err != nil || len(bmsDirs) != 1 {
+			t.Fatalf("%T: ScanDirectoryFS: got = %d directories, %v", fsys, len(bmsDirs), err)
+		}
+		bmsDir, err := ScanBmsDirectoryFS(fsys, "songs/song", true, true)
+		if err != nil {
+			t.Fatalf("%T: ScanBmsDirectoryFS: %v", fsys, err)
+		}
+		if !reflect.DeepEqual(bmsDir.BmsFiles, bmsDirs[0].BmsFiles) {
+			t.Errorf("%T: ScanDirectoryFS and ScanBmsDirectoryFS are different", fsys)
+		}
+		if bmsFileBase, err := ReadBmsFileBaseFS(fsys, "songs/song/a.bms"); err != nil || bmsFileBase.Sha256 != bmsDir.BmsFiles[0].Sha256 {
+			t.Errorf("%T: ReadBmsFileBaseFS: got = %+v, %v", fsys, bmsFileBase, err)
+		}
+		bmsDir.Config = config
+		CheckBmsDirectory(bmsDir, false)
+		return NewDirectoryResult(bmsDir)
+	}
+
+	want := check(mapFS)
+	if want.Path != filepath.Join("songs", "song") {
+		t.Errorf("path: got = %s", want.Path)
+	}
+	rules := map[string]bool{}
+	for _, log := range want.Diagnostics {
+		rules[log.Rule] = true
+	}
+	wantRules := []string{"dir.file-not-found", "dir.file-unused"}
+	if d, err := audio.DurationFS(mapFS, "songs/song/long.wav"); err == nil && d >= 0.5 {
+		wantRules = append(wantRules, "dir.audio-over-1-minute")
+	}
+	for _, rule := range wantRules {
+		if !rules[rule] {
+			t.Errorf("%s is not reported: %v", rule, want.Diagnostics)
+		}
+	}
+	for _, fsys := range []fs.FS{os.DirFS(root), newTestZip(t, entries...)} {
+		if got := check(fsys); !reflect.DeepEqual(got, want) {
+			t.Errorf("%T: got = %+v, want = %+v", fsys, got, want)
+		}
+	}
+}
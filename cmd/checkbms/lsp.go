@@ -0,0 +1,578 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/Shimi9999/checkbms"
+)
+
+// 標準入出力で動くLanguage Serverの最小限の実装。
+// 開かれたBMSファイルのフォルダをチェックしてログを診断として送り、オブジェのホバー、定義へのジャンプ、ファイル名の補完を行う
+
+// 編集が続いている間はチェックしない
+const lspCheckDelay = 200 * time.Millisecond
+
+type lspMessage struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id,omitempty"`
+	Method  string           `json:"method,omitempty"`
+	Params  json.RawMessage  `json:"params,omitempty"`
+	Result  interface{}      `json:"result,omitempty"`
+	Error   *lspError        `json:"error,omitempty"`
+}
+
+type lspError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type lspPosition struct {
+	Line      int `json:"line"`      // 0始まり
+	Character int `json:"character"` // 0始まり、UTF-16単位
+}
+
+type lspRange struct {
+	Start lspPosition `json:"start"`
+	End   lspPosition `json:"end"`
+}
+
+type lspLocation struct {
+	URI   string   `json:"uri"`
+	Range lspRange `json:"range"`
+}
+
+type lspTextDocumentPositionParams struct {
+	TextDocument struct {
+		URI string `json:"uri"`
+	} `json:"textDocument"`
+	Position lspPosition `json:"position"`
+}
+
+type lspDiagnostic struct {
+	Range    lspRange `json:"range"`
+	Severity int      `json:"severity"`
+	Code     string   `json:"code,omitempty"`
+	Source   string   `json:"source"`
+	Message  string   `json:"message"`
+}
+
+// エディタで開かれているBMSファイル
+type lspDocument struct {
+	uri   string
+	path  string
+	text  string
+	lines []string
+}
+
+func newLspDocument(uri, path, text string) *lspDocument {
+	lines := strings.Split(text, "\n")
+	for i := range lines {
+		lines[i] = strings.TrimSuffix(lines[i], "\r")
+	}
+	return &lspDocument{uri: uri, path: path, text: text, lines: lines}
+}
+
+func (doc *lspDocument) line(number int) string {
+	if number < 1 || number > len(doc.lines) {
+		return ""
+	}
+	return doc.lines[number-1]
+}
+
+type lspServer struct {
+	lang   string
+	config *checkbms.Config
+	cache  *checkbms.Cache
+	writer io.Writer
+	mu     sync.Mutex // writerへの書き込み
+
+	documents map[string]*lspDocument        // キーはURI
+	dirs      map[string]*checkbms.Directory // 最後にチェックしたフォルダ。キーはフォルダのパス
+	bmsFiles  map[string]*checkbms.BmsFile   // 最後にチェックしたBMSファイル。キーはファイルのパス
+	pending   map[string]bool                // チェックを待っているフォルダ
+	shutdown  bool
+}
+
+// checkbms lsp [-lang en|ja] [-config path]
+func doLsp(args []string) int {
+	flagSet := flag.NewFlagSet("lsp", flag.ExitOnError)
+	lang := flagSet.String("lang", "en", "log language")
+	configPath := flagSet.String("config", "", "config file path (default: checkbms/config.json in the user config directory if it exists)")
+	flagSet.Parse(args)
+
+	if len(flagSet.Args()) > 0 {
+		fmt.Fprintln(os.Stderr, "Usage: checkbms lsp [-lang en|ja] [-config path]")
+		return exitFailure
+	}
+	config, err := loadConfig(*configPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error: Config is wrong:", err.Error())
+		return exitFailure
+	}
+	s := &lspServer{lang: *lang, config: config, cache: checkbms.NewCache(), writer: os.Stdout,
+		documents: map[string]*lspDocument{}, dirs: map[string]*checkbms.Directory{}, bmsFiles: map[string]*checkbms.BmsFile{}, pending: map[string]bool{}}
+	return s.run(os.Stdin)
+}
+
+func (s *lspServer) run(r io.Reader) int {
+	messages := make(chan *lspMessage)
+	readErr := make(chan error, 1)
+	go func() {
+		reader := bufio.NewReader(r)
+		for {
+			message, err := readLspMessage(reader)
+			if err != nil {
+				readErr <- err
+				return
+			}
+			messages <- message
+		}
+	}()
+
+	timer := time.NewTimer(lspCheckDelay)
+	if !timer.Stop() {
+		<-timer.C
+	}
+	for {
+		select {
+		case message := <-messages:
+			if message.Method == "exit" {
+				if s.shutdown {
+					return exitOK
+				}
+				return exitFailure
+			}
+			if s.handle(message) {
+				timer.Reset(lspCheckDelay)
+			}
+		case <-timer.C:
+			s.checkPending()
+		case err := <-readErr:
+			if err != io.EOF {
+				fmt.Fprintln(os.Stderr, "Error: lsp:", err.Error())
+			}
+			return exitFailure
+		}
+	}
+}
+
+// Content-Lengthヘッダーの付いたJSON-RPCのメッセージを1つ読む
+func readLspMessage(reader *bufio.Reader) (*lspMessage, error) {
+	length := -1
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			break
+		}
+		if name, value, ok := strings.Cut(line, ":"); ok && strings.EqualFold(name, "Content-Length") {
+			if length, err = strconv.Atoi(strings.TrimSpace(value)); err != nil {
+				return nil, fmt.Errorf("invalid Content-Length: %s", value)
+			}
+		}
+	}
+	if length < 0 {
+		return nil, fmt.Errorf("Content-Length is missing")
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(reader, body); err != nil {
+		return nil, err
+	}
+	var message lspMessage
+	if err := json.Unmarshal(body, &message); err != nil {
+		return nil, err
+	}
+	return &message, nil
+}
+
+func (s *lspServer) write(message lspMessage) {
+	message.JSONRPC = "2.0"
+	body, err := json.Marshal(message)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error: lsp:", err.Error())
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fmt.Fprintf(s.writer, "Content-Length: %d\r\n\r\n%s", len(body), body)
+}
+
+func (s *lspServer) reply(id *json.RawMessage, result interface{}) {
+	if result == nil {
+		// resultを省略せずにnullとして送る
+		result = json.RawMessage("null")
+	}
+	s.write(lspMessage{ID: id, Result: result})
+}
+
+func (s *lspServer) notify(method string, params interface{}) {
+	body, _ := json.Marshal(params)
+	s.write(lspMessage{Method: method, Params: body})
+}
+
+// メッセージを処理する。チェックを待つフォルダが増えたらtrue
+func (s *lspServer) handle(message *lspMessage) bool {
+	switch message.Method {
+	case "initialize":
+		s.reply(message.ID, map[string]interface{}{
+			"capabilities": map[string]interface{}{
+				"textDocumentSync":   map[string]interface{}{"openClose": true, "change": 1, "save": true}, // 1: 全文を送る
+				"hoverProvider":      true,
+				"definitionProvider": true,
+				"completionProvider": map[string]interface{}{"triggerCharacters": []string{" ", "/", "\\"}},
+			},
+			"serverInfo": map[string]string{"name": "checkbms"},
+		})
+	case "shutdown":
+		s.shutdown = true
+		s.reply(message.ID, nil)
+	case "textDocument/didOpen":
+		var params struct {
+			TextDocument struct {
+				URI  string `json:"uri"`
+				Text string `json:"text"`
+			} `json:"textDocument"`
+		}
+		if json.Unmarshal(message.Params, &params) == nil {
+			return s.update(params.TextDocument.URI, params.TextDocument.Text)
+		}
+	case "textDocument/didChange":
+		var params struct {
+			TextDocument struct {
+				URI string `json:"uri"`
+			} `json:"textDocument"`
+			ContentChanges []struct {
+				Text string `json:"text"`
+			} `json:"contentChanges"`
+		}
+		if json.Unmarshal(message.Params, &params) == nil && len(params.ContentChanges) > 0 {
+			return s.update(params.TextDocument.URI, params.ContentChanges[len(params.ContentChanges)-1].Text)
+		}
+	case "textDocument/didSave":
+		// 音声ファイルなどが追加されている場合のためにチェックし直す
+		var params lspTextDocumentPositionParams
+		if json.Unmarshal(message.Params, &params) == nil {
+			if doc, ok := s.documents[params.TextDocument.URI]; ok {
+				s.pending[filepath.Dir(doc.path)] = true
+				return true
+			}
+		}
+	case "textDocument/didClose":
+		var params lspTextDocumentPositionParams
+		if json.Unmarshal(message.Params, &params) == nil {
+			if doc, ok := s.documents[params.TextDocument.URI]; ok {
+				delete(s.documents, params.TextDocument.URI)
+				delete(s.bmsFiles, doc.path)
+				s.notify("textDocument/publishDiagnostics", map[string]interface{}{"uri": params.TextDocument.URI, "diagnostics": []lspDiagnostic{}})
+			}
+		}
+	case "textDocument/hover":
+		s.replyPosition(message, s.hover)
+	case "textDocument/definition":
+		s.replyPosition(message, s.definition)
+	case "textDocument/completion":
+		s.replyPosition(message, s.completion)
+	default:
+		if message.ID != nil {
+			s.write(lspMessage{ID: message.ID, Error: &lspError{Code: -32601, Message: "method not found: " + message.Method}})
+		}
+	}
+	return false
+}
+
+func (s *lspServer) update(uri, text string) bool {
+	path, err := uriToPath(uri)
+	if err != nil || !checkbms.IsBmsFile(path) {
+		return false
+	}
+	s.documents[uri] = newLspDocument(uri, path, text)
+	s.pending[filepath.Dir(path)] = true
+	return true
+}
+
+// 位置を引数に取るリクエストに答える。編集中のチェックが残っていれば先に済ませる
+func (s *lspServer) replyPosition(message *lspMessage, fn func(doc *lspDocument, pos lspPosition) interface{}) {
+	var params lspTextDocumentPositionParams
+	if err := json.Unmarshal(message.Params, &params); err != nil {
+		s.write(lspMessage{ID: message.ID, Error: &lspError{Code: -32602, Message: err.Error()}})
+		return
+	}
+	s.checkPending()
+	doc, ok := s.documents[params.TextDocument.URI]
+	if !ok {
+		s.reply(message.ID, nil)
+		return
+	}
+	s.reply(message.ID, fn(doc, params.Position))
+}
+
+func (s *lspServer) checkPending() {
+	dirPaths := []string{}
+	for dirPath := range s.pending {
+		dirPaths = append(dirPaths, dirPath)
+	}
+	sort.Strings(dirPaths)
+	s.pending = map[string]bool{}
+	for _, dirPath := range dirPaths {
+		s.check(dirPath)
+	}
+}
+
+// フォルダを、開かれているファイルはエディタの内容でチェックして、開かれているファイルの診断を送る
+func (s *lspServer) check(dirPath string) {
+	openDocs := map[string]*lspDocument{}
+	for _, doc := range s.documents {
+		if filepath.Dir(doc.path) == dirPath {
+			openDocs[doc.path] = doc
+		}
+	}
+	if len(openDocs) == 0 {
+		return
+	}
+
+	dir, err := checkbms.ScanBmsDirectory(dirPath, true, false)
+	if err != nil {
+		// 保存されていないファイルなど、フォルダが読めなければ開かれているファイルだけでチェックする
+		dir = &checkbms.Directory{File: checkbms.File{Path: dirPath}}
+	}
+	for path, doc := range openDocs {
+		fullText := lspEncodeText(path, doc.text)
+		bmsFileBase := &checkbms.BmsFileBase{File: checkbms.File{Path: path}, FullText: fullText, Sha256: fmt.Sprintf("%x", sha256.Sum256(fullText))}
+		replaced := false
+		for i := range dir.BmsFiles {
+			if dir.BmsFiles[i].Path == path {
+				dir.BmsFiles[i] = *checkbms.NewBmsFile(bmsFileBase)
+				replaced = true
+			}
+		}
+		for i := range dir.BmsonFiles {
+			if dir.BmsonFiles[i].Path == path {
+				dir.BmsonFiles[i] = *checkbms.NewBmsonFile(bmsFileBase)
+				replaced = true
+			}
+		}
+		if !replaced {
+			if checkbms.IsBmsonFile(path) {
+				dir.BmsonFiles = append(dir.BmsonFiles, *checkbms.NewBmsonFile(bmsFileBase))
+			} else {
+				dir.BmsFiles = append(dir.BmsFiles, *checkbms.NewBmsFile(bmsFileBase))
+			}
+		}
+	}
+
+	// ScanBmsDirectoryと同じく、スキャンできないファイルは除いてチェックする
+	scanErrors := map[string]error{}
+	bmsFiles := dir.BmsFiles[:0]
+	for _, bmsFile := range dir.BmsFiles {
+		if err := bmsFile.ScanBmsFile(); err != nil {
+			scanErrors[bmsFile.Path] = err
+			continue
+		}
+		bmsFiles = append(bmsFiles, bmsFile)
+	}
+	dir.BmsFiles = bmsFiles
+	bmsonFiles := dir.BmsonFiles[:0]
+	for _, bmsonFile := range dir.BmsonFiles {
+		if err := bmsonFile.ScanBmsonFile(); err != nil {
+			scanErrors[bmsonFile.Path] = err
+			continue
+		}
+		bmsonFiles = append(bmsonFiles, bmsonFile)
+	}
+	dir.BmsonFiles = bmsonFiles
+	if dir.Config, err = s.config.ForDirectory(dirPath); err != nil {
+		fmt.Fprintln(os.Stderr, "Error: Config is wrong:", err.Error())
+		dir.Config = s.config
+	}
+	dir.Cache = s.cache
+	checkbms.CheckBmsDirectory(dir, false)
+	s.dirs[dirPath] = dir
+
+	logs := map[string]checkbms.Logs{}
+	for i := range dir.BmsFiles {
+		s.bmsFiles[dir.BmsFiles[i].Path] = &dir.BmsFiles[i]
+		logs[dir.BmsFiles[i].Path] = checkbms.NewBmsFileResult(&dir.BmsFiles[i].BmsFileBase).Diagnostics
+	}
+	for i := range dir.BmsonFiles {
+		logs[dir.BmsonFiles[i].Path] = checkbms.NewBmsonFileResult(&dir.BmsonFiles[i]).Diagnostics
+	}
+	for _, log := range dir.Logs {
+		logs[log.Path] = append(logs[log.Path], log)
+	}
+
+	for path, doc := range openDocs {
+		diagnostics := []lspDiagnostic{}
+		if err, ok := scanErrors[path]; ok {
+			diagnostics = append(diagnostics, lspDiagnostic{Severity: 1, Source: "checkbms", Message: err.Error()})
+		}
+		for _, log := range logs[path] {
+			diagnostics = append(diagnostics, s.diagnostic(doc, log))
+		}
+		s.notify("textDocument/publishDiagnostics", map[string]interface{}{"uri": doc.uri, "diagnostics": diagnostics})
+	}
+}
+
+func (s *lspServer) diagnostic(doc *lspDocument, log checkbms.Log) lspDiagnostic {
+	severity := 3 // Information
+	switch log.Level {
+	case checkbms.Error:
+		severity = 1
+	case checkbms.Warning:
+		severity = 2
+	}
+	diagnostic := lspDiagnostic{Severity: severity, Code: log.Rule, Source: "checkbms", Message: log.FullMessage(s.lang)}
+	if log.Line > 0 {
+		// オブジェのログは値の2文字、それ以外は行全体
+		line := doc.line(log.Line)
+		start, end := 0, len(line)
+		if log.Column > 0 {
+			start = log.Column - 1
+			if log.Object != nil {
+				end = start + 2
+			}
+		}
+		diagnostic.Range = lspRange{Start: bytePosition(line, log.Line, start), End: bytePosition(line, log.Line, end)}
+	}
+	return diagnostic
+}
+
+// 保存されているファイルの文字コードに合わせて、エディタの内容をバイト列にする。
+// ファイルが無い、またはその文字コードで表せなければUTF-8
+func lspEncodeText(path, text string) []byte {
+	saved, err := os.ReadFile(path)
+	if err != nil {
+		return []byte(text)
+	}
+	encoding := checkbms.DetectEncoding(saved)
+	if encoding == checkbms.UTF8 && bytes.HasPrefix(saved, checkbms.UTF8_BOM) && !strings.HasPrefix(text, string(checkbms.UTF8_BOM)) {
+		return append(append([]byte{}, checkbms.UTF8_BOM...), text...)
+	}
+	encoded, err := encoding.Encode(text)
+	if err != nil {
+		return []byte(text)
+	}
+	return encoded
+}
+
+func (s *lspServer) hover(doc *lspDocument, pos lspPosition) interface{} {
+	bmsFile, ok := s.bmsFiles[doc.path]
+	if !ok {
+		return nil
+	}
+	line := doc.line(pos.Line + 1)
+	ref, ok := bmsFile.ObjectAt(pos.Line+1, utf16ToByte(line, pos.Character)+1)
+	if !ok {
+		return nil
+	}
+	value := "```\n" + ref.Text + "\n```"
+	if ref.Command != "" && ref.DefinitionLine == 0 {
+		if s.lang == "ja" {
+			value += fmt.Sprintf("\n\n#%sは定義されていません", ref.Command)
+		} else {
+			value += fmt.Sprintf("\n\n#%s is not defined", ref.Command)
+		}
+	}
+	return map[string]interface{}{
+		"contents": map[string]string{"kind": "markdown", "value": value},
+		"range":    lspRange{Start: bytePosition(line, ref.Line, ref.Column-1), End: bytePosition(line, ref.Line, ref.Column+1)},
+	}
+}
+
+func (s *lspServer) definition(doc *lspDocument, pos lspPosition) interface{} {
+	bmsFile, ok := s.bmsFiles[doc.path]
+	if !ok {
+		return nil
+	}
+	ref, ok := bmsFile.ObjectAt(pos.Line+1, utf16ToByte(doc.line(pos.Line+1), pos.Character)+1)
+	if !ok || ref.DefinitionLine == 0 {
+		return nil
+	}
+	line := doc.line(ref.DefinitionLine)
+	return lspLocation{URI: doc.uri,
+		Range: lspRange{Start: lspPosition{Line: ref.DefinitionLine - 1}, End: bytePosition(line, ref.DefinitionLine, len(line))}}
+}
+
+func (s *lspServer) completion(doc *lspDocument, pos lspPosition) interface{} {
+	dir, ok := s.dirs[filepath.Dir(doc.path)]
+	if !ok {
+		return nil
+	}
+	line := doc.line(pos.Line + 1)
+	cursor := utf16ToByte(line, pos.Character)
+	paths, column := checkbms.FileCompletions(dir, line[:cursor])
+	if column == 0 {
+		return nil
+	}
+	editRange := lspRange{Start: bytePosition(line, pos.Line+1, column-1), End: pos}
+	items := []map[string]interface{}{}
+	for _, path := range paths {
+		items = append(items, map[string]interface{}{
+			"label":    path,
+			"kind":     17, // File
+			"textEdit": map[string]interface{}{"range": editRange, "newText": path},
+		})
+	}
+	return items
+}
+
+// lineNumber行(1始まり)のバイト単位の位置を、LSPの位置にする
+func bytePosition(line string, lineNumber, byteOffset int) lspPosition {
+	if byteOffset > len(line) {
+		byteOffset = len(line)
+	}
+	if byteOffset < 0 {
+		byteOffset = 0
+	}
+	return lspPosition{Line: lineNumber - 1, Character: len(utf16.Encode([]rune(line[:byteOffset])))}
+}
+
+// UTF-16単位の位置を、バイト単位の位置にする
+func utf16ToByte(line string, character int) int {
+	offset := 0
+	for offset < len(line) && character > 0 {
+		r, size := utf8.DecodeRuneInString(line[offset:])
+		if r >= 0x10000 {
+			character -= 2 // サロゲートペア
+		} else {
+			character--
+		}
+		offset += size
+	}
+	return offset
+}
+
+func uriToPath(uri string) (string, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme != "file" {
+		return "", fmt.Errorf("unsupported URI: %s", uri)
+	}
+	path := u.Path
+	// file:///C:/songs -> C:/songs
+	if runtime.GOOS == "windows" && len(path) >= 3 && path[0] == '/' && path[2] == ':' {
+		path = path[1:]
+	}
+	return filepath.Clean(filepath.FromSlash(path)), nil
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/Shimi9999/checkbms"
+)
+
+func TestReadLspMessage(t *testing.T) {
+	body1 := `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{}}`
+	body2 := `{"jsonrpc":"2.0","method":"initialized","params":{"text":"あ"}}`
+	input := "Content-Length: " + strconv.Itoa(len(body1)) + "\r\n" +
+		"Content-Type: application/vscode-jsonrpc; charset=utf-8\r\n\r\n" + body1 +
+		// ヘッダー名は大文字小文字を区別しない。本文はバイト数
+		"content-length:" + strconv.Itoa(len(body2)) + "\r\n\r\n" + body2
+	reader := bufio.NewReader(strings.NewReader(input))
+
+	message, err := readLspMessage(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if message.Method != "initialize" || message.ID == nil || string(*message.ID) != "1" {
+		t.Errorf("first message = %+v", message)
+	}
+	message, err = readLspMessage(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if message.Method != "initialized" || message.ID != nil || string(message.Params) != `{"text":"あ"}` {
+		t.Errorf("second message = %+v", message)
+	}
+	if _, err := readLspMessage(reader); err != io.EOF {
+		t.Errorf("after last message: err = %v, want io.EOF", err)
+	}
+}
+
+func TestReadLspMessageError(t *testing.T) {
+	for name, input := range map[string]string{
+		"no Content-Length":      "Content-Type: application/json\r\n\r\n{}",
+		"invalid Content-Length": "Content-Length: abc\r\n\r\n{}",
+		"short body":             "Content-Length: 10\r\n\r\n{}",
+		"invalid JSON":           "Content-Length: 2\r\n\r\n{]",
+	} {
+		if _, err := readLspMessage(bufio.NewReader(strings.NewReader(input))); err == nil {
+			t.Errorf("%s: error is not returned", name)
+		}
+	}
+}
+
+func TestUtf16ToByte(t *testing.T) {
+	line := "aあ😀b"
+	for _, tc := range []struct {
+		character int
+		want      int
+	}{
+		{0, 0},
+		{1, 1},  // a
+		{2, 4},  // あ(UTF-8で3バイト、UTF-16で1単位)
+		{4, 8},  // 😀(UTF-8で4バイト、UTF-16で2単位)
+		{5, 9},  // b
+		{10, 9}, // 行末を超える
+	} {
+		if got := utf16ToByte(line, tc.character); got != tc.want {
+			t.Errorf("utf16ToByte(%q, %d) = %d, want %d", line, tc.character, got, tc.want)
+		}
+	}
+}
+
+func TestBytePosition(t *testing.T) {
+	line := "aあ😀b"
+	for _, tc := range []struct {
+		byteOffset int
+		want       int
+	}{
+		{0, 0},
+		{1, 1},
+		{4, 2},
+		{8, 4},
+		{9, 5},
+		{100, 5}, // 行末を超える
+		{-1, 0},
+	} {
+		if got := bytePosition(line, 3, tc.byteOffset); got != (lspPosition{Line: 2, Character: tc.want}) {
+			t.Errorf("bytePosition(%q, 3, %d) = %+v, want {2 %d}", line, tc.byteOffset, got, tc.want)
+		}
+		// utf16ToByteで元に戻る
+		if tc.byteOffset >= 0 && tc.byteOffset <= len(line) {
+			if got := utf16ToByte(line, tc.want); got != tc.byteOffset {
+				t.Errorf("utf16ToByte(%q, %d) = %d, want %d", line, tc.want, got, tc.byteOffset)
+			}
+		}
+	}
+}
+
+func TestLspDiagnosticRange(t *testing.T) {
+	s := &lspServer{lang: "en"}
+	doc := newLspDocument("file:///song/a.bms", "/song/a.bms", "#TITLE あいう\r\n#00111:0101\r\n")
+	for _, tc := range []struct {
+		name string
+		log  checkbms.Log
+		want lspRange
+	}{
+		{"whole line", checkbms.Log{Level: checkbms.Warning, Line: 1},
+			lspRange{Start: lspPosition{0, 0}, End: lspPosition{0, 10}}},
+		{"object", checkbms.Log{Level: checkbms.Error, Line: 2, Column: 10, Object: &checkbms.LogObject{}},
+			lspRange{Start: lspPosition{1, 9}, End: lspPosition{1, 11}}},
+		{"from column to end of line", checkbms.Log{Level: checkbms.Notice, Line: 2, Column: 8},
+			lspRange{Start: lspPosition{1, 7}, End: lspPosition{1, 11}}},
+		{"no line", checkbms.Log{Level: checkbms.Error},
+			lspRange{}},
+	} {
+		diagnostic := s.diagnostic(doc, tc.log)
+		if diagnostic.Range != tc.want {
+			t.Errorf("%s: range = %+v, want %+v", tc.name, diagnostic.Range, tc.want)
+		}
+	}
+
+	diagnostic := s.diagnostic(doc, checkbms.Log{Level: checkbms.Warning, Rule: "bms.title-contains-subtitle", Line: 1})
+	if diagnostic.Severity != 2 || diagnostic.Code != "bms.title-contains-subtitle" || diagnostic.Source != "checkbms" {
+		t.Errorf("diagnostic = %+v", diagnostic)
+	}
+}
@@ -1,28 +1,105 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"runtime"
 
 	"github.com/Shimi9999/checkbms"
 )
 
+// 終了コード
+const (
+	exitOK       = 0 // -fail-on以上のログが無い
+	exitFindings = 1 // -fail-on以上のログがある
+	exitFailure  = 2 // 引数の誤りや、読み込み・スキャンの失敗
+)
+
+type options struct {
+	doDiffCheck   bool
+	lang          string
+	format        string
+	config        *checkbms.Config
+	baseline      *checkbms.Baseline
+	baselinePath  string
+	writeBaseline bool
+	minLevel      checkbms.AlertLevel // 空なら全て表示
+	failOn        checkbms.AlertLevel // 空ならログがあっても失敗にしない
+	hasFailure    bool                // failOn以上のログがあったか
+	hasScanError  bool                // 読み込めなかったフォルダやファイルがあったか
+	jobs          int                 // 並列にチェックするフォルダ数
+	cache         *checkbms.Cache     // nilならキャッシュしない
+}
+
 func main() {
+	if len(os.Args) >= 2 && os.Args[1] == "stats" {
+		os.Exit(doStats(os.Args[2:]))
+	}
+	if len(os.Args) >= 2 && os.Args[1] == "watch" {
+		os.Exit(doWatch(os.Args[2:]))
+	}
+	if len(os.Args) >= 2 && os.Args[1] == "lsp" {
+		os.Exit(doLsp(os.Args[2:]))
+	}
+	if len(os.Args) >= 2 && os.Args[1] == "serve" {
+		os.Exit(doServe(os.Args[2:]))
+	}
+
 	doDiffCheck := flag.Bool("diff", false, "check difference flag")
 	lang := flag.String("lang", "en", "log language")
+	format := flag.String("format", "text", "output format: text, json, ndjson, sarif, junit or html")
+	configPath := flag.String("config", "", "config file path (default: checkbms/config.json in the user config directory if it exists)")
+	baselinePath := flag.String("baseline", "", "baseline file path. Only logs not in the baseline are reported")
+	writeBaseline := flag.Bool("write-baseline", false, "write the current logs to the -baseline file")
+	failOn := flag.String("fail-on", "", "exit with 1 if there are logs of this level or higher: error, warning or notice")
+	noCache := flag.Bool("no-cache", false, "do not read or write the cache in the user cache directory")
+	jobs := flag.Int("j", runtime.NumCPU(), "number of folders checked in parallel")
+	minLevel := flag.String("min-level", "", "output only logs of this level or higher: error, warning or notice")
 	flag.Parse()
 
 	if len(flag.Args()) >= 3 {
 		fmt.Println("Usage: checkbms [bmsPath/dirPath] [diffDirPath]")
-		os.Exit(1)
+		os.Exit(exitFailure)
+	}
+	if *format != "text" && *format != "json" && *format != "ndjson" && *format != "sarif" && *format != "junit" && *format != "html" {
+		fmt.Println("Error: Invalid format:", *format)
+		os.Exit(exitFailure)
+	}
+	if *jobs < 1 {
+		fmt.Println("Error: -j must be 1 or more:", *jobs)
+		os.Exit(exitFailure)
+	}
+	if *writeBaseline && *baselinePath == "" {
+		fmt.Println("Error: -write-baseline needs -baseline file path")
+		os.Exit(exitFailure)
+	}
+	parseLevel := func(name, value string) checkbms.AlertLevel {
+		if value == "" {
+			return ""
+		}
+		level, err := checkbms.ParseAlertLevel(value)
+		if err != nil {
+			fmt.Printf("Error: Invalid %s: %s\n", name, value)
+			os.Exit(exitFailure)
+		}
+		return level
 	}
+	failOnLevel := parseLevel("-fail-on", *failOn)
+	minLevelValue := parseLevel("-min-level", *minLevel)
 
 	if len(flag.Args()) == 2 {
+		if *format != "text" {
+			fmt.Println("Error: -format is not supported when comparing directories")
+			os.Exit(exitFailure)
+		}
 		if err := doDiffBmsDir(flag.Arg(0), flag.Arg(1), *lang); err != nil {
 			fmt.Println("Error: doDiffBmsDir:", err.Error())
-			os.Exit(1)
+			os.Exit(exitFailure)
 		}
 	} else {
 		path := "./"
@@ -33,62 +110,200 @@ func main() {
 		fInfo, err := os.Stat(path)
 		if err != nil {
 			fmt.Println("Error: Path is wrong:", err.Error())
-			os.Exit(1)
+			os.Exit(exitFailure)
 		}
 		path = filepath.Clean(path)
 
-		if fInfo.IsDir() {
-			if err := doCheckBmsDirectory(path, *doDiffCheck, *lang); err != nil {
+		opts := options{doDiffCheck: *doDiffCheck, lang: *lang, format: *format, baselinePath: *baselinePath, writeBaseline: *writeBaseline,
+			minLevel: minLevelValue, failOn: failOnLevel, jobs: *jobs}
+		opts.config, err = loadConfig(*configPath)
+		if err != nil {
+			fmt.Println("Error: Config is wrong:", err.Error())
+			os.Exit(exitFailure)
+		}
+		if *writeBaseline {
+			opts.baseline = checkbms.NewBaseline()
+		} else if *baselinePath != "" {
+			opts.baseline, err = checkbms.ReadBaseline(*baselinePath)
+			if err != nil {
+				fmt.Println("Error: Baseline is wrong:", err.Error())
+				os.Exit(exitFailure)
+			}
+		}
+
+		var cachePath string
+		if !*noCache {
+			opts.cache, cachePath = openCache()
+		}
+
+		if fInfo.IsDir() || checkbms.IsZipFile(path) {
+			if err := doCheckBmsDirectory(path, &opts); err != nil {
 				fmt.Println("Error: CheckBmsDirectory error:", err.Error())
-				os.Exit(1)
+				os.Exit(exitFailure)
 			}
 		} else if checkbms.IsBmsFile(path) {
-			if err := doCheckBmsFile(path, *lang); err != nil {
+			if err := doCheckBmsFile(path, &opts); err != nil {
 				fmt.Println("Error: CheckBmsFile error:", err.Error())
-				os.Exit(1)
+				os.Exit(exitFailure)
 			}
 		} else {
-			fmt.Println("Error: Entered path is not bms file or directory")
-			os.Exit(1)
+			fmt.Println("Error: Entered path is not bms file, directory or zip file")
+			os.Exit(exitFailure)
+		}
+		if opts.cache != nil {
+			if err := opts.cache.Save(cachePath); err != nil {
+				fmt.Fprintln(os.Stderr, "Warning: Cache cannot be saved:", err.Error())
+			}
+		}
+		if opts.hasScanError {
+			os.Exit(exitFailure)
+		}
+		if opts.hasFailure {
+			os.Exit(exitFindings)
 		}
 	}
+	os.Exit(exitOK)
 }
 
-func doCheckBmsDirectory(path string, doDiffCheck bool, lang string) error {
-	bmsDirs, err := checkbms.ScanDirectory(path)
-	if err != nil {
+// 全体の設定を読み込む。pathが空でユーザー設定フォルダにも設定ファイルが無ければデフォルトの設定
+func loadConfig(path string) (*checkbms.Config, error) {
+	if path == "" {
+		configDir, err := os.UserConfigDir()
+		if err != nil {
+			return checkbms.DefaultConfig(), nil
+		}
+		path = filepath.Join(configDir, "checkbms", "config.json")
+		if _, err := os.Stat(path); err != nil {
+			return checkbms.DefaultConfig(), nil
+		}
+	}
+	return checkbms.LoadConfig(path)
+}
+
+// ベースラインへの追加、またはベースラインにあるログの除去を行い、
+// -fail-on以上のログがあるか判定してから-min-level未満のログを取り除く
+func (opts *options) filterReport(report *checkbms.Report) {
+	if opts.baseline != nil {
+		if opts.writeBaseline {
+			opts.baseline.Add(report)
+		} else {
+			opts.baseline.Filter(report)
+		}
+	}
+	if opts.failOn != "" && report.HasLevel(opts.failOn) {
+		opts.hasFailure = true
+	}
+	if opts.minLevel != "" {
+		report.FilterLevel(opts.minLevel)
+	}
+}
+
+func doCheckBmsDirectory(path string, opts *options) error {
+	// Ctrl+Cで新しいフォルダのチェックを止める
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	results, err := checkbms.CheckDirectoriesWithCache(ctx, path, opts.jobs, opts.config, opts.doDiffCheck, opts.cache)
+	var unreadable checkbms.ScanErrors
+	if err != nil && !errors.As(err, &unreadable) {
 		return fmt.Errorf("Error: scanDirectory error: %s", err.Error())
 	}
-	for _, dir := range bmsDirs {
-		checkbms.CheckBmsDirectory(&dir, doDiffCheck)
+	partial := []checkbms.ScanErrors{}
+	defer func() {
+		if printScanErrors(unreadable, partial, opts.lang) {
+			opts.hasScanError = true
+		}
+	}()
 
-		var log string
-		for _, bmsFile := range dir.BmsFiles {
-			if len(bmsFile.Logs) > 0 {
-				log += bmsFile.LogStringWithLang(false, lang)
-				log += "\n\n"
-			}
+	report := checkbms.Report{Directories: []checkbms.DirectoryResult{}}
+	for checkResult := range results {
+		if checkResult.Err != nil {
+			unreadable = append(unreadable, checkbms.ScanError{Path: checkResult.Path, Err: checkResult.Err})
+			continue
 		}
-		for _, bmsonFile := range dir.BmsonFiles {
-			if len(bmsonFile.Logs) > 0 {
-				log += bmsonFile.LogStringWithLang(false, lang)
-				log += "\n\n"
+		if checkResult.Directory != nil && len(checkResult.Directory.ScanErrors) > 0 {
+			partial = append(partial, checkResult.Directory.ScanErrors)
+		}
+
+		dirReport := checkbms.Report{Directories: []checkbms.DirectoryResult{checkResult.Result}}
+		opts.filterReport(&dirReport)
+		result := dirReport.Directories[0]
+
+		switch opts.format {
+		case "text":
+			fmt.Printf("%s", directoryResultText(&result, opts.lang))
+		case "ndjson":
+			if err := checkbms.WriteNDJSON(os.Stdout, &result); err != nil {
+				return err
 			}
+		default:
+			report.Directories = append(report.Directories, result)
 		}
-		if len(dir.Logs) > 0 {
-			log += dir.LogStringWithLang(false, lang)
-			log += "\n\n"
+	}
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("Error: Canceled: %s", err.Error())
+	}
+	return opts.finish(&report)
+}
+
+// ユーザーのキャッシュフォルダのキャッシュを開く。開けなければキャッシュを使わない
+func openCache() (*checkbms.Cache, string) {
+	path, err := checkbms.DefaultCachePath()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Warning: Cache is not used:", err.Error())
+		return nil, ""
+	}
+	cache, err := checkbms.OpenCache(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Warning: Cache is not used:", err.Error())
+		return nil, ""
+	}
+	return cache, path
+}
+
+// ScanDirectoryで読み込めなかったフォルダを、読み込めたフォルダと分けて返す
+func scanDirectory(path string) ([]checkbms.Directory, checkbms.ScanErrors, error) {
+	bmsDirs, err := checkbms.ScanDirectory(path)
+	var scanErrors checkbms.ScanErrors
+	if errors.As(err, &scanErrors) {
+		return bmsDirs, scanErrors, nil
+	}
+	return bmsDirs, nil, err
+}
+
+// 読み込めなかったフォルダと、一部のファイルを読み込めなかったフォルダ(partialの要素がフォルダごとのScanErrors)の
+// 一覧を標準エラー出力に出す。何か出力したらtrue
+func printScanErrors(unreadable checkbms.ScanErrors, partial []checkbms.ScanErrors, lang string) bool {
+	if len(unreadable) == 0 && len(partial) == 0 {
+		return false
+	}
+
+	if lang == "ja" {
+		fmt.Fprintf(os.Stderr, "## 読み込めなかったフォルダ: %d, 一部を読み込めなかったフォルダ: %d\n", len(unreadable), len(partial))
+	} else {
+		fmt.Fprintf(os.Stderr, "## Unreadable folders: %d, partially unreadable folders: %d\n", len(unreadable), len(partial))
+	}
+	for _, se := range unreadable {
+		fmt.Fprintf(os.Stderr, "%s\n", se.Error())
+	}
+	for _, scanErrors := range partial {
+		for _, se := range scanErrors {
+			fmt.Fprintf(os.Stderr, "%s\n", se.Error())
 		}
-		fmt.Printf("%s", log)
 	}
-	return nil
+	return true
 }
 
-func doCheckBmsFile(path, lang string) error {
+func doCheckBmsFile(path string, opts *options) error {
 	bmsFileBase, err := checkbms.ReadBmsFileBase(path)
 	if err != nil {
 		return fmt.Errorf("Error: ReadBmsFile error: %s", err.Error())
 	}
+	if bmsFileBase.Config, err = opts.config.ForDirectory(filepath.Dir(path)); err != nil {
+		return fmt.Errorf("Error: Config is wrong: %s", err.Error())
+	}
+	bmsFileBase.Cache = opts.cache
+	var report checkbms.Report
 	if checkbms.IsBmsonFile(path) {
 		bmsonFile := checkbms.NewBmsonFile(bmsFileBase)
 		err = bmsonFile.ScanBmsonFile()
@@ -96,9 +311,7 @@ func doCheckBmsFile(path, lang string) error {
 			return fmt.Errorf("Error: ScanBmsonFile error: %s", err.Error())
 		}
 		checkbms.CheckBmsonFile(bmsonFile)
-		if len(bmsonFile.Logs) > 0 {
-			fmt.Println(bmsonFile.LogStringWithLang(false, lang))
-		}
+		report.BmsonFiles = append(report.BmsonFiles, checkbms.NewBmsonFileResult(bmsonFile))
 	} else {
 		bmsFile := checkbms.NewBmsFile(bmsFileBase)
 		err = bmsFile.ScanBmsFile()
@@ -106,13 +319,119 @@ func doCheckBmsFile(path, lang string) error {
 			return fmt.Errorf("Error: ScanBmsFile error: %s", err.Error())
 		}
 		checkbms.CheckBmsFile(bmsFile)
-		if len(bmsFile.Logs) > 0 {
-			fmt.Println(bmsFile.LogStringWithLang(false, lang))
+		report.BmsFiles = append(report.BmsFiles, checkbms.NewBmsFileResult(&bmsFile.BmsFileBase))
+	}
+	opts.filterReport(&report)
+
+	switch opts.format {
+	case "text":
+		for i := range report.BmsFiles {
+			if len(report.BmsFiles[i].Diagnostics) > 0 {
+				fmt.Println(bmsFileResultText(&report.BmsFiles[i], false, opts.lang))
+			}
+		}
+		for i := range report.BmsonFiles {
+			if len(report.BmsonFiles[i].Diagnostics) > 0 {
+				fmt.Println(bmsFileResultText(&report.BmsonFiles[i], true, opts.lang))
+			}
+		}
+	case "ndjson":
+		for _, result := range append(report.BmsFiles, report.BmsonFiles...) {
+			if err := checkbms.WriteNDJSON(os.Stdout, &result); err != nil {
+				return err
+			}
+		}
+		report = checkbms.Report{}
+	}
+	return opts.finish(&report)
+}
+
+// 全てのチェックが終わった後に、まとめて出力する形式のreportとベースラインを出力する
+func (opts *options) finish(report *checkbms.Report) error {
+	if opts.baseline != nil && !opts.writeBaseline {
+		report.FixedBaselineEntries = opts.baseline.Fixed()
+	}
+
+	var err error
+	switch opts.format {
+	case "text":
+		fmt.Printf("%s", fixedBaselineEntriesText(report.FixedBaselineEntries, opts.lang))
+	case "ndjson":
+		if len(report.FixedBaselineEntries) > 0 {
+			err = checkbms.WriteNDJSON(os.Stdout, report)
+		}
+	case "json":
+		err = checkbms.WriteJSON(os.Stdout, report)
+	case "sarif":
+		err = checkbms.WriteSARIF(os.Stdout, report, opts.lang)
+	case "junit":
+		err = checkbms.WriteJUnit(os.Stdout, report, opts.lang)
+	case "html":
+		err = checkbms.WriteHTML(os.Stdout, report, opts.lang)
+	}
+	if err != nil {
+		return err
+	}
+	if opts.format != "text" && opts.format != "json" && opts.format != "ndjson" {
+		// 出力形式に修正済みのエントリを含められないので標準エラー出力に出す
+		fmt.Fprintf(os.Stderr, "%s", fixedBaselineEntriesText(report.FixedBaselineEntries, opts.lang))
+	}
+
+	if opts.writeBaseline {
+		file, err := os.Create(opts.baselinePath)
+		if err != nil {
+			return err
 		}
+		defer file.Close()
+		return checkbms.WriteBaseline(file, opts.baseline)
 	}
 	return nil
 }
 
+func bmsFileResultText(result *checkbms.BmsFileResult, isBmson bool, lang string) string {
+	bmsFileBase := checkbms.BmsFileBase{File: checkbms.File{Path: result.Path}, Logs: result.Diagnostics}
+	if isBmson {
+		return bmsFileBase.LogStringWithLang(false, lang)
+	}
+	return checkbms.BmsFile{BmsFileBase: bmsFileBase}.LogStringWithLang(false, lang)
+}
+
+func directoryResultText(result *checkbms.DirectoryResult, lang string) string {
+	var log string
+	for i := range result.BmsFiles {
+		if len(result.BmsFiles[i].Diagnostics) > 0 {
+			log += bmsFileResultText(&result.BmsFiles[i], false, lang)
+			log += "\n\n"
+		}
+	}
+	for i := range result.BmsonFiles {
+		if len(result.BmsonFiles[i].Diagnostics) > 0 {
+			log += bmsFileResultText(&result.BmsonFiles[i], true, lang)
+			log += "\n\n"
+		}
+	}
+	if len(result.Diagnostics) > 0 {
+		dir := checkbms.Directory{File: checkbms.File{Path: result.Path}, Logs: result.Diagnostics}
+		log += dir.LogStringWithLang(false, lang)
+		log += "\n\n"
+	}
+	return log
+}
+
+func fixedBaselineEntriesText(entries []checkbms.BaselineEntry, lang string) string {
+	if len(entries) == 0 {
+		return ""
+	}
+	str := "## Fixed baseline entries\n"
+	if lang == "ja" {
+		str = "## 修正されたベースラインのエントリ\n"
+	}
+	for _, entry := range entries {
+		str += fmt.Sprintf("%s: %s: %s\n", entry.Path, entry.Rule, entry.Message)
+	}
+	return str
+}
+
 func doDiffBmsDir(dirPath1, dirPath2, lang string) error {
 	dirPath1, dirPath2 = filepath.Clean(dirPath1), filepath.Clean(dirPath2)
 	_, err := os.Stat(dirPath1)
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/Shimi9999/checkbms"
+)
+
+// zipでアップロードされた曲フォルダをチェックして、結果をJSONで返すHTTPサーバー
+type server struct {
+	config           *checkbms.Config
+	maxUploadSize    int64
+	maxExtractedSize int64
+	slots            chan struct{} // 同時にチェックするリクエストの枠
+	// trueならアップロードされたzip内の.checkbms.jsonと抑制コメントに従う。falseなら投稿者がチェックを無効にできないように無視する
+	allowPackageConfig bool
+}
+
+// checkbms serve [-addr host:port] [-max-upload MB] [-max-extracted MB] [-max-concurrent N] [-config path] [-allow-package-config]
+func doServe(args []string) int {
+	flagSet := flag.NewFlagSet("serve", flag.ExitOnError)
+	addr := flagSet.String("addr", "localhost:8080", "address to listen on")
+	maxUpload := flagSet.Int64("max-upload", 200, "maximum size of an uploaded zip in MB")
+	maxExtracted := flagSet.Int64("max-extracted", 1000, "maximum total size of the extracted files of a zip in MB")
+	maxConcurrent := flagSet.Int("max-concurrent", runtime.NumCPU(), "maximum number of uploads checked at the same time. Others get 503")
+	configPath := flagSet.String("config", "", "config file path (default: checkbms/config.json in the user config directory if it exists)")
+	allowPackageConfig := flagSet.Bool("allow-package-config", false, "follow "+checkbms.CONFIG_FILENAME+" and suppression comments in uploaded zips. By default they are ignored")
+	flagSet.Parse(args)
+
+	if len(flagSet.Args()) > 0 {
+		fmt.Println("Usage: checkbms serve [-addr host:port] [-max-upload MB] [-max-extracted MB] [-max-concurrent N] [-config path] [-allow-package-config]")
+		return exitFailure
+	}
+	if *maxUpload < 1 || *maxExtracted < 1 || *maxConcurrent < 1 {
+		fmt.Println("Error: -max-upload, -max-extracted and -max-concurrent must be 1 or more")
+		return exitFailure
+	}
+	s := &server{maxUploadSize: *maxUpload << 20, maxExtractedSize: *maxExtracted << 20, slots: make(chan struct{}, *maxConcurrent), allowPackageConfig: *allowPackageConfig}
+	var err error
+	s.config, err = loadConfig(*configPath)
+	if err != nil {
+		fmt.Println("Error: Config is wrong:", err.Error())
+		return exitFailure
+	}
+	s.config.IgnoreSuppressions = !s.allowPackageConfig
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/check", s.handleCheck)
+	httpServer := &http.Server{Addr: *addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	// Ctrl+Cで新しいリクエストを止め、チェック中のリクエストを待ってから終了する
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		httpServer.Shutdown(shutdownCtx)
+	}()
+
+	fmt.Fprintf(os.Stderr, "Listening on http://%s/check (Ctrl+C to stop)\n", *addr)
+	if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		fmt.Println("Error: Server error:", err.Error())
+		return exitFailure
+	}
+	return exitOK
+}
+
+// POST /check: 本文がzip(application/zip)、またはmultipart/form-dataのfileフィールドがzip
+func (s *server) handleCheck(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeHTTPError(w, http.StatusMethodNotAllowed, "only POST is allowed")
+		return
+	}
+	select {
+	case s.slots <- struct{}{}:
+		defer func() { <-s.slots }()
+	default:
+		w.Header().Set("Retry-After", "1")
+		writeHTTPError(w, http.StatusServiceUnavailable, "too many uploads are being checked")
+		return
+	}
+
+	tmpDir, err := os.MkdirTemp("", "checkbms-serve-")
+	if err != nil {
+		writeHTTPError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer os.RemoveAll(tmpDir)
+
+	zipPath := filepath.Join(tmpDir, "upload.zip")
+	r.Body = http.MaxBytesReader(w, r.Body, s.maxUploadSize)
+	if status, err := saveUpload(r, zipPath); err != nil {
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			status = http.StatusRequestEntityTooLarge
+		}
+		writeHTTPError(w, status, err.Error())
+		return
+	}
+
+	zipReader, err := zip.OpenReader(zipPath)
+	if err != nil {
+		writeHTTPError(w, http.StatusBadRequest, "invalid zip: "+err.Error())
+		return
+	}
+	songDir := filepath.Join(tmpDir, "song")
+	err = checkbms.ExtractZip(&zipReader.Reader, songDir, s.maxExtractedSize)
+	zipReader.Close()
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, checkbms.ErrZipTooLarge) {
+			status = http.StatusRequestEntityTooLarge
+		}
+		writeHTTPError(w, status, err.Error())
+		return
+	}
+	if err := os.Remove(zipPath); err != nil {
+		writeHTTPError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response, status, err := s.check(r.Context(), songDir)
+	if err != nil {
+		writeHTTPError(w, status, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if len(response.Directories) == 0 {
+		// 読み込めなかったフォルダがあれば、それがBMSフォルダだったかもしれないので理由と共に返す
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		json.NewEncoder(w).Encode(struct {
+			Error      string          `json:"error"`
+			ScanErrors []scanErrorJSON `json:"scanErrors,omitempty"`
+		}{"no bms folder in zip", response.ScanErrors})
+		return
+	}
+	// checkbms.WriteJSONと同じ書式で、scanErrorsを加えて書き出す
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.SetEscapeHTML(false)
+	encoder.Encode(response)
+}
+
+// checkbms.Reportに、読み込めなかったフォルダを加えたレスポンス
+type checkResponse struct {
+	*checkbms.Report
+	ScanErrors []scanErrorJSON `json:"scanErrors,omitempty"`
+}
+
+type scanErrorJSON struct {
+	Path  string `json:"path"`
+	Error string `json:"error"`
+}
+
+// アップロードされたzipをpathに保存する。失敗したらHTTPのステータスと共にエラーを返す
+func saveUpload(r *http.Request, path string) (int, error) {
+	body := io.Reader(r.Body)
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "multipart/form-data" {
+		reader, err := r.MultipartReader()
+		if err != nil {
+			return http.StatusBadRequest, err
+		}
+		for {
+			part, err := reader.NextPart()
+			if err != nil {
+				if err == io.EOF {
+					return http.StatusBadRequest, fmt.Errorf("file field is missing")
+				}
+				return http.StatusBadRequest, err
+			}
+			if part.FormName() == "file" {
+				body = part
+				break
+			}
+		}
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	defer file.Close()
+	if _, err := io.Copy(file, body); err != nil {
+		return http.StatusBadRequest, err
+	}
+	return http.StatusOK, nil
+}
+
+// 展開したフォルダをチェックする。結果のパスは展開したフォルダからの相対パスにする。
+// 一部のファイルを読み込めなかったフォルダは、そのフォルダの診断結果(dir.file-unreadable)に含まれる。
+// 失敗したらHTTPのステータスと共にエラーを返す
+func (s *server) check(ctx context.Context, root string) (*checkResponse, int, error) {
+	bmsDirs, err := checkbms.ScanDirectory(root)
+	var scanErrors checkbms.ScanErrors
+	if err != nil && !errors.As(err, &scanErrors) {
+		return nil, http.StatusInternalServerError, err
+	}
+	report := &checkbms.Report{Directories: []checkbms.DirectoryResult{}}
+	response := &checkResponse{Report: report}
+	for _, se := range scanErrors {
+		response.ScanErrors = append(response.ScanErrors, scanErrorJSON{
+			Path:  relativePath(se.Path, root),
+			Error: strings.ReplaceAll(se.Err.Error(), root+string(filepath.Separator), ""),
+		})
+	}
+	for i := range bmsDirs {
+		// クライアントが切断したらチェックを止める
+		if err := ctx.Err(); err != nil {
+			return nil, http.StatusInternalServerError, err
+		}
+		bmsDirs[i].Config = s.config
+		if s.allowPackageConfig {
+			if bmsDirs[i].Config, err = s.config.ForDirectory(bmsDirs[i].Path); err != nil {
+				// zip内の設定ファイルが間違っている
+				return nil, http.StatusUnprocessableEntity, errors.New(strings.ReplaceAll(err.Error(), root+string(filepath.Separator), ""))
+			}
+		}
+		checkbms.CheckBmsDirectory(&bmsDirs[i], false)
+		report.Directories = append(report.Directories, checkbms.NewDirectoryResult(&bmsDirs[i]))
+	}
+	relativizeReport(report, root)
+	return response, http.StatusOK, nil
+}
+
+// rootからの相対パスをスラッシュ区切りで返す
+func relativePath(path, root string) string {
+	if path == root {
+		return "."
+	}
+	return filepath.ToSlash(strings.TrimPrefix(path, root+string(filepath.Separator)))
+}
+
+// サーバーの一時フォルダのパスを返さないように、reportのパスとメッセージ中のパスをrootからの相対パスにする
+func relativizeReport(report *checkbms.Report, root string) {
+	prefix := root + string(filepath.Separator)
+	relativizeLogs := func(logs checkbms.Logs) {
+		for i := range logs {
+			logs[i].Path = relativePath(logs[i].Path, root)
+			logs[i].Message = strings.ReplaceAll(logs[i].Message, prefix, "")
+			logs[i].Message_ja = strings.ReplaceAll(logs[i].Message_ja, prefix, "")
+			for j := range logs[i].SubLogs {
+				logs[i].SubLogs[j] = strings.ReplaceAll(logs[i].SubLogs[j], prefix, "")
+			}
+			for j := range logs[i].RelatedPaths {
+				logs[i].RelatedPaths[j] = relativePath(logs[i].RelatedPaths[j], root)
+			}
+		}
+	}
+	for d := range report.Directories {
+		dir := &report.Directories[d]
+		dir.Path = relativePath(dir.Path, root)
+		relativizeLogs(dir.Diagnostics)
+		for _, results := range [][]checkbms.BmsFileResult{dir.BmsFiles, dir.BmsonFiles} {
+			for i := range results {
+				results[i].Path = relativePath(results[i].Path, root)
+				relativizeLogs(results[i].Diagnostics)
+			}
+		}
+	}
+}
+
+func writeHTTPError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/Shimi9999/checkbms"
+)
+
+// ファイル名と内容の組からzipを作る
+func newTestZip(t *testing.T, files map[string]string) []byte {
+	var buf bytes.Buffer
+	zipWriter := zip.NewWriter(&buf)
+	for name, text := range files {
+		writer, err := zipWriter.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := writer.Write([]byte(text)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zipWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func newTestServer(allowPackageConfig bool) *server {
+	config := checkbms.DefaultConfig()
+	config.IgnoreSuppressions = !allowPackageConfig
+	return &server{config: config, maxUploadSize: 1 << 20, maxExtractedSize: 1 << 20, slots: make(chan struct{}, 1), allowPackageConfig: allowPackageConfig}
+}
+
+func postZip(s *server, body []byte) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(http.MethodPost, "/check", bytes.NewReader(body))
+	request.Header.Set("Content-Type", "application/zip")
+	recorder := httptest.NewRecorder()
+	s.handleCheck(recorder, request)
+	return recorder
+}
+
+// フォルダごとの、レスポンスに含まれるルールIDの一覧
+func responseRules(t *testing.T, recorder *httptest.ResponseRecorder) map[string]map[string]bool {
+	var report checkbms.Report
+	if err := json.Unmarshal(recorder.Body.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	rules := map[string]map[string]bool{}
+	for _, dir := range report.Directories {
+		rules[dir.Path] = map[string]bool{}
+		for _, log := range dir.Diagnostics {
+			rules[dir.Path][log.Rule] = true
+		}
+		for _, bmsFile := range dir.BmsFiles {
+			for _, log := range bmsFile.Diagnostics {
+				rules[dir.Path][log.Rule] = true
+			}
+		}
+	}
+	return rules
+}
+
+// song1は抑制コメントで、song2は.checkbms.jsonでbms.rank-unusualを無効にしている
+var testSongZip = map[string]string{
+	"song1/a.bms":          "#RANK 0\r\n%checkbms-disable bms.rank-unusual\r\n",
+	"song2/a.bms":          "#RANK 0\r\n",
+	"song2/.checkbms.json": `{"rules": {"bms.rank-unusual": {"enabled": false}}}`,
+}
+
+func TestHandleCheck(t *testing.T) {
+	recorder := postZip(newTestServer(false), newTestZip(t, testSongZip))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", recorder.Code, http.StatusOK, recorder.Body.String())
+	}
+	var report checkbms.Report
+	if err := json.Unmarshal(recorder.Body.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Directories) != 2 || report.Directories[0].Path != "song1" ||
+		len(report.Directories[0].BmsFiles) != 1 || report.Directories[0].BmsFiles[0].Path != "song1/a.bms" {
+		t.Errorf("paths are not relative to the zip root: %s", recorder.Body.String())
+	}
+	// 投稿されたzipの抑制コメントと設定ファイルは無視する
+	rules := responseRules(t, recorder)
+	for _, dirPath := range []string{"song1", "song2"} {
+		if !rules[dirPath]["bms.rank-unusual"] {
+			t.Errorf("%s: bms.rank-unusual is disabled by the uploaded zip: %s", dirPath, recorder.Body.String())
+		}
+	}
+
+	recorder = postZip(newTestServer(true), newTestZip(t, testSongZip))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", recorder.Code, http.StatusOK, recorder.Body.String())
+	}
+	rules = responseRules(t, recorder)
+	for _, dirPath := range []string{"song1", "song2"} {
+		if rules[dirPath]["bms.rank-unusual"] {
+			t.Errorf("%s: bms.rank-unusual is not disabled with -allow-package-config: %s", dirPath, recorder.Body.String())
+		}
+	}
+}
+
+func TestHandleCheckMultipart(t *testing.T) {
+	var body bytes.Buffer
+	multipartWriter := multipart.NewWriter(&body)
+	writer, err := multipartWriter.CreateFormFile("file", "song.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	writer.Write(newTestZip(t, testSongZip))
+	multipartWriter.Close()
+
+	request := httptest.NewRequest(http.MethodPost, "/check", &body)
+	request.Header.Set("Content-Type", multipartWriter.FormDataContentType())
+	recorder := httptest.NewRecorder()
+	newTestServer(false).handleCheck(recorder, request)
+	if recorder.Code != http.StatusOK {
+		t.Errorf("status = %d, want %d: %s", recorder.Code, http.StatusOK, recorder.Body.String())
+	}
+}
+
+func TestHandleCheckStatus(t *testing.T) {
+	tooLargeUpload := newTestServer(false)
+	tooLargeUpload.maxUploadSize = 10
+	tooLargeExtracted := newTestServer(false)
+	tooLargeExtracted.maxExtractedSize = 10
+	busy := newTestServer(false)
+	busy.slots <- struct{}{}
+
+	for _, tc := range []struct {
+		name   string
+		server *server
+		body   []byte
+		want   int
+	}{
+		{"upload too large", tooLargeUpload, newTestZip(t, testSongZip), http.StatusRequestEntityTooLarge},
+		{"extracted too large", tooLargeExtracted, newTestZip(t, map[string]string{"song/a.bms": string(make([]byte, 100))}), http.StatusRequestEntityTooLarge},
+		{"zip slip", newTestServer(false), newTestZip(t, map[string]string{"../a.bms": "#TITLE a\r\n"}), http.StatusBadRequest},
+		{"not zip", newTestServer(false), []byte("not zip"), http.StatusBadRequest},
+		{"no bms folder", newTestServer(false), newTestZip(t, map[string]string{"readme.txt": "readme"}), http.StatusUnprocessableEntity},
+		{"too many uploads", busy, newTestZip(t, testSongZip), http.StatusServiceUnavailable},
+		{"invalid package config", newTestServer(true), newTestZip(t, map[string]string{"song/a.bms": "#TITLE a\r\n", "song/.checkbms.json": "{"}), http.StatusUnprocessableEntity},
+	} {
+		recorder := postZip(tc.server, tc.body)
+		if recorder.Code != tc.want {
+			t.Errorf("%s: status = %d, want %d: %s", tc.name, recorder.Code, tc.want, recorder.Body.String())
+		}
+		var response struct {
+			Error string `json:"error"`
+		}
+		if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil || response.Error == "" {
+			t.Errorf("%s: error is not returned as JSON: %s", tc.name, recorder.Body.String())
+		}
+		if strings.Contains(response.Error, os.TempDir()) {
+			t.Errorf("%s: error contains the temporary folder: %s", tc.name, response.Error)
+		}
+	}
+	if retryAfter := postZip(busy, nil).Header().Get("Retry-After"); retryAfter == "" {
+		t.Errorf("Retry-After is not set when too many uploads are being checked")
+	}
+
+	recorder := httptest.NewRecorder()
+	newTestServer(false).handleCheck(recorder, httptest.NewRequest(http.MethodGet, "/check", nil))
+	if recorder.Code != http.StatusMethodNotAllowed || recorder.Header().Get("Allow") != http.MethodPost {
+		t.Errorf("GET: status = %d, Allow = %q", recorder.Code, recorder.Header().Get("Allow"))
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/Shimi9999/checkbms"
+)
+
+// checkbms stats [-format text|json] [bmsPath/dirPath]
+func doStats(args []string) int {
+	flagSet := flag.NewFlagSet("stats", flag.ExitOnError)
+	format := flagSet.String("format", "text", "output format: text or json")
+	flagSet.Parse(args)
+
+	if len(flagSet.Args()) >= 2 {
+		fmt.Println("Usage: checkbms stats [-format text|json] [bmsPath/dirPath]")
+		return exitFailure
+	}
+	if *format != "text" && *format != "json" {
+		fmt.Println("Error: Invalid format:", *format)
+		return exitFailure
+	}
+	path := "./"
+	if len(flagSet.Args()) == 1 {
+		path = flagSet.Arg(0)
+	}
+	fInfo, err := os.Stat(path)
+	if err != nil {
+		fmt.Println("Error: Path is wrong:", err.Error())
+		return exitFailure
+	}
+	path = filepath.Clean(path)
+
+	stats := []checkbms.ChartStats{}
+	hasScanError := false
+	if fInfo.IsDir() || checkbms.IsZipFile(path) {
+		bmsDirs, scanErrors, err := scanDirectory(path)
+		if err != nil {
+			fmt.Println("Error: scanDirectory error:", err.Error())
+			return exitFailure
+		}
+		partial := []checkbms.ScanErrors{}
+		for _, dir := range bmsDirs {
+			if len(dir.ScanErrors) > 0 {
+				partial = append(partial, dir.ScanErrors)
+			}
+		}
+		hasScanError = printScanErrors(scanErrors, partial, "en")
+		for _, dir := range bmsDirs {
+			for i := range dir.BmsFiles {
+				stats = append(stats, checkbms.CalculateStats(&dir.BmsFiles[i]))
+			}
+			for i := range dir.BmsonFiles {
+				if !dir.BmsonFiles[i].IsInvalid {
+					stats = append(stats, checkbms.CalculateStatsBmson(&dir.BmsonFiles[i]))
+				}
+			}
+			dir.Close()
+		}
+	} else if checkbms.IsBmsFile(path) {
+		bmsFileBase, err := checkbms.ReadBmsFileBase(path)
+		if err != nil {
+			fmt.Println("Error: ReadBmsFile error:", err.Error())
+			return exitFailure
+		}
+		if checkbms.IsBmsonFile(path) {
+			bmsonFile := checkbms.NewBmsonFile(bmsFileBase)
+			if err := bmsonFile.ScanBmsonFile(); err != nil {
+				fmt.Println("Error: ScanBmsonFile error:", err.Error())
+				return exitFailure
+			}
+			if bmsonFile.IsInvalid {
+				fmt.Println("Error: Invalid bmson file:", path)
+				return exitFailure
+			}
+			stats = append(stats, checkbms.CalculateStatsBmson(bmsonFile))
+		} else {
+			bmsFile := checkbms.NewBmsFile(bmsFileBase)
+			if err := bmsFile.ScanBmsFile(); err != nil {
+				fmt.Println("Error: ScanBmsFile error:", err.Error())
+				return exitFailure
+			}
+			stats = append(stats, checkbms.CalculateStats(bmsFile))
+		}
+	} else {
+		fmt.Println("Error: Entered path is not bms file, directory or zip file")
+		return exitFailure
+	}
+
+	if *format == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.SetEscapeHTML(false)
+		if err := encoder.Encode(stats); err != nil {
+			fmt.Println("Error:", err.Error())
+			return exitFailure
+		}
+	} else {
+		for _, s := range stats {
+			fmt.Println(s.String())
+		}
+	}
+	if hasScanError {
+		return exitFailure
+	}
+	return exitOK
+}
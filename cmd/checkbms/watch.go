@@ -0,0 +1,320 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Shimi9999/checkbms"
+	"github.com/fsnotify/fsnotify"
+)
+
+// ファイルの変更を監視して、変更のあったBMSフォルダ(ファイルを指定した場合はそのファイル)だけをチェックし直す
+type watcher struct {
+	root    string
+	isFile  bool
+	lang    string
+	config  *checkbms.Config
+	cache   *checkbms.Cache          // 変更の無い譜面と音声ファイルのチェックを省く。ファイルには保存しない
+	logs    map[string]checkbms.Logs // BMSフォルダ(またはファイル)ごとの前回のログ
+	watcher *fsnotify.Watcher
+}
+
+// checkbms watch [-lang en|ja] [-config path] [-debounce duration] [dirPath/bmsPath]
+func doWatch(args []string) int {
+	flagSet := flag.NewFlagSet("watch", flag.ExitOnError)
+	lang := flagSet.String("lang", "en", "log language")
+	configPath := flagSet.String("config", "", "config file path (default: checkbms/config.json in the user config directory if it exists)")
+	debounce := flagSet.Duration("debounce", 300*time.Millisecond, "wait time after the last change before checking again")
+	flagSet.Parse(args)
+
+	if len(flagSet.Args()) >= 2 {
+		fmt.Println("Usage: checkbms watch [-lang en|ja] [-config path] [-debounce duration] [dirPath/bmsPath]")
+		return exitFailure
+	}
+	if *debounce < 0 {
+		fmt.Println("Error: -debounce must be 0 or more:", *debounce)
+		return exitFailure
+	}
+	path := "./"
+	if len(flagSet.Args()) == 1 {
+		path = flagSet.Arg(0)
+	}
+	fInfo, err := os.Stat(path)
+	if err != nil {
+		fmt.Println("Error: Path is wrong:", err.Error())
+		return exitFailure
+	}
+	if !fInfo.IsDir() && !checkbms.IsBmsFile(path) {
+		fmt.Println("Error: Entered path is not bms file or directory")
+		return exitFailure
+	}
+
+	w := &watcher{root: filepath.Clean(path), isFile: !fInfo.IsDir(), lang: *lang, cache: checkbms.NewCache(), logs: map[string]checkbms.Logs{}}
+	w.config, err = loadConfig(*configPath)
+	if err != nil {
+		fmt.Println("Error: Config is wrong:", err.Error())
+		return exitFailure
+	}
+	w.watcher, err = fsnotify.NewWatcher()
+	if err != nil {
+		fmt.Println("Error: Watcher cannot be started:", err.Error())
+		return exitFailure
+	}
+	defer w.watcher.Close()
+
+	// 監視を始めてから最初のチェックをして、その間の変更を取りこぼさないようにする
+	if w.isFile {
+		// エディタが別のファイルに書いて置き換えても追えるように、ファイルのあるフォルダを監視する
+		w.addWatch(filepath.Dir(w.root))
+		w.check(w.root)
+	} else {
+		w.addWatches(w.root)
+		dirPaths, err := checkbms.FindBmsDirectories(w.root)
+		if dirPaths == nil && err != nil {
+			fmt.Println("Error: FindBmsDirectories error:", err.Error())
+			return exitFailure
+		}
+		for _, dirPath := range dirPaths {
+			w.check(dirPath)
+		}
+	}
+	if w.lang == "ja" {
+		fmt.Fprintf(os.Stderr, "%sを監視しています(Ctrl+Cで終了)\n", w.root)
+	} else {
+		fmt.Fprintf(os.Stderr, "Watching %s (Ctrl+C to stop)\n", w.root)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	w.run(ctx, *debounce)
+	return exitOK
+}
+
+// 変更が続いている間は待ち、最後の変更からdebounce経ったら変更のあったフォルダをまとめてチェックする
+func (w *watcher) run(ctx context.Context, debounce time.Duration) {
+	timer := time.NewTimer(debounce)
+	if !timer.Stop() {
+		<-timer.C
+	}
+	pending := map[string]bool{}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-w.watcher.Events:
+			if !ok {
+				return
+			}
+			if event.Op == fsnotify.Chmod {
+				continue
+			}
+			targets := w.targetsOf(event)
+			if len(targets) == 0 {
+				continue
+			}
+			for _, target := range targets {
+				pending[target] = true
+			}
+			timer.Reset(debounce)
+		case err, ok := <-w.watcher.Errors:
+			if !ok {
+				return
+			}
+			fmt.Fprintln(os.Stderr, "Warning: Watcher error:", err.Error())
+		case <-timer.C:
+			targets := []string{}
+			for target := range pending {
+				targets = append(targets, target)
+			}
+			sort.Strings(targets)
+			pending = map[string]bool{}
+			for _, target := range targets {
+				w.check(target)
+			}
+		}
+	}
+}
+
+// 変更されたパスから、チェックし直すBMSフォルダ(またはファイル)を求める
+func (w *watcher) targetsOf(event fsnotify.Event) []string {
+	path := filepath.Clean(event.Name)
+	if w.isFile {
+		if path == w.root {
+			return []string{w.root}
+		}
+		return nil
+	}
+
+	if event.Has(fsnotify.Create) {
+		if fInfo, err := os.Stat(path); err == nil && fInfo.IsDir() {
+			w.addWatches(path)
+		}
+	}
+	targets := []string{}
+	if event.Has(fsnotify.Remove) || event.Has(fsnotify.Rename) {
+		// 消えたフォルダの中にあったBMSフォルダ
+		for dirPath := range w.logs {
+			if strings.HasPrefix(dirPath, path+string(filepath.Separator)) {
+				targets = append(targets, dirPath)
+			}
+		}
+	}
+	if target := w.bmsDirectoryOf(path); target != "" {
+		targets = append(targets, target)
+	} else if event.Has(fsnotify.Create) {
+		// BMSファイルを含むフォルダが移動してきた場合
+		dirPaths, _ := checkbms.FindBmsDirectories(path)
+		targets = append(targets, dirPaths...)
+	}
+	return targets
+}
+
+// pathを含むBMSフォルダ。FindBmsDirectoriesと同じく、rootに近いものを優先する。無ければ空
+func (w *watcher) bmsDirectoryOf(path string) string {
+	rel, err := filepath.Rel(w.root, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return ""
+	}
+	dirPath := w.root
+	names := []string{}
+	if rel != "." {
+		names = strings.Split(rel, string(filepath.Separator))
+	}
+	for i := 0; ; i++ {
+		if _, ok := w.logs[dirPath]; ok || checkbms.IsBmsDirectory(dirPath) {
+			return dirPath
+		}
+		if i >= len(names) {
+			return ""
+		}
+		dirPath = filepath.Join(dirPath, names[i])
+	}
+}
+
+func (w *watcher) addWatch(path string) {
+	if err := w.watcher.Add(path); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %s cannot be watched: %s\n", path, err.Error())
+	}
+}
+
+// fsnotifyはサブフォルダを監視しないので、path以下の全てのフォルダを追加する
+func (w *watcher) addWatches(path string) {
+	filepath.WalkDir(path, func(filePath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %s cannot be watched: %s\n", filePath, err.Error())
+			return nil
+		}
+		if d.IsDir() {
+			w.addWatch(filePath)
+		}
+		return nil
+	})
+}
+
+// targetをチェックし直して、前回から増えたログと無くなったログを出力する
+func (w *watcher) check(target string) {
+	var logs checkbms.Logs
+	var err error
+	if w.isFile {
+		logs, err = w.checkBmsFile(target)
+	} else {
+		logs, err = w.checkBmsDirectory(target)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s: %s\n", target, err.Error())
+		return
+	}
+
+	appeared, disappeared := checkbms.DiffLogs(w.logs[target], logs)
+	if logs == nil {
+		delete(w.logs, target)
+	} else {
+		w.logs[target] = logs
+	}
+	if len(appeared) == 0 && len(disappeared) == 0 {
+		return
+	}
+	fmt.Printf("## %s %s (+%d -%d)\n", time.Now().Format("15:04:05"), target, len(appeared), len(disappeared))
+	for _, log := range appeared {
+		fmt.Println(watchLogText("+", log, w.lang))
+	}
+	for _, log := range disappeared {
+		fmt.Println(watchLogText("-", log, w.lang))
+	}
+}
+
+// BMSフォルダでなくなっていればnil
+func (w *watcher) checkBmsDirectory(path string) (checkbms.Logs, error) {
+	if !checkbms.IsBmsDirectory(path) {
+		return nil, nil
+	}
+	dir, err := checkbms.ScanBmsDirectory(path, true, true)
+	if err != nil {
+		return nil, err
+	}
+	for _, se := range dir.ScanErrors {
+		fmt.Fprintf(os.Stderr, "%s\n", se.Error())
+	}
+	if dir.Config, err = w.config.ForDirectory(path); err != nil {
+		return nil, err
+	}
+	dir.Cache = w.cache
+	checkbms.CheckBmsDirectory(dir, false)
+
+	result := checkbms.NewDirectoryResult(dir)
+	logs := checkbms.Logs{}
+	for _, fileResult := range append(result.BmsFiles, result.BmsonFiles...) {
+		logs = append(logs, fileResult.Diagnostics...)
+	}
+	return append(logs, result.Diagnostics...), nil
+}
+
+// ファイルが無くなっていればnil
+func (w *watcher) checkBmsFile(path string) (checkbms.Logs, error) {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil, nil
+	}
+	bmsFileBase, err := checkbms.ReadBmsFileBase(path)
+	if err != nil {
+		return nil, err
+	}
+	if bmsFileBase.Config, err = w.config.ForDirectory(filepath.Dir(path)); err != nil {
+		return nil, err
+	}
+	bmsFileBase.Cache = w.cache
+	if checkbms.IsBmsonFile(path) {
+		bmsonFile := checkbms.NewBmsonFile(bmsFileBase)
+		if err := bmsonFile.ScanBmsonFile(); err != nil {
+			return nil, err
+		}
+		checkbms.CheckBmsonFile(bmsonFile)
+		return checkbms.NewBmsonFileResult(bmsonFile).Diagnostics, nil
+	}
+	bmsFile := checkbms.NewBmsFile(bmsFileBase)
+	if err := bmsFile.ScanBmsFile(); err != nil {
+		return nil, err
+	}
+	checkbms.CheckBmsFile(bmsFile)
+	return checkbms.NewBmsFileResult(&bmsFile.BmsFileBase).Diagnostics, nil
+}
+
+// "+ path:line: LEVEL: message"の形式。SubLogsの補足行はそのまま続ける
+func watchLogText(sign string, log checkbms.Log, lang string) string {
+	lines := strings.Split(log.StringWithLang(lang), "\n")
+	for i, line := range lines {
+		if strings.HasPrefix(line, "  ") {
+			lines[i] = sign + " " + line
+		} else {
+			lines[i] = sign + " " + log.Location() + ": " + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
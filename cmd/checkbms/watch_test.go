@@ -0,0 +1,105 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/Shimi9999/checkbms"
+	"github.com/fsnotify/fsnotify"
+)
+
+func writeTestFile(t *testing.T, path, text string) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(text), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// root/songA/a.bms、root/songA/sub/x.wav、root/other/readme.txt のフォルダを監視するwatcherを作る
+func newTestWatcher(t *testing.T) *watcher {
+	root := t.TempDir()
+	writeTestFile(t, filepath.Join(root, "songA", "a.bms"), "#TITLE a\r\n")
+	writeTestFile(t, filepath.Join(root, "songA", "sub", "x.wav"), "")
+	writeTestFile(t, filepath.Join(root, "other", "readme.txt"), "")
+	fsWatcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { fsWatcher.Close() })
+	return &watcher{root: root, logs: map[string]checkbms.Logs{}, watcher: fsWatcher}
+}
+
+func TestBmsDirectoryOf(t *testing.T) {
+	w := newTestWatcher(t)
+	songA := filepath.Join(w.root, "songA")
+	// 消えたフォルダでも、前回チェックしたフォルダならそのフォルダ
+	gone := filepath.Join(w.root, "gone")
+	w.logs[gone] = checkbms.Logs{}
+
+	for _, tc := range []struct {
+		path string
+		want string
+	}{
+		{songA, songA},
+		{filepath.Join(songA, "a.bms"), songA},
+		{filepath.Join(songA, "sub", "x.wav"), songA},
+		{filepath.Join(w.root, "other", "readme.txt"), ""},
+		{w.root, ""},
+		{filepath.Join(gone, "a.bms"), gone},
+		{filepath.Dir(w.root), ""},
+		{filepath.Join(filepath.Dir(w.root), "outside", "a.bms"), ""},
+	} {
+		if got := w.bmsDirectoryOf(tc.path); got != tc.want {
+			t.Errorf("bmsDirectoryOf(%s) = %q, want %q", tc.path, got, tc.want)
+		}
+	}
+}
+
+func TestTargetsOf(t *testing.T) {
+	w := newTestWatcher(t)
+	songA := filepath.Join(w.root, "songA")
+	old := filepath.Join(w.root, "old")
+	oldSong := filepath.Join(old, "song")
+	w.logs[oldSong] = checkbms.Logs{}
+	// BMSフォルダを含むフォルダが移動してきた
+	moved := filepath.Join(w.root, "moved")
+	writeTestFile(t, filepath.Join(moved, "song", "b.bms"), "#TITLE b\r\n")
+
+	for _, tc := range []struct {
+		name  string
+		event fsnotify.Event
+		want  []string
+	}{
+		{"write in bms folder", fsnotify.Event{Name: filepath.Join(songA, "a.bms"), Op: fsnotify.Write}, []string{songA}},
+		{"create in subfolder", fsnotify.Event{Name: filepath.Join(songA, "sub", "y.wav"), Op: fsnotify.Create}, []string{songA}},
+		{"write outside bms folders", fsnotify.Event{Name: filepath.Join(w.root, "other", "readme.txt"), Op: fsnotify.Write}, []string{}},
+		{"remove folder containing bms folder", fsnotify.Event{Name: old, Op: fsnotify.Remove}, []string{oldSong}},
+		{"rename folder containing bms folder", fsnotify.Event{Name: old, Op: fsnotify.Rename}, []string{oldSong}},
+		{"create folder containing bms folder", fsnotify.Event{Name: moved, Op: fsnotify.Create}, []string{filepath.Join(moved, "song")}},
+	} {
+		got := w.targetsOf(tc.event)
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: targetsOf = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestTargetsOfFile(t *testing.T) {
+	dir := t.TempDir()
+	bmsPath := filepath.Join(dir, "a.bms")
+	writeTestFile(t, bmsPath, "#TITLE a\r\n")
+	w := &watcher{root: bmsPath, isFile: true, logs: map[string]checkbms.Logs{}}
+
+	if got := w.targetsOf(fsnotify.Event{Name: bmsPath, Op: fsnotify.Write}); !reflect.DeepEqual(got, []string{bmsPath}) {
+		t.Errorf("targetsOf(watched file) = %v, want %v", got, []string{bmsPath})
+	}
+	if got := w.targetsOf(fsnotify.Event{Name: filepath.Join(dir, "b.bms"), Op: fsnotify.Write}); got != nil {
+		t.Errorf("targetsOf(other file) = %v, want nil", got)
+	}
+}
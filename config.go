@@ -0,0 +1,182 @@
+package checkbms
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+)
+
+// フォルダごとの設定ファイル名。このファイルはCheckUnusedFileの対象外になる
+const CONFIG_FILENAME = ".checkbms.json"
+
+// チェックの設定。全体の設定をフォルダごとの設定ファイルで上書きできる
+type Config struct {
+	// キーはルールID(bms.note-overlapなど)かチェック関数名(CheckNoteOverlapなど)。ルールIDの設定が優先される
+	Rules      map[string]RuleConfig `json:"rules,omitempty"`
+	Thresholds Thresholds            `json:"thresholds"`
+	// trueならBMSファイルの%checkbms-disableなどの抑制コメントを無視する。設定ファイルでは変更できない
+	IgnoreSuppressions bool `json:"-"`
+}
+
+type RuleConfig struct {
+	Enabled *bool      `json:"enabled,omitempty"` // nilなら有効
+	Level   AlertLevel `json:"level,omitempty"`   // 空ならチェック関数が決めたレベルのまま
+}
+
+type Thresholds struct {
+	AudioDurationLimit    float64               `json:"audioDurationLimit"`    // CheckOver1MinuteAudioFileで警告する音声ファイルの長さ(秒)
+	TotalOverRate         float64               `json:"totalOverRate"`         // JudgeOverTotalで標準のTOTALから何倍離れたら過剰とするか
+	UnusedFileIgnoredExts []string              `json:"unusedFileIgnoredExts"` // CheckUnusedFileで無視する拡張子
+	RankLevels            map[string]AlertLevel `json:"rankLevels"`            // #RANKの値ごとのレベル。空文字列なら報告しない
+}
+
+func DefaultConfig() *Config {
+	return &Config{
+		Rules: map[string]RuleConfig{},
+		Thresholds: Thresholds{
+			AudioDurationLimit:    60.0,
+			TotalOverRate:         1.6,
+			UnusedFileIgnoredExts: []string{".txt", ".zip", ".rar", ".lzh", ".7z"},
+			RankLevels:            map[string]AlertLevel{"0": Notice, "1": Notice, "4": Notice},
+		},
+	}
+}
+
+// 設定ファイルを読み込み、デフォルトの設定を上書きしたものを返す
+func LoadConfig(path string) (*Config, error) {
+	return DefaultConfig().overrideWithFile(path)
+}
+
+// フォルダにCONFIG_FILENAMEがあれば、それで上書きした設定を返す。無ければcそのものを返す。
+// dirPathはzipファイルの中のフォルダでもよい
+func (c *Config) ForDirectory(dirPath string) (*Config, error) {
+	loc, err := openScanLocation(dirPath)
+	if err != nil {
+		return nil, err
+	}
+	defer loc.close()
+	configLoc := loc.join(CONFIG_FILENAME)
+	bytes, err := fs.ReadFile(configLoc.fsys, configLoc.name)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return c, nil
+		}
+		return nil, configLoc.pathError(err)
+	}
+	return c.override(bytes, configLoc.path)
+}
+
+func (c *Config) overrideWithFile(path string) (*Config, error) {
+	bytes, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return c.override(bytes, path)
+}
+
+// pathはエラーメッセージに使う
+func (c *Config) override(bytes []byte, path string) (*Config, error) {
+	// JSONに書かれている項目だけが上書きされるように、複製に対してUnmarshalする
+	config := c.clone()
+	if err := json.Unmarshal(bytes, config); err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err.Error())
+	}
+	if err := config.validate(); err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err.Error())
+	}
+	return config, nil
+}
+
+func (c *Config) clone() *Config {
+	config := *c
+	config.Rules = map[string]RuleConfig{}
+	for key, ruleConfig := range c.Rules {
+		config.Rules[key] = ruleConfig
+	}
+	config.Thresholds.UnusedFileIgnoredExts = append([]string{}, c.Thresholds.UnusedFileIgnoredExts...)
+	config.Thresholds.RankLevels = map[string]AlertLevel{}
+	for rank, level := range c.Thresholds.RankLevels {
+		config.Thresholds.RankLevels[rank] = level
+	}
+	return &config
+}
+
+// 設定を検証する。レベルはコマンドラインと同じく大文字小文字を区別せず、大文字に揃える
+func (c *Config) validate() error {
+	for key, ruleConfig := range c.Rules {
+		if _, ok := RuleByID(key); !ok && !isCheckName(key) {
+			return fmt.Errorf("unknown rule or check: %s", key)
+		}
+		if ruleConfig.Level != "" {
+			level, err := ParseAlertLevel(string(ruleConfig.Level))
+			if err != nil {
+				return fmt.Errorf("invalid level of %s: %s", key, ruleConfig.Level)
+			}
+			ruleConfig.Level = level
+			c.Rules[key] = ruleConfig
+		}
+	}
+	for rank, level := range c.Thresholds.RankLevels {
+		if level != "" {
+			parsed, err := ParseAlertLevel(string(level))
+			if err != nil {
+				return fmt.Errorf("invalid level of rank %s: %s", rank, level)
+			}
+			c.Thresholds.RankLevels[rank] = parsed
+		}
+	}
+	if c.Thresholds.AudioDurationLimit <= 0 {
+		return fmt.Errorf("audioDurationLimit must be positive: %g", c.Thresholds.AudioDurationLimit)
+	}
+	if c.Thresholds.TotalOverRate < 1 {
+		return fmt.Errorf("totalOverRate must be 1 or more: %g", c.Thresholds.TotalOverRate)
+	}
+	return nil
+}
+
+func isCheckName(name string) bool {
+	for _, rule := range RULES {
+		if rule.Check == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Config) ruleConfig(id string) RuleConfig {
+	if ruleConfig, ok := c.Rules[id]; ok {
+		return ruleConfig
+	}
+	if rule, ok := RuleByID(id); ok {
+		return c.Rules[rule.Check]
+	}
+	return RuleConfig{}
+}
+
+// 無効なルールのログを取り除き、レベルを上書きしたログを返す
+func (c *Config) apply(logs Logs) (applied Logs) {
+	if logs == nil {
+		return nil
+	}
+	applied = Logs{}
+	for _, log := range logs {
+		ruleConfig := c.ruleConfig(log.Rule)
+		if ruleConfig.Enabled != nil && !*ruleConfig.Enabled {
+			continue
+		}
+		if ruleConfig.Level != "" {
+			log.Level = ruleConfig.Level
+		}
+		applied = append(applied, log)
+	}
+	return applied
+}
+
+func configOrDefault(config *Config) *Config {
+	if config == nil {
+		return DefaultConfig()
+	}
+	return config
+}
@@ -0,0 +1,97 @@
+package checkbms
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestConfigForDirectory(t *testing.T) {
+	root := t.TempDir()
+	globalPath := filepath.Join(root, "global.json")
+	if err := os.WriteFile(globalPath, []byte(`{
+		"rules": {"CheckWavDuplicate": {"enabled": false}, "bms.note-overlap": {"level": "warning"}},
+		"thresholds": {"audioDurationLimit": 90}
+	}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	global, err := LoadConfig(globalPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if global.Thresholds.AudioDurationLimit != 90 || global.Thresholds.TotalOverRate != 1.6 {
+		t.Errorf("global thresholds: got = %+v", global.Thresholds)
+	}
+
+	songDir := filepath.Join(root, "song")
+	if err := os.Mkdir(songDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if same, err := global.ForDirectory(songDir); err != nil || same != global {
+		t.Errorf("ForDirectory without config file: got = %p, %v, want = %p", same, err, global)
+	}
+	if err := os.WriteFile(filepath.Join(songDir, CONFIG_FILENAME), []byte(`{
+		"rules": {"bms.note-overlap": {"level": "ERROR"}},
+		"thresholds": {"rankLevels": {"0": "", "2": "Notice"}}
+	}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	config, err := global.ForDirectory(songDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Thresholds.AudioDurationLimit != 90 {
+		t.Errorf("audioDurationLimit is not inherited: got = %g", config.Thresholds.AudioDurationLimit)
+	}
+	if config.Rules["bms.note-overlap"].Level != Error || global.Rules["bms.note-overlap"].Level != Warning {
+		t.Errorf("rule level override: got = %s, global = %s", config.Rules["bms.note-overlap"].Level, global.Rules["bms.note-overlap"].Level)
+	}
+	if _, ok := config.Rules["CheckWavDuplicate"]; !ok {
+		t.Errorf("rules are not inherited: got = %+v", config.Rules)
+	}
+	want := map[string]AlertLevel{"0": "", "1": Notice, "2": Notice, "4": Notice}
+	for rank, level := range want {
+		if config.Thresholds.RankLevels[rank] != level {
+			t.Errorf("rankLevels[%s]: got = %q, want = %q", rank, config.Thresholds.RankLevels[rank], level)
+		}
+	}
+
+	if err := os.WriteFile(globalPath, []byte(`{"rules": {"bms.unknown": {"enabled": false}}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadConfig(globalPath); err == nil {
+		t.Errorf("unknown rule is not error")
+	}
+}
+
+func TestCheckBmsFileWithConfig(t *testing.T) {
+	disabled := false
+	bmsFile := newTestBmsFile("test.bms",
+		"#RANK 0",
+		"#WAV01 a.wav",
+		"#00111:0101",
+		"#00111:01",
+	)
+	bmsFile.Config = DefaultConfig()
+	bmsFile.Config.Rules["CheckWavDuplicate"] = RuleConfig{Enabled: &disabled}
+	bmsFile.Config.Rules["bms.note-overlap"] = RuleConfig{Level: Warning}
+	bmsFile.Config.Thresholds.RankLevels["0"] = Warning
+	if err := bmsFile.ScanBmsFile(); err != nil {
+		t.Fatal(err)
+	}
+	CheckBmsFile(bmsFile)
+
+	levels := map[string]AlertLevel{}
+	for _, log := range bmsFile.Logs {
+		levels[log.Rule] = log.Level
+	}
+	if _, ok := levels["bms.wav-duplicate"]; ok {
+		t.Errorf("disabled rule is reported")
+	}
+	if levels["bms.note-overlap"] != Warning {
+		t.Errorf("bms.note-overlap level: got = %q, want = WARNING", levels["bms.note-overlap"])
+	}
+	if levels["bms.rank-unusual"] != Warning {
+		t.Errorf("bms.rank-unusual level: got = %q, want = WARNING", levels["bms.rank-unusual"])
+	}
+}
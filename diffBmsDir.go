@@ -28,6 +28,7 @@ func DiffBmsDirectories(dirPath1, dirPath2 string) (result *DiffBmsDirResult, _
 		if err != nil {
 			return nil, err
 		}
+		bmsDir.Close() // 比較はファイルの一覧とBMSファイルの内容だけを使う
 		bmsDirs[i] = *bmsDir
 	}
 
@@ -209,6 +210,7 @@ type hashIsNotEqual struct {
 
 func (h hashIsNotEqual) Log() Log {
 	log := Log{
+		Rule:       "diff.hash-not-equal",
 		Level:      Error,
 		Message:    fmt.Sprintf("%s: Each BMSFile text(sha256 hash) is not equal", h.path),
 		Message_ja: fmt.Sprintf("%s: それぞれのBMSファイルの内容(sha256ハッシュ)が一致しません", h.path),
@@ -217,6 +219,7 @@ func (h hashIsNotEqual) Log() Log {
 	}
 	log.SubLogs = append(log.SubLogs, fmt.Sprintf("%s: %s", h.dirPath1, h.bmsFileBase1.Sha256))
 	log.SubLogs = append(log.SubLogs, fmt.Sprintf("%s: %s", h.dirPath2, h.bmsFileBase2.Sha256))
+	log.RelatedPaths = []string{h.bmsFileBase1.Path, h.bmsFileBase2.Path}
 	return log
 }
 
@@ -227,6 +230,7 @@ type textIsNotEqual struct {
 
 func (t textIsNotEqual) Log() Log {
 	return Log{
+		Rule:       "diff.text-not-equal",
 		Level:      Warning,
 		Message:    fmt.Sprintf("%s: Each text is not equal", t.path),
 		Message_ja: fmt.Sprintf("%s: それぞれのテキストファイルの内容が一致しません", t.path),
@@ -240,6 +244,7 @@ type missingFile struct {
 
 func (m missingFile) Log() Log {
 	return Log{
+		Rule:       "diff.file-missing",
 		Level:      Warning,
 		Message:    fmt.Sprintf("%s is missing the file: %s", m.dirPath, m.missingFilePath),
 		Message_ja: fmt.Sprintf("%sに欠落しているファイルがあります: %s", m.dirPath, m.missingFilePath),
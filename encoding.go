@@ -0,0 +1,142 @@
+package checkbms
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/saintfish/chardet"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/korean"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+// BMSファイルの文字コード
+type Encoding string
+
+const (
+	ShiftJIS = Encoding("Shift_JIS") // CP932を含む
+	UTF8     = Encoding("UTF-8")
+	EUCJP    = Encoding("EUC-JP")
+	EUCKR    = Encoding("EUC-KR")
+	GBK      = Encoding("GBK")
+)
+
+// 文字コードごとの、ヘッダーの日本語などを正しく表示できる主なプレイヤー。EUC-JPを表示できる主なプレイヤーは無い
+var ENCODING_PLAYERS = map[Encoding][]string{
+	ShiftJIS: {"LR2", "beatoraja", "Qwilight"},
+	UTF8:     {"Qwilight"},
+	EUCKR:    {"Qwilight"},
+	GBK:      {"Qwilight"},
+}
+
+var UTF8_BOM = []byte{0xef, 0xbb, 0xbf}
+
+func (e Encoding) encoding() encoding.Encoding {
+	switch e {
+	case UTF8:
+		return unicode.UTF8
+	case EUCJP:
+		return japanese.EUCJP
+	case EUCKR:
+		return korean.EUCKR
+	case GBK:
+		return simplifiedchinese.GBK
+	default:
+		return japanese.ShiftJIS
+	}
+}
+
+func (e Encoding) decoder() *encoding.Decoder {
+	return e.encoding().NewDecoder()
+}
+
+// エディタで編集中の文字列などを、この文字コードのバイト列にする。表せない文字があればエラーを返す
+func (e Encoding) Encode(text string) ([]byte, error) {
+	if e == UTF8 {
+		return []byte(text), nil
+	}
+	encoded, err := e.encoding().NewEncoder().String(text)
+	if err != nil {
+		return nil, fmt.Errorf("%s cannot encode the text: %s", e, err.Error())
+	}
+	return []byte(encoded), nil
+}
+
+// 1行をデコードする。不正なバイト列があればエラーを返す(デコード結果は置換文字を含む)
+func (e Encoding) decodeLine(decoder *encoding.Decoder, text string) (string, error) {
+	line, _, err := transform.String(decoder, text)
+	if err != nil {
+		return line, err
+	}
+	if e == UTF8 {
+		if !utf8.ValidString(text) {
+			return line, fmt.Errorf("invalid UTF-8 byte sequence")
+		}
+	} else if strings.ContainsRune(line, utf8.RuneError) {
+		// UTF-8以外のデコーダーは不正なバイトを置換文字にする
+		return line, fmt.Errorf("invalid %s byte sequence", e)
+	}
+	return line, nil
+}
+
+func (e Encoding) players() string {
+	if len(ENCODING_PLAYERS[e]) == 0 {
+		return "none"
+	}
+	return strings.Join(ENCODING_PLAYERS[e], ", ")
+}
+
+// BOM、UTF-8としての妥当性、chardetの順に文字コードを判定する。ASCIIのみならShift_JIS
+func DetectEncoding(fullText []byte) Encoding {
+	if bytes.HasPrefix(fullText, UTF8_BOM) {
+		return UTF8
+	}
+	isASCII := true
+	for _, b := range fullText {
+		if b >= 0x80 {
+			isASCII = false
+			break
+		}
+	}
+	if isASCII {
+		return ShiftJIS
+	}
+	if utf8.Valid(fullText) {
+		return UTF8
+	}
+
+	if result, err := chardet.NewTextDetector().DetectBest(fullText); err == nil {
+		switch result.Charset {
+		case "Shift_JIS":
+			return ShiftJIS
+		case "EUC-JP":
+			// Shift_JISを誤判定することがあるので、EUC-JPとして正しいバイト列の場合だけEUC-JPとする
+			if isValidEncoding(fullText, EUCJP) {
+				return EUCJP
+			}
+			return ShiftJIS
+		case "EUC-KR":
+			// 半角カナだけのShift_JISなどを低い確度でEUC-KRと判定することがあるので、確度が高い場合だけEUC-KRとする
+			if result.Confidence >= eucKRMinConfidence {
+				return EUCKR
+			}
+		case "GB-18030":
+			return GBK
+		}
+	}
+	// chardetが判定できない短い文章は、従来通りShift_JISとする
+	return ShiftJIS
+}
+
+// chardetがEUC-KRと判定した場合に、EUC-KRとする確度(0-100)の下限
+const eucKRMinConfidence = 50
+
+func isValidEncoding(text []byte, e Encoding) bool {
+	_, err := e.decodeLine(e.decoder(), string(text))
+	return err == nil
+}
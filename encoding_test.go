@@ -0,0 +1,119 @@
+package checkbms
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/korean"
+	"golang.org/x/text/encoding/simplifiedchinese"
+)
+
+func encodeText(t *testing.T, e encoding.Encoding, text string) []byte {
+	encoded, err := e.NewEncoder().String(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return []byte(encoded)
+}
+
+func TestDetectEncoding(t *testing.T) {
+	tests := []struct {
+		name string
+		text []byte
+		want Encoding
+	}{
+		{"ascii", []byte("#TITLE abc\r\n"), ShiftJIS},
+		{"shift-jis", encodeText(t, japanese.ShiftJIS, "#TITLE テスト曲です\r\n#ARTIST 作曲者\r\n#GENRE ジャンル\r\n"), ShiftJIS},
+		{"utf-8", []byte("#TITLE テスト曲です\r\n"), UTF8},
+		{"utf-8 bom", append(append([]byte{}, UTF8_BOM...), "#TITLE abc\r\n"...), UTF8},
+		{"euc-jp", encodeText(t, japanese.EUCJP, "#TITLE テスト曲です\r\n#ARTIST 作曲者\r\n#GENRE ジャンル\r\n#SUBTITLE 難しい譜面\r\n"), EUCJP},
+		{"euc-kr", encodeText(t, korean.EUCKR, "#TITLE 한국어 노래 제목\r\n#SUBTITLE 다른 버전\r\n#ARTIST 작곡가 / 편곡자\r\n#GENRE 전자 음악\r\n"), EUCKR},
+		// 半角カナだけの短いShift_JISはEUC-KRの形式にもなるが、Shift_JISとする
+		{"shift-jis half-width kana ﾀｲﾄﾙ", encodeText(t, japanese.ShiftJIS, "#TITLE ﾀｲﾄﾙ\r\n"), ShiftJIS},
+		{"shift-jis half-width kana ｱｲ", encodeText(t, japanese.ShiftJIS, "#TITLE ｱｲ\r\n"), ShiftJIS},
+		{"shift-jis half-width kana ｱｲｳｴ", encodeText(t, japanese.ShiftJIS, "#TITLE ｱｲｳｴ\r\n"), ShiftJIS},
+		{"shift-jis half-width kana ﾃｽﾄ", encodeText(t, japanese.ShiftJIS, "#TITLE ﾃｽﾄ\r\n"), ShiftJIS},
+		{"shift-jis half-width kana ｻｸﾗ", encodeText(t, japanese.ShiftJIS, "#TITLE ｻｸﾗ\r\n"), ShiftJIS},
+		{"gbk", encodeText(t, simplifiedchinese.GBK, "#TITLE 中文歌曲标题\r\n#ARTIST 作曲家\r\n#GENRE 流行音乐\r\n"), GBK},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := DetectEncoding(test.text); got != test.want {
+				t.Errorf("got = %s, want = %s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestScanBmsFileDecodesWithDetectedEncoding(t *testing.T) {
+	tests := []struct {
+		name     string
+		fullText []byte
+		want     Encoding
+		wantRule string
+	}{
+		{"shift-jis", encodeText(t, japanese.ShiftJIS, "#TITLE テスト曲です\r\n"), ShiftJIS, ""},
+		{"utf-8", append(append([]byte{}, UTF8_BOM...), "#TITLE テスト曲です\r\n"...), UTF8, "bms.charset-utf8"},
+		{"euc-jp", encodeText(t, japanese.EUCJP, "#TITLE テスト曲です\r\n#ARTIST 作曲者\r\n#GENRE ジャンル\r\n#SUBTITLE 難しい譜面\r\n"), EUCJP, "bms.charset-not-shift-jis"},
+		{"euc-kr", encodeText(t, korean.EUCKR, "#TITLE 한국어 노래 제목\r\n#SUBTITLE 다른 버전\r\n#ARTIST 작곡가 / 편곡자\r\n#GENRE 전자 음악\r\n"), EUCKR, "bms.charset-not-shift-jis"},
+		{"shift-jis half-width kana", encodeText(t, japanese.ShiftJIS, "#TITLE ﾀｲﾄﾙ\r\n"), ShiftJIS, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			bmsFile := NewBmsFile(&BmsFileBase{File: File{Path: "test.bms"}, FullText: test.fullText})
+			if err := bmsFile.ScanBmsFile(); err != nil {
+				t.Fatal(err)
+			}
+			if bmsFile.Encoding != test.want {
+				t.Errorf("Encoding: got = %s, want = %s", bmsFile.Encoding, test.want)
+			}
+			if title := bmsFile.Header["title"]; title != "テスト曲です" && title != "한국어 노래 제목" && title != "ﾀｲﾄﾙ" {
+				t.Errorf("title is garbled: %s", title)
+			}
+			gotRule := ""
+			for _, log := range bmsFile.Logs {
+				if log.Rule == "bms.charset-utf8" || log.Rule == "bms.charset-not-shift-jis" {
+					gotRule = log.Rule
+					// EUC-JPを表示できる主なプレイヤーは無い
+					if test.want == EUCJP && !strings.Contains(log.Message, "No major player") {
+						t.Errorf("message: got = %s", log.Message)
+					}
+				}
+			}
+			if gotRule != test.wantRule {
+				t.Errorf("charset log: got = %q, want = %q", gotRule, test.wantRule)
+			}
+		})
+	}
+}
+
+func TestScanBmsFileReportsUndecodableLines(t *testing.T) {
+	fullText := encodeText(t, japanese.ShiftJIS, "#TITLE テスト曲です\r\n#ARTIST 作曲者\r\n")
+	fullText = append(fullText, "*comment \xff\xfe\r\n"...)
+	fullText = append(fullText, encodeText(t, japanese.ShiftJIS, "#GENRE ジャンル\r\n")...)
+	bmsFile := NewBmsFile(&BmsFileBase{File: File{Path: "test.bms"}, FullText: fullText})
+	if err := bmsFile.ScanBmsFile(); err != nil {
+		t.Fatal(err)
+	}
+	if bmsFile.Encoding != ShiftJIS {
+		t.Fatalf("Encoding: got = %s, want = %s", bmsFile.Encoding, ShiftJIS)
+	}
+	var got *Log
+	for i := range bmsFile.Logs {
+		if bmsFile.Logs[i].Rule == "bms.line-undecodable" {
+			got = &bmsFile.Logs[i]
+		}
+	}
+	if got == nil {
+		t.Fatalf("bms.line-undecodable is not reported: %v", bmsFile.Logs)
+	}
+	if got.Line != 3 || !strings.Contains(got.Message, "FF FE") {
+		t.Errorf("log: got = line %d %q, want line 3 with FF FE", got.Line, got.Message)
+	}
+	// 後ろの行も読み込まれている
+	if bmsFile.Header["genre"] != "ジャンル" {
+		t.Errorf("genre: got = %q, want = %q", bmsFile.Header["genre"], "ジャンル")
+	}
+}
@@ -0,0 +1,208 @@
+package checkbms
+
+import (
+	"html/template"
+	"io"
+	"path/filepath"
+)
+
+// 外部ファイルを使わず単体で表示できるHTML形式の出力
+
+type htmlReport struct {
+	Lang        string
+	Counts      htmlCounts
+	Directories []htmlDirectory
+	Rules       []Rule // レポートに出てくるルール
+}
+
+type htmlDirectory struct {
+	Path     string
+	Counts   htmlCounts
+	Sections []htmlSection
+}
+
+// 譜面1つ分、またはフォルダ自体のログ
+type htmlSection struct {
+	Name   string
+	Path   string
+	Counts htmlCounts
+	Logs   []htmlLog
+}
+
+type htmlLog struct {
+	Rule       string
+	Level      AlertLevel
+	Level_ja   string
+	Location   string
+	Message    string
+	Message_ja string
+}
+
+type htmlCounts struct {
+	Error   int
+	Warning int
+	Notice  int
+}
+
+func (c *htmlCounts) add(level AlertLevel) {
+	switch level {
+	case Error:
+		c.Error++
+	case Warning:
+		c.Warning++
+	case Notice:
+		c.Notice++
+	}
+}
+
+func (c *htmlCounts) addCounts(counts htmlCounts) {
+	c.Error += counts.Error
+	c.Warning += counts.Warning
+	c.Notice += counts.Notice
+}
+
+func newHtmlSection(name, path string, logs Logs, usedRules map[string]bool) htmlSection {
+	section := htmlSection{Name: name, Path: path}
+	for _, log := range logs {
+		section.Counts.add(log.Level)
+		section.Logs = append(section.Logs, htmlLog{
+			Rule:       log.Rule,
+			Level:      log.Level,
+			Level_ja:   log.Level.String_ja(),
+			Location:   log.Location(),
+			Message:    log.FullMessage("en"),
+			Message_ja: log.FullMessage("ja"),
+		})
+		usedRules[log.Rule] = true
+	}
+	return section
+}
+
+func newHtmlDirectory(path string, bmsFiles []BmsFileResult, dirLogs Logs, usedRules map[string]bool) htmlDirectory {
+	dir := htmlDirectory{Path: path}
+	for _, bmsFile := range bmsFiles {
+		dir.Sections = append(dir.Sections, newHtmlSection(filepath.Base(bmsFile.Path), bmsFile.Path, bmsFile.Diagnostics, usedRules))
+	}
+	if len(dirLogs) > 0 {
+		dir.Sections = append(dir.Sections, newHtmlSection(filepath.Base(path)+string(filepath.Separator), path, dirLogs, usedRules))
+	}
+	for _, section := range dir.Sections {
+		dir.Counts.addCounts(section.Counts)
+	}
+	return dir
+}
+
+// reportをHTML形式で書き出す。langは初期表示の言語(en/ja)で、ページ上で切り替えられる
+func WriteHTML(w io.Writer, report *Report, lang string) error {
+	if lang != "ja" {
+		lang = "en"
+	}
+	data := htmlReport{Lang: lang}
+	usedRules := map[string]bool{}
+	for _, dir := range report.Directories {
+		bmsFiles := append(append([]BmsFileResult{}, dir.BmsFiles...), dir.BmsonFiles...)
+		data.Directories = append(data.Directories, newHtmlDirectory(dir.Path, bmsFiles, dir.Diagnostics, usedRules))
+	}
+	for _, bmsFile := range append(append([]BmsFileResult{}, report.BmsFiles...), report.BmsonFiles...) {
+		data.Directories = append(data.Directories, newHtmlDirectory(bmsFile.Path, []BmsFileResult{bmsFile}, nil, usedRules))
+	}
+	for _, dir := range data.Directories {
+		data.Counts.addCounts(dir.Counts)
+	}
+	for _, rule := range RULES {
+		if usedRules[rule.ID] {
+			data.Rules = append(data.Rules, rule)
+		}
+	}
+	return htmlTemplate.Execute(w, data)
+}
+
+var htmlTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html lang="{{.Lang}}">
+<head>
+<meta charset="utf-8">
+<title>checkbms report</title>
+<style>
+body { font-family: sans-serif; margin: 1em 2em; color: #222; }
+table { border-collapse: collapse; margin-bottom: 1.5em; }
+th, td { border: 1px solid #ccc; padding: 2px 8px; }
+td.num { text-align: right; }
+a { color: #06c; }
+details { margin: 2px 0 2px 1em; }
+summary { cursor: pointer; }
+ul.logs { list-style: none; padding-left: 1em; margin: 4px 0; }
+ul.logs li { margin: 2px 0; white-space: pre-wrap; }
+.level { display: inline-block; min-width: 5em; font-weight: bold; }
+.ERROR .level, .count-error { color: #c00; }
+.WARNING .level, .count-warning { color: #b60; }
+.NOTICE .level, .count-notice { color: #07a; }
+.rule, .location { color: #777; font-size: 90%; }
+.filter { position: sticky; top: 0; background: #fff; padding: 6px 0; border-bottom: 1px solid #ccc; margin-bottom: 1em; }
+.filter label { margin-right: 1em; }
+html[lang=en] .ja, html[lang=ja] .en { display: none; }
+.hidden { display: none; }
+</style>
+</head>
+<body>
+<h1>checkbms report</h1>
+<div class="filter">
+<label><input type="checkbox" class="level-filter" value="ERROR" checked>ERROR</label>
+<label><input type="checkbox" class="level-filter" value="WARNING" checked>WARNING</label>
+<label><input type="checkbox" class="level-filter" value="NOTICE" checked>NOTICE</label>
+<select id="rule-filter">
+<option value="">All rules / 全てのルール</option>
+{{- range .Rules}}
+<option value="{{.ID}}" title="{{.Description}} / {{.Description_ja}}">{{.ID}}</option>
+{{- end}}
+</select>
+<button type="button" id="lang-toggle">EN / JA</button>
+</div>
+
+<table>
+<tr><th><span class="en">Folder</span><span class="ja">フォルダ</span></th><th>ERROR</th><th>WARNING</th><th>NOTICE</th></tr>
+{{- range $i, $dir := .Directories}}
+<tr><td><a href="#dir{{$i}}">{{$dir.Path}}</a></td><td class="num count-error">{{$dir.Counts.Error}}</td><td class="num count-warning">{{$dir.Counts.Warning}}</td><td class="num count-notice">{{$dir.Counts.Notice}}</td></tr>
+{{- end}}
+<tr><th><span class="en">Total</span><span class="ja">合計</span></th><th class="count-error">{{.Counts.Error}}</th><th class="count-warning">{{.Counts.Warning}}</th><th class="count-notice">{{.Counts.Notice}}</th></tr>
+</table>
+
+{{- range $i, $dir := .Directories}}
+<section id="dir{{$i}}">
+<h2>{{$dir.Path}}</h2>
+{{- range $dir.Sections}}
+<details class="chart"{{if .Logs}} open{{end}}>
+<summary title="{{.Path}}">{{.Name}} (<span class="count-error">{{.Counts.Error}}</span> / <span class="count-warning">{{.Counts.Warning}}</span> / <span class="count-notice">{{.Counts.Notice}}</span>)</summary>
+<ul class="logs">
+{{- range .Logs}}
+<li class="{{.Level}}" data-level="{{.Level}}" data-rule="{{.Rule}}"><span class="level"><span class="en">{{.Level}}</span><span class="ja">{{.Level_ja}}</span></span> <span class="en">{{.Message}}</span><span class="ja">{{.Message_ja}}</span> <span class="rule">[{{.Rule}}]</span>{{if .Location}} <span class="location">{{.Location}}</span>{{end}}</li>
+{{- end}}
+</ul>
+</details>
+{{- end}}
+</section>
+{{- end}}
+
+<script>
+(function() {
+  var levelFilters = document.querySelectorAll('.level-filter');
+  var ruleFilter = document.getElementById('rule-filter');
+  function applyFilter() {
+    var levels = {};
+    levelFilters.forEach(function(input) { levels[input.value] = input.checked; });
+    var rule = ruleFilter.value;
+    document.querySelectorAll('ul.logs li').forEach(function(li) {
+      var visible = levels[li.dataset.level] && (rule === '' || li.dataset.rule === rule);
+      li.classList.toggle('hidden', !visible);
+    });
+  }
+  levelFilters.forEach(function(input) { input.addEventListener('change', applyFilter); });
+  ruleFilter.addEventListener('change', applyFilter);
+  document.getElementById('lang-toggle').addEventListener('click', function() {
+    var html = document.documentElement;
+    html.lang = html.lang === 'ja' ? 'en' : 'ja';
+  });
+})();
+</script>
+</body>
+</html>
+`))
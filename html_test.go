@@ -0,0 +1,43 @@
+package checkbms
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWriteHTML(t *testing.T) {
+	report := Report{Directories: []DirectoryResult{{
+		Path: "song",
+		BmsFiles: []BmsFileResult{{Path: "song/test.bms", Diagnostics: Logs{
+			{Rule: "bms.note-overlap", Level: Error, Message: "Placed notes overlap", Message_ja: "配置されているノーツが重なり合っています",
+				Path: "song/test.bms", Line: 4, Column: 8},
+		}}},
+		Diagnostics: Logs{
+			{Rule: "dir.file-unused", Level: Warning, Message: "Unused file: <a>.wav", Message_ja: "使われていないファイルがあります: <a>.wav", Path: "song/<a>.wav"},
+		},
+	}}}
+	var buf bytes.Buffer
+	if err := WriteHTML(&buf, &report, "ja"); err != nil {
+		t.Fatal(err)
+	}
+	html := buf.String()
+	for _, want := range []string{
+		`<html lang="ja">`,
+		`data-level="ERROR" data-rule="bms.note-overlap"`,
+		`<span class="en">Placed notes overlap</span><span class="ja">配置されているノーツが重なり合っています</span>`,
+		`song/test.bms:4:8`,
+		`<option value="dir.file-unused"`,
+		`Unused file: &lt;a&gt;.wav`,
+	} {
+		if !strings.Contains(html, want) {
+			t.Errorf("html does not contain %q", want)
+		}
+	}
+	if strings.Contains(html, "<a>.wav") {
+		t.Errorf("message is not escaped")
+	}
+	if strings.Contains(html, "http://") || strings.Contains(html, "https://") || strings.Contains(html, "src=") {
+		t.Errorf("html refers to external assets")
+	}
+}
@@ -0,0 +1,168 @@
+package checkbms
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// JUnit XML 形式の出力
+// フォルダを<testsuite>、譜面ごとのチェック関数を<testcase>、ErrorとWarningを<failure>にする。
+// <failure>を複数持つ<testcase>を読めないツールがあるので、<failure>は1つにして全てのログを本文に並べる
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Classname string        `xml:"classname,attr"`
+	Name      string        `xml:"name,attr"`
+	Failure   *junitFailure `xml:"failure"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitFailure struct {
+	Type    string `xml:"type,attr"`    // ルールID。複数あれば", "区切り
+	Message string `xml:"message,attr"` // 最初のログのメッセージ
+	Text    string `xml:",chardata"`    // 全てのログ
+	logs    []Log
+}
+
+// ルールIDの接頭辞(bms., bmson., dir.)に対応するチェック関数名をRULESの順で返す
+func checksOfRulePrefix(prefix string) (checks []string) {
+	exists := map[string]bool{}
+	for _, rule := range RULES {
+		if strings.HasPrefix(rule.ID, prefix) && !exists[rule.Check] {
+			checks = append(checks, rule.Check)
+			exists[rule.Check] = true
+		}
+	}
+	return checks
+}
+
+func checkOfRule(id string) string {
+	if rule, ok := RuleByID(id); ok {
+		return rule.Check
+	}
+	return id
+}
+
+// 1つの対象(譜面かフォルダ)について、チェック関数ごとのtestcaseを作る
+func junitTestCases(classname string, checks []string, logs Logs, lang string) (cases []junitTestCase) {
+	indices := map[string]int{}
+	for _, check := range checks {
+		indices[check] = len(cases)
+		cases = append(cases, junitTestCase{Classname: classname, Name: check})
+	}
+	for _, log := range logs {
+		check := checkOfRule(log.Rule)
+		i, ok := indices[check]
+		if !ok {
+			i = len(cases)
+			indices[check] = i
+			cases = append(cases, junitTestCase{Classname: classname, Name: check})
+		}
+		text := log.FullMessage(lang)
+		if location := log.Location(); location != "" {
+			text = location + ": " + text
+		}
+		text = string(log.Level) + " " + log.Rule + ": " + text + "\n"
+		if log.Level == Notice {
+			cases[i].SystemOut += text
+			continue
+		}
+		if cases[i].Failure == nil {
+			cases[i].Failure = &junitFailure{}
+		}
+		cases[i].Failure.Text += text
+		cases[i].Failure.logs = append(cases[i].Failure.logs, log)
+	}
+	for i := range cases {
+		if cases[i].Failure != nil {
+			cases[i].Failure.setSummary(lang)
+		}
+	}
+	return cases
+}
+
+func (f *junitFailure) setSummary(lang string) {
+	rules := []string{}
+	for _, log := range f.logs {
+		rules = append(rules, log.Rule)
+	}
+	f.Type = strings.Join(removeDuplicate(rules), ", ")
+
+	first := f.logs[0]
+	f.Message = string(first.Level) + ": " + first.Message
+	if lang == "ja" {
+		f.Message = string(first.Level) + ": " + first.Message_ja
+	}
+	if rest := len(f.logs) - 1; rest > 0 {
+		if lang == "ja" {
+			f.Message += fmt.Sprintf(" (他%d件)", rest)
+		} else {
+			f.Message += fmt.Sprintf(" (and %d more)", rest)
+		}
+	}
+}
+
+func newJunitTestSuite(name string, bmsFiles, bmsonFiles []BmsFileResult, dirLogs Logs, isDirectory bool, lang string) junitTestSuite {
+	suite := junitTestSuite{Name: name}
+	for _, bmsFile := range bmsFiles {
+		suite.Cases = append(suite.Cases, junitTestCases(bmsFile.Path, checksOfRulePrefix("bms."), bmsFile.Diagnostics, lang)...)
+	}
+	for _, bmsonFile := range bmsonFiles {
+		suite.Cases = append(suite.Cases, junitTestCases(bmsonFile.Path, checksOfRulePrefix("bmson."), bmsonFile.Diagnostics, lang)...)
+	}
+	if isDirectory {
+		suite.Cases = append(suite.Cases, junitTestCases(name, checksOfRulePrefix("dir."), dirLogs, lang)...)
+	}
+	suite.Tests = len(suite.Cases)
+	for _, testCase := range suite.Cases {
+		if testCase.Failure != nil {
+			suite.Failures++
+		}
+	}
+	return suite
+}
+
+// reportをJUnit XML形式で書き出す。langはfailureのメッセージの言語(en/ja)
+func WriteJUnit(w io.Writer, report *Report, lang string) error {
+	suites := junitTestSuites{Name: "checkbms"}
+	for _, dir := range report.Directories {
+		suites.Suites = append(suites.Suites, newJunitTestSuite(dir.Path, dir.BmsFiles, dir.BmsonFiles, dir.Diagnostics, true, lang))
+	}
+	for _, bmsFile := range report.BmsFiles {
+		suites.Suites = append(suites.Suites, newJunitTestSuite(bmsFile.Path, []BmsFileResult{bmsFile}, nil, nil, false, lang))
+	}
+	for _, bmsonFile := range report.BmsonFiles {
+		suites.Suites = append(suites.Suites, newJunitTestSuite(bmsonFile.Path, nil, []BmsFileResult{bmsonFile}, nil, false, lang))
+	}
+	for _, suite := range suites.Suites {
+		suites.Tests += suite.Tests
+		suites.Failures += suite.Failures
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(suites); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,64 @@
+package checkbms
+
+import (
+	"bytes"
+	"encoding/xml"
+	"testing"
+)
+
+func TestWriteJUnit(t *testing.T) {
+	report := Report{Directories: []DirectoryResult{{
+		Path: "song",
+		BmsFiles: []BmsFileResult{{Path: "song/test.bms", Diagnostics: Logs{
+			{Rule: "bms.note-overlap", Level: Error, Message: "Placed notes overlap", Message_ja: "配置されているノーツが重なり合っています",
+				Path: "song/test.bms", Line: 4, Column: 8},
+			{Rule: "bms.note-overlap", Level: Warning, Message: "Placed notes overlap", Message_ja: "配置されているノーツが重なり合っています",
+				Path: "song/test.bms", Line: 6, Column: 10},
+			{Rule: "bms.difficulty-undefined", Level: Notice, Message: "#DIFFICULTY is 0(Undefined)", Message_ja: "#DIFFICULTYが0(未定義)です",
+				Path: "song/test.bms", Line: 2},
+		}}},
+		BmsonFiles: []BmsFileResult{},
+		Diagnostics: Logs{
+			{Rule: "dir.file-unused", Level: Warning, Message: "Unused file", Message_ja: "使われていないファイルがあります", Path: "song/x.wav"},
+		},
+	}}}
+	var buf bytes.Buffer
+	if err := WriteJUnit(&buf, &report, "ja"); err != nil {
+		t.Fatal(err)
+	}
+
+	var got junitTestSuites
+	if err := xml.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Suites) != 1 || got.Suites[0].Name != "song" {
+		t.Fatalf("invalid testsuites: %s", buf.String())
+	}
+	wantTests := len(checksOfRulePrefix("bms.")) + len(checksOfRulePrefix("dir."))
+	if got.Tests != wantTests || got.Failures != 2 {
+		t.Errorf("count: got = %d/%d, want = %d/2", got.Tests, got.Failures, wantTests)
+	}
+
+	cases := map[string]junitTestCase{}
+	for _, testCase := range got.Suites[0].Cases {
+		cases[testCase.Classname+" "+testCase.Name] = testCase
+	}
+	overlap := cases["song/test.bms CheckNoteOverlap"]
+	if overlap.Failure == nil || overlap.Failure.Type != "bms.note-overlap" ||
+		overlap.Failure.Message != "ERROR: 配置されているノーツが重なり合っています (他1件)" ||
+		overlap.Failure.Text != "ERROR bms.note-overlap: song/test.bms:4:8: 配置されているノーツが重なり合っています\n"+
+			"WARNING bms.note-overlap: song/test.bms:6:10: 配置されているノーツが重なり合っています\n" {
+		t.Errorf("overlap testcase: got = %+v", overlap.Failure)
+	}
+	if count := bytes.Count(buf.Bytes(), []byte("<failure ")); count != 2 {
+		t.Errorf("failure elements: got = %d, want = 2", count)
+	}
+	header := cases["song/test.bms CheckHeaderCommands"]
+	if header.Failure != nil || header.SystemOut == "" {
+		t.Errorf("header testcase: got = %+v", header)
+	}
+	unused := cases["song CheckUnusedFile"]
+	if unused.Failure == nil || unused.Failure.Type != "dir.file-unused" {
+		t.Errorf("unused testcase: got = %+v", unused)
+	}
+}
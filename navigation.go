@@ -0,0 +1,87 @@
+package checkbms
+
+import (
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// エディタのホバー、定義へのジャンプ、ファイル名の補完のために、BMSの位置からオブジェや定義を調べる
+
+// オブジェの行に配置されたオブジェと、その値の定義
+type ObjectReference struct {
+	Line           int    // オブジェの行番号(1始まり)
+	Column         int    // オブジェの値の1文字目の列番号(1始まり、バイト単位)
+	Text           string // "#001 11 (0/1) #WAV01 (a.wav)"の形式
+	Command        string // 値の定義のコマンド(WAV01など、大文字)。BPMチャンネルなど定義を参照しないオブジェなら空
+	Definition     string // 定義の値。定義されていなければ空
+	DefinitionLine int    // 定義の行番号。定義されていなければ0
+}
+
+// line行のcolumn列(1始まり、バイト単位)にあるオブジェを返す。
+// #RANDOMの分岐の中のオブジェなら、その分岐で有効な定義を返す
+func (bmsFile *BmsFile) ObjectAt(line, column int) (ObjectReference, bool) {
+	find := func(bf *BmsFile) (ObjectReference, bool) {
+		for _, t := range []objType{Wav, Bmp, Mine, Bpm, ExtendedBpm, Stop, Scroll} {
+			for _, obj := range bf.bmsObjs(t) {
+				if obj.Line != line || column < obj.Column || column >= obj.Column+2 {
+					continue
+				}
+				ref := ObjectReference{Line: obj.Line, Column: obj.Column}
+				if bf.headerIndexedDefs(t) == nil {
+					ref.Text = obj.string(nil)
+					return ref, true
+				}
+				ref.Text = obj.string(bf)
+				ref.Command = strings.ToUpper(t.string() + obj.value36())
+				for _, def := range bf.headerIndexedDefs(t) {
+					if def.Index == obj.value36() {
+						ref.Definition, ref.DefinitionLine = def.Value, def.Line
+					}
+				}
+				return ref, true
+			}
+		}
+		return ObjectReference{}, false
+	}
+	for i := range bmsFile.Branches {
+		if ref, ok := find(&bmsFile.Branches[i]); ok {
+			return ref, true
+		}
+	}
+	return find(bmsFile)
+}
+
+// ファイル名を値に取るヘッダーと、補完する拡張子。nilなら全てのファイル
+var fileCommandPatterns = []struct {
+	pattern *regexp.Regexp
+	exts    []string
+}{
+	{regexp.MustCompile(`(?i)^#wav[0-9a-z]{2}[ \t]+`), AUDIO_EXTS},
+	{regexp.MustCompile(`(?i)^#bmp[0-9a-z]{2}[ \t]+`), BMP_EXTS},
+	{regexp.MustCompile(`(?i)^#(?:stagefile|banner|backbmp)[ \t]+`), IMAGE_EXTS},
+	{regexp.MustCompile(`(?i)^#preview[ \t]+`), AUDIO_EXTS},
+}
+
+// 行の先頭からカーソルまでの文字列linePrefixがファイル名を値に取るヘッダーなら、
+// bmsDirのBMS以外のファイルのフォルダからの相対パスと、値の1文字目の列番号(1始まり、バイト単位)を返す
+func FileCompletions(bmsDir *Directory, linePrefix string) ([]string, int) {
+	trimmed := strings.TrimLeftFunc(linePrefix, func(r rune) bool { return r == ' ' || r == '\t' })
+	indent := len(linePrefix) - len(trimmed)
+	for _, fc := range fileCommandPatterns {
+		loc := fc.pattern.FindStringIndex(trimmed)
+		if loc == nil {
+			continue
+		}
+		paths := []string{}
+		for _, file := range bmsDir.NonBmsFiles {
+			if fc.exts == nil || hasExts(file.Path, fc.exts) {
+				paths = append(paths, relativePathFromBmsRoot(bmsDir.Path, filepath.Clean(file.Path)))
+			}
+		}
+		sort.Strings(paths)
+		return paths, indent + loc[1] + 1
+	}
+	return nil, 0
+}
@@ -0,0 +1,84 @@
+package checkbms
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestObjectAt(t *testing.T) {
+	bmsFile := newTestBmsFile("test.bms",
+		"#WAV01 a.wav",
+		"#BPM01 180",
+		"#00111:0001",
+		"#00108:01",
+		"#00103:78",
+		"#RANDOM 2",
+		"#IF 1",
+		"#WAV02 b1.wav",
+		"#ENDIF",
+		"#IF 2",
+		"#WAV02 b2.wav",
+		"#00112:02",
+		"#ENDIF",
+		"#ENDRANDOM",
+	)
+	if err := bmsFile.ScanBmsFile(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name         string
+		line, column int
+		want         ObjectReference
+		wantOk       bool
+	}{
+		{"wav", 3, 10, ObjectReference{Line: 3, Column: 10, Text: "#001 11 (1/2) #WAV01 (a.wav)", Command: "WAV01", Definition: "a.wav", DefinitionLine: 1}, true},
+		{"second char", 3, 11, ObjectReference{Line: 3, Column: 10, Text: "#001 11 (1/2) #WAV01 (a.wav)", Command: "WAV01", Definition: "a.wav", DefinitionLine: 1}, true},
+		{"zero", 3, 8, ObjectReference{}, false},
+		{"extended bpm", 4, 8, ObjectReference{Line: 4, Column: 8, Text: "#001 08 (0/1) #BPM01 (180)", Command: "BPM01", Definition: "180", DefinitionLine: 2}, true},
+		{"bpm without definition", 5, 8, ObjectReference{Line: 5, Column: 8, Text: "#001 03 (0/1) #BPM78"}, true},
+		{"branch definition", 12, 8, ObjectReference{Line: 12, Column: 8, Text: "#001 12 (0/1) #WAV02 (b2.wav)", Command: "WAV02", Definition: "b2.wav", DefinitionLine: 11}, true},
+		{"header line", 1, 2, ObjectReference{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := bmsFile.ObjectAt(tt.line, tt.column)
+			if ok != tt.wantOk || got != tt.want {
+				t.Errorf("ObjectAt(%d, %d) = %+v, %t, want %+v, %t", tt.line, tt.column, got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
+
+func TestFileCompletions(t *testing.T) {
+	dirPath := filepath.Join("songs", "song")
+	bmsDir := &Directory{File: File{Path: dirPath}, NonBmsFiles: []NonBmsFile{
+		{File: File{Path: filepath.Join(dirPath, "b.ogg")}},
+		{File: File{Path: filepath.Join(dirPath, "sounds", "a.wav")}},
+		{File: File{Path: filepath.Join(dirPath, "bg.png")}},
+		{File: File{Path: filepath.Join(dirPath, "movie.mp4")}},
+		{File: File{Path: filepath.Join(dirPath, "readme.txt")}},
+	}}
+
+	tests := []struct {
+		linePrefix string
+		want       []string
+		wantColumn int
+	}{
+		{"#WAV01 ", []string{"b.ogg", filepath.Join("sounds", "a.wav")}, 8},
+		{"  #wavzz  sou", []string{"b.ogg", filepath.Join("sounds", "a.wav")}, 11},
+		{"#BMP01 ", []string{"bg.png", "movie.mp4"}, 8},
+		{"#STAGEFILE ", []string{"bg.png"}, 12},
+		{"#PREVIEW ", []string{"b.ogg", filepath.Join("sounds", "a.wav")}, 10},
+		{"#WAV01", nil, 0},
+		{"#TITLE ", nil, 0},
+		{"#00111:", nil, 0},
+	}
+	for _, tt := range tests {
+		got, column := FileCompletions(bmsDir, tt.linePrefix)
+		if !reflect.DeepEqual(got, tt.want) || column != tt.wantColumn {
+			t.Errorf("FileCompletions(%q) = %v, %d, want %v, %d", tt.linePrefix, got, column, tt.want, tt.wantColumn)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package checkbms
+
+import (
+	"context"
+	"errors"
+	"runtime"
+)
+
+// CheckDirectoriesで読み込んでチェックしたフォルダ
+type DirectoryCheckResult struct {
+	Path      string
+	Directory *Directory      // キャッシュの結果を使った場合や、Errがnilでなければnil
+	Result    DirectoryResult // Errがnilなら、Directoryの結果かキャッシュの結果
+	Err       error           // フォルダの読み込みや設定ファイルの読み込みに失敗した場合
+}
+
+// path以下のBMSフォルダをjobs個のワーカーで並列に読み込んでチェックし、結果をScanDirectoryと同じ順でチャンネルに送る。
+// jobsが0以下ならCPU数。configがnilでなければ、各フォルダの設定はconfig.ForDirectoryで読み込む。
+// 順番待ちの結果を含めて同時に持つフォルダはjobs個までなので、結果を受け取るまで次のフォルダは読み込まれない。
+// ctxがキャンセルされると新しいフォルダの読み込みを止め、チャンネルを閉じる。
+// 読み込めないフォルダがあれば、チャンネルと共にScanErrorsを返す。pathそのものが読み込めなければそのエラーを返す
+func CheckDirectories(ctx context.Context, path string, jobs int, config *Config, doDiffCheck bool) (<-chan DirectoryCheckResult, error) {
+	return CheckDirectoriesWithCache(ctx, path, jobs, config, doDiffCheck, nil)
+}
+
+// CheckDirectoriesと同じだが、cacheがnilでなければ、ファイルに変更の無いフォルダはcacheの結果を使い、
+// 読み込んだフォルダの結果をcacheに入れる。一部のファイルを読み込めなかったフォルダはcacheに入れない
+func CheckDirectoriesWithCache(ctx context.Context, path string, jobs int, config *Config, doDiffCheck bool, cache *Cache) (<-chan DirectoryCheckResult, error) {
+	dirPaths, err := FindBmsDirectories(path)
+	var scanErrors ScanErrors
+	if err != nil && !errors.As(err, &scanErrors) {
+		return nil, err
+	}
+	if jobs <= 0 {
+		jobs = runtime.NumCPU()
+	}
+
+	// フォルダごとの結果。受け取る側が順番に読む
+	results := make([]chan DirectoryCheckResult, len(dirPaths))
+	for i := range results {
+		results[i] = make(chan DirectoryCheckResult, 1)
+	}
+	// 結果を送り出すまで枠を返さない
+	slots := make(chan struct{}, jobs)
+
+	go func() {
+		for i, dirPath := range dirPaths {
+			select {
+			case slots <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			go func(i int, dirPath string) {
+				results[i] <- checkDirectory(ctx, dirPath, config, doDiffCheck, cache)
+			}(i, dirPath)
+		}
+	}()
+
+	out := make(chan DirectoryCheckResult)
+	go func() {
+		defer close(out)
+		for i := range results {
+			if ctx.Err() != nil {
+				return
+			}
+			var result DirectoryCheckResult
+			select {
+			case result = <-results[i]:
+			case <-ctx.Done():
+				return
+			}
+			select {
+			case out <- result:
+				<-slots
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return out, err
+}
+
+func checkDirectory(ctx context.Context, path string, config *Config, doDiffCheck bool, cache *Cache) DirectoryCheckResult {
+	if err := ctx.Err(); err != nil {
+		return DirectoryCheckResult{Path: path, Err: err}
+	}
+	var dirConfig *Config
+	if config != nil {
+		var err error
+		if dirConfig, err = config.ForDirectory(path); err != nil {
+			return DirectoryCheckResult{Path: path, Err: err}
+		}
+	}
+
+	cacheKey := ""
+	if cache != nil {
+		// キーを作れなければキャッシュを使わずにチェックする
+		cacheKey, _ = directoryCacheKey(path, configOrDefault(dirConfig), doDiffCheck)
+		if result, ok := cache.directoryResult(path, cacheKey); ok && cacheKey != "" {
+			return DirectoryCheckResult{Path: path, Result: result}
+		}
+	}
+
+	dir, err := ScanBmsDirectory(path, true, true)
+	if err != nil {
+		return DirectoryCheckResult{Path: path, Err: err}
+	}
+	defer dir.Close()
+	dir.Config = dirConfig
+	dir.Cache = cache
+	CheckBmsDirectory(dir, doDiffCheck)
+	result := NewDirectoryResult(dir)
+	if cacheKey != "" && len(dir.ScanErrors) == 0 {
+		cache.storeDirectoryResult(path, cacheKey, result)
+	}
+	return DirectoryCheckResult{Path: path, Directory: dir, Result: result}
+}
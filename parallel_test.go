@@ -0,0 +1,71 @@
+package checkbms
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func newTestLibrary(t *testing.T, count int) string {
+	root := t.TempDir()
+	for i := 0; i < count; i++ {
+		dir := filepath.Join(root, fmt.Sprintf("song%02d", i))
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "a.bms"), []byte(fmt.Sprintf("#TITLE song%02d\r\n", i)), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func TestCheckDirectories(t *testing.T) {
+	root := newTestLibrary(t, 10)
+	wantPaths, err := FindBmsDirectories(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := CheckDirectories(context.Background(), root, 3, DefaultConfig(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gotPaths := []string{}
+	for result := range results {
+		if result.Err != nil {
+			t.Fatalf("%s: %s", result.Path, result.Err.Error())
+		}
+		if result.Directory.Path != result.Path || len(result.Directory.BmsFiles) != 1 {
+			t.Errorf("%s: got = %s with %d bms files", result.Path, result.Directory.Path, len(result.Directory.BmsFiles))
+		}
+		if len(result.Directory.BmsFiles[0].Logs) == 0 {
+			t.Errorf("%s: not checked", result.Path)
+		}
+		gotPaths = append(gotPaths, result.Path)
+	}
+	if fmt.Sprint(gotPaths) != fmt.Sprint(wantPaths) {
+		t.Errorf("order: got = %v\nwant = %v", gotPaths, wantPaths)
+	}
+}
+
+func TestCheckDirectoriesCancel(t *testing.T) {
+	root := newTestLibrary(t, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	results, err := CheckDirectories(ctx, root, 2, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-results
+	cancel()
+	count := 1
+	for range results {
+		count++
+	}
+	// キャンセルの時点で送ろうとしていた結果までで止まる
+	if count > 2 {
+		t.Errorf("results: got = %d, want 2 or less after cancel", count)
+	}
+}
@@ -0,0 +1,143 @@
+package checkbms
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// JSONなどで出力するためのチェック結果。BMSのデータ本体は含まない
+type Report struct {
+	Directories []DirectoryResult `json:"directories,omitempty"`
+	BmsFiles    []BmsFileResult   `json:"bmsFiles,omitempty"`   // ファイル単体をチェックした場合
+	BmsonFiles  []BmsFileResult   `json:"bmsonFiles,omitempty"` // ファイル単体をチェックした場合
+
+	FixedBaselineEntries []BaselineEntry `json:"fixedBaselineEntries,omitempty"` // ベースラインにあって今回のログに無いエントリ
+}
+
+type DirectoryResult struct {
+	Path        string          `json:"path"`
+	BmsFiles    []BmsFileResult `json:"bmsFiles"`
+	BmsonFiles  []BmsFileResult `json:"bmsonFiles"`
+	Diagnostics Logs            `json:"diagnostics"`
+}
+
+type BmsFileResult struct {
+	Path        string   `json:"path"`
+	Sha256      string   `json:"sha256"`
+	Keymode     int      `json:"keymode"`
+	TotalNotes  int      `json:"totalNotes"`
+	Encoding    Encoding `json:"encoding,omitempty"`
+	IsInvalid   bool     `json:"isInvalid,omitempty"` // bmsonフォーマットエラーで無効なファイル
+	Diagnostics Logs     `json:"diagnostics"`
+}
+
+func NewBmsFileResult(bmsFileBase *BmsFileBase) BmsFileResult {
+	return BmsFileResult{
+		Path:        bmsFileBase.Path,
+		Sha256:      bmsFileBase.Sha256,
+		Keymode:     bmsFileBase.Keymode,
+		TotalNotes:  bmsFileBase.TotalNotes,
+		Encoding:    bmsFileBase.Encoding,
+		Diagnostics: nonNilLogs(bmsFileBase.Logs),
+	}
+}
+
+func NewBmsonFileResult(bmsonFile *BmsonFile) BmsFileResult {
+	result := NewBmsFileResult(&bmsonFile.BmsFileBase)
+	result.IsInvalid = bmsonFile.IsInvalid
+	return result
+}
+
+func NewDirectoryResult(bmsDir *Directory) DirectoryResult {
+	result := DirectoryResult{
+		Path:        bmsDir.Path,
+		BmsFiles:    []BmsFileResult{},
+		BmsonFiles:  []BmsFileResult{},
+		Diagnostics: nonNilLogs(bmsDir.Logs),
+	}
+	for i := range bmsDir.BmsFiles {
+		result.BmsFiles = append(result.BmsFiles, NewBmsFileResult(&bmsDir.BmsFiles[i].BmsFileBase))
+	}
+	for i := range bmsDir.BmsonFiles {
+		result.BmsonFiles = append(result.BmsonFiles, NewBmsonFileResult(&bmsDir.BmsonFiles[i]))
+	}
+	return result
+}
+
+// JSONで空のログが null ではなく [] になるようにする
+func nonNilLogs(logs Logs) Logs {
+	if logs == nil {
+		return Logs{}
+	}
+	return logs
+}
+
+// フォルダ、ファイルの全てのログを返す
+func (r Report) allLogs() (logs Logs) {
+	for _, dir := range r.Directories {
+		for _, bmsFile := range dir.BmsFiles {
+			logs = append(logs, bmsFile.Diagnostics...)
+		}
+		for _, bmsonFile := range dir.BmsonFiles {
+			logs = append(logs, bmsonFile.Diagnostics...)
+		}
+		logs = append(logs, dir.Diagnostics...)
+	}
+	for _, bmsFile := range r.BmsFiles {
+		logs = append(logs, bmsFile.Diagnostics...)
+	}
+	for _, bmsonFile := range r.BmsonFiles {
+		logs = append(logs, bmsonFile.Diagnostics...)
+	}
+	return logs
+}
+
+// level未満のログを取り除く
+func (r *Report) FilterLevel(level AlertLevel) {
+	filter := func(logs Logs) Logs {
+		filtered := Logs{}
+		for _, log := range logs {
+			if log.Level.IsAtLeast(level) {
+				filtered = append(filtered, log)
+			}
+		}
+		return filtered
+	}
+	filterFiles := func(results []BmsFileResult) {
+		for i := range results {
+			results[i].Diagnostics = filter(results[i].Diagnostics)
+		}
+	}
+	for i := range r.Directories {
+		filterFiles(r.Directories[i].BmsFiles)
+		filterFiles(r.Directories[i].BmsonFiles)
+		r.Directories[i].Diagnostics = filter(r.Directories[i].Diagnostics)
+	}
+	filterFiles(r.BmsFiles)
+	filterFiles(r.BmsonFiles)
+}
+
+// level以上のログがあるか
+func (r Report) HasLevel(level AlertLevel) bool {
+	for _, log := range r.allLogs() {
+		if log.Level.IsAtLeast(level) {
+			return true
+		}
+	}
+	return false
+}
+
+// reportを1つのJSONドキュメントとして書き出す
+func WriteJSON(w io.Writer, report *Report) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.SetEscapeHTML(false)
+	return encoder.Encode(report)
+}
+
+// DirectoryResultやBmsFileResultを1行のJSONとして書き出す(NDJSON)
+func WriteNDJSON(w io.Writer, result interface{}) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	return encoder.Encode(result)
+}
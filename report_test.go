@@ -0,0 +1,66 @@
+package checkbms
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestWriteJSON(t *testing.T) {
+	bmsFile := newTestBmsFile("test.bms", "#WAV01 a.wav", "#00111:01", "#00111:01")
+	if err := bmsFile.ScanBmsFile(); err != nil {
+		t.Fatal(err)
+	}
+	CheckBmsFile(bmsFile)
+	bmsonFile := NewBmsonFile(&BmsFileBase{File: File{Path: "test.bmson"}})
+
+	report := Report{BmsFiles: []BmsFileResult{NewBmsFileResult(&bmsFile.BmsFileBase)}, BmsonFiles: []BmsFileResult{NewBmsonFileResult(bmsonFile)}}
+	var buf bytes.Buffer
+	if err := WriteJSON(&buf, &report); err != nil {
+		t.Fatal(err)
+	}
+
+	var got Report
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.BmsFiles) != 1 || got.BmsFiles[0].Path != "test.bms" || got.BmsFiles[0].TotalNotes != 2 {
+		t.Fatalf("bmsFiles: got = %+v", got.BmsFiles)
+	}
+	if len(got.BmsFiles[0].Diagnostics) != len(bmsFile.Logs) {
+		t.Errorf("diagnostics count: got = %d, want = %d", len(got.BmsFiles[0].Diagnostics), len(bmsFile.Logs))
+	}
+	for i, log := range got.BmsFiles[0].Diagnostics {
+		if log.String() != bmsFile.Logs[i].String() || log.Rule != bmsFile.Logs[i].Rule || log.Location() != bmsFile.Logs[i].Location() {
+			t.Errorf("diagnostic: got = %+v, want = %+v", log, bmsFile.Logs[i])
+		}
+	}
+	if !bytes.Contains(buf.Bytes(), []byte(`"diagnostics": []`)) {
+		t.Errorf("empty diagnostics must be []: %s", buf.String())
+	}
+}
+
+func TestReportFilterLevel(t *testing.T) {
+	report := Report{Directories: []DirectoryResult{{
+		Path: "song",
+		BmsFiles: []BmsFileResult{{Path: "song/a.bms", Diagnostics: Logs{
+			{Rule: "bms.header-missing", Level: Warning},
+			{Rule: "bms.rank-unusual", Level: Notice},
+		}}},
+		Diagnostics: Logs{{Rule: "dir.file-unused", Level: Notice}},
+	}}}
+	if report.HasLevel(Error) || !report.HasLevel(Warning) || !report.HasLevel(Notice) {
+		t.Errorf("HasLevel: got = %v/%v/%v, want = false/true/true", report.HasLevel(Error), report.HasLevel(Warning), report.HasLevel(Notice))
+	}
+	report.FilterLevel(Warning)
+	if logs := report.allLogs(); len(logs) != 1 || logs[0].Rule != "bms.header-missing" {
+		t.Errorf("FilterLevel: got = %+v", logs)
+	}
+
+	if level, err := ParseAlertLevel("warning"); err != nil || level != Warning {
+		t.Errorf("ParseAlertLevel: got = %s, %v", level, err)
+	}
+	if _, err := ParseAlertLevel("debug"); err == nil {
+		t.Errorf("ParseAlertLevel: invalid level is not error")
+	}
+}
@@ -0,0 +1,118 @@
+package checkbms
+
+// チェック項目の種類。Log.RuleにIDが入る
+type Rule struct {
+	ID             string
+	Description    string
+	Description_ja string
+	Check          string // このルールのログを出すチェック関数名
+}
+
+// ルールIDは一度公開したら変更しない
+var RULES = []Rule{
+	// BMSファイル
+	{ID: "bms.definition-duplicate", Description: "Header or indexed definition is defined more than once", Description_ja: "ヘッダや定義が重複しています", Check: "ScanBmsFile"},
+	{ID: "bms.invalid-line", Description: "Line cannot be interpreted as BMS", Description_ja: "BMSとして解釈できない行があります", Check: "ScanBmsFile"},
+	{ID: "bms.line-undecodable", Description: "Line contains bytes that cannot be decoded in the file encoding", Description_ja: "ファイルの文字コードでデコードできないバイトを含む行があります", Check: "ScanBmsFile"},
+	{ID: "bms.charset-utf8", Description: "BMS file charset is UTF-8, not Shift-JIS", Description_ja: "BMSファイルの文字コードがShift-JISではなくUTF-8です", Check: "ScanBmsFile"},
+	{ID: "bms.charset-not-shift-jis", Description: "BMS file charset is neither Shift-JIS nor UTF-8", Description_ja: "BMSファイルの文字コードがShift-JISでもUTF-8でもありません", Check: "ScanBmsFile"},
+	{ID: "bms.header-missing", Description: "Required header definition is missing", Description_ja: "必要なヘッダ定義が見つかりません", Check: "CheckHeaderCommands"},
+	{ID: "bms.header-empty", Description: "Header value is empty", Description_ja: "ヘッダの値が空です", Check: "CheckHeaderCommands"},
+	{ID: "bms.header-invalid", Description: "Header has invalid value", Description_ja: "ヘッダの値が無効です", Check: "CheckHeaderCommands"},
+	{ID: "bms.rank-unusual", Description: "#RANK is an unusual judge rank", Description_ja: "#RANKが一般的でない判定ランクです", Check: "CheckHeaderCommands"},
+	{ID: "bms.total-under-100", Description: "#TOTAL is under 100", Description_ja: "#TOTALが100未満です", Check: "CheckHeaderCommands"},
+	{ID: "bms.total-too-high", Description: "#TOTAL is very high for the number of notes", Description_ja: "#TOTALがノーツ数に対してかなり高いです", Check: "CheckHeaderCommands"},
+	{ID: "bms.total-too-low", Description: "#TOTAL is very low for the number of notes", Description_ja: "#TOTALがノーツ数に対してかなり低いです", Check: "CheckHeaderCommands"},
+	{ID: "bms.difficulty-undefined", Description: "#DIFFICULTY is 0(Undefined)", Description_ja: "#DIFFICULTYが0(未定義)です", Check: "CheckHeaderCommands"},
+	{ID: "bms.defexrank-defined", Description: "#DEFEXRANK is defined", Description_ja: "#DEFEXRANKが定義されています", Check: "CheckHeaderCommands"},
+	{ID: "bms.lntype-deprecated", Description: "#LNTYPE 2(MGQ) is deprecated", Description_ja: "#LNTYPE 2(MGQ)は非推奨です", Check: "CheckHeaderCommands"},
+	{ID: "bms.title-contains-subtitle", Description: "The end of #TITLE contains #SUBTITLE", Description_ja: "#TITLEの末尾に#SUBTITLEを含んでいます", Check: "CheckTitleAndSubtitleHaveSameText"},
+	{ID: "bms.indexed-definition-missing", Description: "Required indexed definition(#WAVxx etc.) is missing", Description_ja: "必要な#WAVxxなどの定義が見つかりません", Check: "CheckIndexedDefinitionsHaveInvalidValue"},
+	{ID: "bms.indexed-definition-empty", Description: "Indexed definition(#WAVxx etc.) value is empty", Description_ja: "#WAVxxなどの定義の値が空です", Check: "CheckIndexedDefinitionsHaveInvalidValue"},
+	{ID: "bms.indexed-definition-invalid", Description: "Indexed definition(#WAVxx etc.) has invalid value", Description_ja: "#WAVxxなどの定義の値が無効です", Check: "CheckIndexedDefinitionsHaveInvalidValue"},
+	{ID: "bms.wav-non-wav-extension", Description: "#WAV definition has non-.wav extension", Description_ja: "#WAVに拡張子.wavでない定義があります", Check: "CheckIndexedDefinitionsHaveInvalidValue"},
+	{ID: "bms.totalnotes-zero", Description: "TotalNotes is 0", Description_ja: "トータルノーツ数が0です", Check: "CheckTotalnotesIsZero"},
+	{ID: "bms.note-in-0th-measure", Description: "Note exists in 0th measure", Description_ja: "0小節目にノーツが配置されています", Check: "CheckWavObjExistsIn0thMeasure"},
+	{ID: "bms.object-undefined", Description: "Placed object is undefined", Description_ja: "配置されているオブジェが未定義です", Check: "CheckPlacedObjIsDefinedAndDefinedHeaderIsPlaced"},
+	{ID: "bms.definition-unplaced", Description: "Defined object is not placed", Description_ja: "定義されているオブジェが未配置です", Check: "CheckPlacedObjIsDefinedAndDefinedHeaderIsPlaced"},
+	{ID: "bms.mine-sound-unused", Description: "Mine explosion wav(#WAV00) is not used", Description_ja: "地雷爆発音(#WAV00)が使用されていません", Check: "CheckSoundOfMineExplosionIsUsed"},
+	{ID: "bms.wav-duplicate", Description: "Same WAV objects are placed at the same position", Description_ja: "同じWAVオブジェが同じ位置に重複して配置されています", Check: "CheckWavDuplicate"},
+	{ID: "bms.note-overlap", Description: "Notes overlap in the same lane", Description_ja: "同じレーンでノーツが重なり合っています", Check: "CheckNoteOverlap"},
+	{ID: "bms.note-in-ln", Description: "Note is placed in LN", Description_ja: "ノーツがLNの中に配置されています", Check: "CheckEndOfLNExistsAndNotesInLN"},
+	{ID: "bms.ln-end-missing", Description: "End of LN is missing", Description_ja: "LNの終端がありません", Check: "CheckEndOfLNExistsAndNotesInLN"},
+	{ID: "bms.bpm-object-invalid", Description: "BPM object has invalid value", Description_ja: "BPMオブジェの値が無効です", Check: "CheckBpmValue"},
+	{ID: "bms.measure-length-invalid", Description: "Measure length has invalid value", Description_ja: "小節長の値が無効です", Check: "CheckMeasureLength"},
+	{ID: "bms.measure-length-duplicate", Description: "Measure length is defined more than once", Description_ja: "小節長が重複しています", Check: "CheckMeasureLength"},
+	{ID: "bms.moment-without-keysound", Description: "Moments without keysound exist", Description_ja: "キー音の無い瞬間があります", Check: "CheckWithoutKeysound"},
+	{ID: "bms.note-without-keysound", Description: "Notes without keysound exist", Description_ja: "キー音の無いノーツがあります", Check: "CheckWithoutKeysound"},
+	{ID: "bms.branch-sampled", Description: "Too many #RANDOM branch combinations, so only some of them are checked", Description_ja: "#RANDOMの分岐の組み合わせが多すぎるため、一部のみチェックしています", Check: "ScanBmsFile"},
+	{ID: "bms.control-unmatched", Description: "Control command has no corresponding opening command", Description_ja: "制御構文に対応する開始コマンドがありません", Check: "ScanBmsFile"},
+	{ID: "bms.control-unclosed", Description: "Control block is not closed", Description_ja: "制御構文のブロックが閉じられていません", Check: "ScanBmsFile"},
+	{ID: "bms.control-invalid-value", Description: "Control command has invalid value", Description_ja: "制御構文の値が無効です", Check: "ScanBmsFile"},
+	{ID: "bms.control-out-of-range", Description: "Branch value is out of range of #RANDOM/#SWITCH", Description_ja: "分岐の値が#RANDOM/#SWITCHの範囲外です", Check: "ScanBmsFile"},
+	{ID: "bms.header-redefined-in-branch", Description: "Header is redefined inside a branch", Description_ja: "ヘッダが分岐の中で再定義されています", Check: "ScanBmsFile"},
+	{ID: "bms.suppression-invalid", Description: "Suppression comment has no valid rule ID", Description_ja: "抑制コメントに有効なルールIDがありません", Check: "ScanBmsFile"},
+	{ID: "bms.suppression-unused", Description: "Suppression comment is not used", Description_ja: "抑制コメントが使われていません", Check: "CheckBmsFile"},
+	{ID: "bms.branch-header-not-unified", Description: "Header differs between branches", Description_ja: "ヘッダが分岐ごとに異なります", Check: "CheckBranchHeadersAreUnified"},
+
+	// bmsonファイル
+	{ID: "bmson.format-invalid", Description: "bmson is not valid JSON", Description_ja: "bmsonのフォーマットが無効です", Check: "ScanBmsonFile"},
+	{ID: "bmson.field-invalid", Description: "Invalid field name", Description_ja: "無効なフィールド名です", Check: "ScanBmsonFile"},
+	{ID: "bmson.type-invalid", Description: "Field value has invalid type", Description_ja: "フィールドの値の型が無効です", Check: "ScanBmsonFile"},
+	{ID: "bmson.field-duplicate", Description: "Field is defined more than once", Description_ja: "フィールドが重複しています", Check: "ScanBmsonFile"},
+	{ID: "bmson.value-missing", Description: "Field has no value", Description_ja: "フィールドに値がありません", Check: "ScanBmsonFile"},
+	{ID: "bmson.value-empty", Description: "Field value is empty", Description_ja: "フィールドの値が空です", Check: "ScanBmsonFile"},
+	{ID: "bmson.value-out-of-range", Description: "Field value is out of range", Description_ja: "フィールドの値が定義範囲外です", Check: "ScanBmsonFile"},
+	{ID: "bmson.judge-rank-too-high", Description: "info.judge_rank is very high", Description_ja: "info.judge_rankがかなり高いです", Check: "CheckBmsonInfo"},
+	{ID: "bmson.judge-rank-too-low", Description: "info.judge_rank is very low", Description_ja: "info.judge_rankがかなり低いです", Check: "CheckBmsonInfo"},
+	{ID: "bmson.total-under-100", Description: "Real total value is under 100", Description_ja: "実際のTotal値が100未満です", Check: "CheckBmsonInfo"},
+	{ID: "bmson.total-too-high", Description: "info.total is very high for the number of notes", Description_ja: "info.totalがノーツ数に対してかなり高いです", Check: "CheckBmsonInfo"},
+	{ID: "bmson.total-too-low", Description: "info.total is very low for the number of notes", Description_ja: "info.totalがノーツ数に対してかなり低いです", Check: "CheckBmsonInfo"},
+	{ID: "bmson.title-texts-duplicate", Description: "Title fields contain the same string", Description_ja: "タイトルのフィールドが同じ文字列を含んでいます", Check: "CheckTitleTextsAreDuplicate"},
+	{ID: "bmson.sound-channel-name-invalid", Description: "sound_channels name is invalid", Description_ja: "sound_channelsのnameが無効です", Check: "CheckSoundChannelNameIsInvalid"},
+	{ID: "bmson.sound-channel-no-notes", Description: "sound_channels notes is empty", Description_ja: "sound_channelsのnotesが空です", Check: "CheckNonNotesSoundChannel"},
+	{ID: "bmson.sound-channel-non-wav-extension", Description: "sound_channels has filenames non-.wav extension", Description_ja: "sound_channelsに拡張子.wavでないファイル名があります", Check: "CheckNoWavSoundChannels"},
+	{ID: "bmson.bga-id-undefined", Description: "Placed BGA id is undefined", Description_ja: "配置されているBGAのidが未定義です", Check: "CheckPlacedUndefiedBgaIds"},
+	{ID: "bmson.bga-header-unplaced", Description: "Defined bga_header is not placed", Description_ja: "定義されているbga_headerが未配置です", Check: "CheckDefinedUnplacedBgaHeader"},
+	{ID: "bmson.bga-header-id-duplicate", Description: "bga_header has duplicate id", Description_ja: "bga_headerでidが重複しています", Check: "CheckBgaHeaderIdIsDuplicate"},
+	{ID: "bmson.y-duplicate", Description: "Events have duplicate y values", Description_ja: "イベントのy値が重複しています", Check: "CheckDuplicateY"},
+	{ID: "bmson.note-in-0th-measure", Description: "Note exists in 0th measure", Description_ja: "0小節目にノーツが配置されています", Check: "CheckSoundNotesIn0thMeasure"},
+	{ID: "bmson.first-note-continue", Description: "First note of sound channel has c:true", Description_ja: "サウンドチャンネルの最初のノーツがc:trueになっています", Check: "CheckFirstNoteHasContinueFlag"},
+	{ID: "bmson.note-out-of-lane", Description: "note.x is out of lane range", Description_ja: "ノーツのx位置がレーンの範囲外です", Check: "CheckOutOfLaneNotes"},
+	{ID: "bmson.note-in-ln", Description: "Note is placed in LN", Description_ja: "ノーツがLNの中に配置されています", Check: "CheckNoteInLNBmson"},
+	{ID: "bmson.moment-without-keysound", Description: "Moments without keysound exist", Description_ja: "キー音の無い瞬間があります", Check: "CheckWithoutKeysoundBmson"},
+	{ID: "bmson.note-without-keysound", Description: "Notes without keysound exist", Description_ja: "キー音の無いノーツがあります", Check: "CheckWithoutKeysoundBmson"},
+
+	// BMSフォルダ
+	{ID: "dir.file-not-found", Description: "Defined file does not exist", Description_ja: "定義されているファイルが実在しません", Check: "CheckDefinedFilesExist"},
+	{ID: "dir.definitions-not-unified", Description: "Definitions are not unified between charts", Description_ja: "定義が譜面間で統一されていません", Check: "CheckDefinitionsAreUnified"},
+	{ID: "dir.file-unused", Description: "File is not used", Description_ja: "ファイルが使用されていません", Check: "CheckUnusedFile"},
+	{ID: "dir.file-unreadable", Description: "File or directory cannot be read", Description_ja: "ファイルやフォルダを読み込めません", Check: "CheckUnreadableFiles"},
+	{ID: "dir.zip-filename-garbled", Description: "Filename in zip will be garbled when extracted on Japanese Windows", Description_ja: "zip内のファイル名が日本語版Windowsで展開すると文字化けします", Check: "CheckGarbledZipFilenames"},
+	{ID: "dir.directory-empty", Description: "Directory is empty", Description_ja: "フォルダが空です", Check: "CheckEmptyDirectory"},
+	{ID: "dir.filename-environment-dependent", Description: "Filename has environment-dependent characters", Description_ja: "ファイル名が環境依存文字を含んでいます", Check: "CheckEnvironmentDependentFilename"},
+	{ID: "dir.audio-over-1-minute", Description: "Audio file is over 1 minute", Description_ja: "音声ファイルが1分以上あります", Check: "CheckOver1MinuteAudioFile"},
+	{ID: "dir.bmsfiles-same", Description: "BMS files are the same", Description_ja: "BMSファイルが同一です", Check: "CheckSameHashBmsFiles"},
+	{ID: "dir.indexed-definitions-not-unified", Description: "#WAVxx/#BMPxx are not unified between charts", Description_ja: "#WAVxx/#BMPxxが譜面間で統一されていません", Check: "CheckIndexedDefinitionsAreUnified"},
+	{ID: "dir.object-structures-not-unified", Description: "Object structures are not unified between charts", Description_ja: "オブジェ構成が譜面間で統一されていません", Check: "CheckObjectStructuresAreUnified"},
+	{ID: "dir.sound-channels-not-unified", Description: "Starting points of sound_channels are not unified", Description_ja: "sound_channelsの音声開始地点が統一されていません", Check: "CheckSoundChannelsAreUnified"},
+	{ID: "dir.bga-headers-not-unified", Description: "bga_header are not unified", Description_ja: "bga_headerが統一されていません", Check: "CheckBgaHeadersAreUnified"},
+	{ID: "dir.bga-events-not-unified", Description: "BGA events are not unified", Description_ja: "BGAイベントが統一されていません", Check: "CheckBgaEventsAreUnified"},
+	{ID: "dir.definition-diff", Description: "Definitions differ between charts", Description_ja: "譜面間で定義に違いがあります", Check: "CheckDefinitionDiff"},
+	{ID: "dir.object-diff", Description: "Objects differ between charts", Description_ja: "譜面間でオブジェに違いがあります", Check: "CheckObjectDiff"},
+
+	// BMSフォルダ同士の比較
+	{ID: "diff.hash-not-equal", Description: "BMS file texts are not equal", Description_ja: "BMSファイルの内容が一致しません", Check: "DiffBmsDirectories"},
+	{ID: "diff.text-not-equal", Description: "Text file contents are not equal", Description_ja: "テキストファイルの内容が一致しません", Check: "DiffBmsDirectories"},
+	{ID: "diff.file-missing", Description: "File is missing in one directory", Description_ja: "片方のフォルダにファイルが欠落しています", Check: "DiffBmsDirectories"},
+}
+
+// idのRuleを返す
+func RuleByID(id string) (Rule, bool) {
+	for _, rule := range RULES {
+		if rule.ID == id {
+			return rule, true
+		}
+	}
+	return Rule{}, false
+}
@@ -0,0 +1,78 @@
+package checkbms
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestRulesAreRegistered(t *testing.T) {
+	ids := map[string]bool{}
+	for _, rule := range RULES {
+		if ids[rule.ID] {
+			t.Errorf("rule id is duplicate: %s", rule.ID)
+		}
+		ids[rule.ID] = true
+		if rule.Description == "" || rule.Description_ja == "" {
+			t.Errorf("rule description is empty: %s", rule.ID)
+		}
+		if rule.Check == "" {
+			t.Errorf("rule check is empty: %s", rule.ID)
+		}
+	}
+
+	paths, err := filepath.Glob("*.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	used := map[string]bool{}
+	for _, path := range paths {
+		if strings.HasSuffix(path, "_test.go") {
+			continue
+		}
+		bytes, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, match := range regexp.MustCompile(`(?:Rule:\s+|\.log\()"([^"]+)"`).FindAllStringSubmatch(string(bytes), -1) {
+			used[match[1]] = true
+			if !ids[match[1]] {
+				t.Errorf("rule id is not registered in RULES(%s): %s", path, match[1])
+			}
+		}
+	}
+	for id := range ids {
+		if !used[id] {
+			t.Errorf("registered rule id is not used: %s", id)
+		}
+	}
+}
+
+func TestLogHasDiagnosticFields(t *testing.T) {
+	bmsFile := newTestBmsFile("test.bms",
+		"#WAV01 a.wav",
+		"#WAV02 b.wav",
+		"#00111:01",
+		"#00111:02",
+	)
+	if err := bmsFile.ScanBmsFile(); err != nil {
+		t.Fatal(err)
+	}
+	ons := CheckNoteOverlap(bmsFile)
+	if len(ons) != 1 {
+		t.Fatalf("overlap count: got = %d, want = 1", len(ons))
+	}
+	log := ons[0].Log()
+	if log.Rule != "bms.note-overlap" {
+		t.Errorf("rule: got = %s, want = bms.note-overlap", log.Rule)
+	}
+	want := LogObject{Channel: "11", Measure: 1, Numerator: 0, Denominator: 1, Value: "02", Definition: "b.wav"}
+	if log.Object == nil || *log.Object != want {
+		t.Errorf("object: got = %+v, want = %+v", log.Object, want)
+	}
+	if log.Line != 4 || log.Column != 8 {
+		t.Errorf("position: got = %d:%d, want = 4:8", log.Line, log.Column)
+	}
+}
@@ -0,0 +1,171 @@
+package checkbms
+
+import (
+	"encoding/json"
+	"io"
+	"net/url"
+	"path/filepath"
+	"strings"
+)
+
+// SARIF 2.1.0 形式の出力
+// https://docs.oasis-open.org/sarif/sarif/v2.1.0/sarif-v2.1.0.html
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool       sarifTool     `json:"tool"`
+	Language   string        `json:"language"`
+	ColumnKind string        `json:"columnKind"`
+	Results    []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string                     `json:"name"`
+	InformationUri string                     `json:"informationUri"`
+	Rules          []sarifReportingDescriptor `json:"rules"`
+}
+
+type sarifReportingDescriptor struct {
+	Id               string            `json:"id"`
+	ShortDescription sarifMessage      `json:"shortDescription"`
+	Properties       map[string]string `json:"properties,omitempty"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleId           string            `json:"ruleId"`
+	RuleIndex        *int              `json:"ruleIndex,omitempty"` // RULESに無いルールならnil
+	Level            string            `json:"level"`
+	Message          sarifMessage      `json:"message"`
+	Locations        []sarifLocation   `json:"locations,omitempty"`
+	RelatedLocations []sarifLocation   `json:"relatedLocations,omitempty"`
+	Properties       map[string]string `json:"properties,omitempty"`
+}
+
+type sarifLocation struct {
+	Id               *int                  `json:"id,omitempty"`
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           *sarifRegion          `json:"region,omitempty"`
+}
+
+type sarifArtifactLocation struct {
+	Uri string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn,omitempty"`
+}
+
+func (al AlertLevel) sarifLevel() string {
+	switch al {
+	case Error:
+		return "error"
+	case Warning:
+		return "warning"
+	}
+	return "note"
+}
+
+// ファイルパスをSARIFのURIにする。相対パスは相対参照、絶対パスはfile URIにする。
+// 空白や#、日本語などはパーセントエンコードする
+func pathToUri(path string) string {
+	uri := url.URL{Path: filepath.ToSlash(path)}
+	if filepath.IsAbs(path) {
+		uri.Scheme = "file"
+		if !strings.HasPrefix(uri.Path, "/") {
+			uri.Path = "/" + uri.Path // Windowsのドライブレター
+		}
+	}
+	return uri.String()
+}
+
+func (log Log) sarifResult(ruleIndex map[string]int, lang string) sarifResult {
+	otherLang := "ja"
+	if lang == "ja" {
+		otherLang = "en"
+	}
+	result := sarifResult{
+		RuleId:     log.Rule,
+		Level:      log.Level.sarifLevel(),
+		Message:    sarifMessage{Text: log.FullMessage(lang)},
+		Properties: map[string]string{"message_" + otherLang: log.FullMessage(otherLang)},
+	}
+	if index, ok := ruleIndex[log.Rule]; ok {
+		result.RuleIndex = &index
+	}
+	if log.Branch != "" {
+		result.Properties["branch"] = log.Branch
+	}
+	if log.Path != "" {
+		location := sarifLocation{PhysicalLocation: sarifPhysicalLocation{ArtifactLocation: sarifArtifactLocation{Uri: pathToUri(log.Path)}}}
+		if log.Line > 0 {
+			location.PhysicalLocation.Region = &sarifRegion{StartLine: log.Line, StartColumn: log.Column}
+		}
+		result.Locations = append(result.Locations, location)
+	}
+	for i, path := range log.RelatedPaths {
+		id := i
+		result.RelatedLocations = append(result.RelatedLocations, sarifLocation{
+			Id:               &id,
+			PhysicalLocation: sarifPhysicalLocation{ArtifactLocation: sarifArtifactLocation{Uri: pathToUri(path)}}})
+	}
+	return result
+}
+
+// reportをSARIF 2.1.0形式で書き出す。langはメッセージの主言語(en/ja)
+func WriteSARIF(w io.Writer, report *Report, lang string) error {
+	driver := sarifDriver{
+		Name:           "checkbms",
+		InformationUri: "https://github.com/Shimi9999/checkbms",
+		Rules:          []sarifReportingDescriptor{},
+	}
+	ruleIndex := map[string]int{}
+	for i, rule := range RULES {
+		descriptor := sarifReportingDescriptor{
+			Id:               rule.ID,
+			ShortDescription: sarifMessage{Text: rule.Description},
+			Properties:       map[string]string{"description_ja": rule.Description_ja},
+		}
+		if lang == "ja" {
+			descriptor.ShortDescription.Text = rule.Description_ja
+			descriptor.Properties = map[string]string{"description_en": rule.Description}
+		}
+		driver.Rules = append(driver.Rules, descriptor)
+		ruleIndex[rule.ID] = i
+	}
+
+	// 列番号はバイト単位だが、列番号を持つのはASCIIのみの"#xxxyy:"の後ろにあるオブジェだけなので、コードポイント単位と一致する
+	run := sarifRun{Tool: sarifTool{Driver: driver}, Language: "en-US", ColumnKind: "unicodeCodePoints", Results: []sarifResult{}}
+	if lang == "ja" {
+		run.Language = "ja-JP"
+	}
+	for _, log := range report.allLogs() {
+		run.Results = append(run.Results, log.sarifResult(ruleIndex, lang))
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.SetEscapeHTML(false)
+	return encoder.Encode(sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs:    []sarifRun{run},
+	})
+}
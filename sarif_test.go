@@ -0,0 +1,97 @@
+package checkbms
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteSARIF(t *testing.T) {
+	report := Report{BmsFiles: []BmsFileResult{{Path: "song/test.bms", Diagnostics: Logs{
+		{Rule: "bms.note-overlap", Level: Error, Message: "Placed notes overlap", Message_ja: "配置されているノーツが重なり合っています",
+			Path: "song/test.bms", Line: 4, Column: 8},
+		{Rule: "dir.file-not-found", Level: Notice, Message: "Defined file does not exist", Message_ja: "定義されているファイルが実在しません",
+			Path: "song/test.bms", RelatedPaths: []string{"song/a.wav"}},
+	}}}}
+	var buf bytes.Buffer
+	if err := WriteSARIF(&buf, &report, "en"); err != nil {
+		t.Fatal(err)
+	}
+
+	var got sarifLog
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Version != "2.1.0" || len(got.Runs) != 1 {
+		t.Fatalf("invalid sarif: %s", buf.String())
+	}
+	run := got.Runs[0]
+	if run.ColumnKind != "unicodeCodePoints" {
+		t.Errorf("columnKind: got = %s", run.ColumnKind)
+	}
+	if len(run.Tool.Driver.Rules) != len(RULES) {
+		t.Errorf("rules count: got = %d, want = %d", len(run.Tool.Driver.Rules), len(RULES))
+	}
+	if len(run.Results) != 2 {
+		t.Fatalf("results count: got = %d, want = 2", len(run.Results))
+	}
+
+	overlap := run.Results[0]
+	if overlap.Level != "error" || overlap.RuleIndex == nil || run.Tool.Driver.Rules[*overlap.RuleIndex].Id != "bms.note-overlap" {
+		t.Errorf("overlap result: got = %+v", overlap)
+	}
+	if region := overlap.Locations[0].PhysicalLocation.Region; region == nil || region.StartLine != 4 || region.StartColumn != 8 {
+		t.Errorf("overlap region: got = %+v", region)
+	}
+	if overlap.Properties["message_ja"] != "配置されているノーツが重なり合っています" {
+		t.Errorf("overlap message_ja: got = %s", overlap.Properties["message_ja"])
+	}
+
+	notFound := run.Results[1]
+	if notFound.Level != "note" || notFound.Locations[0].PhysicalLocation.Region != nil {
+		t.Errorf("not found result: got = %+v", notFound)
+	}
+	if len(notFound.RelatedLocations) != 1 || notFound.RelatedLocations[0].PhysicalLocation.ArtifactLocation.Uri != "song/a.wav" {
+		t.Errorf("not found related locations: got = %+v", notFound.RelatedLocations)
+	}
+}
+
+func TestSarifResultWithUnknownRule(t *testing.T) {
+	ruleIndex := map[string]int{"bms.note-overlap": 3}
+	if result := (Log{Rule: "bms.note-overlap", Level: Error}).sarifResult(ruleIndex, "en"); result.RuleIndex == nil || *result.RuleIndex != 3 {
+		t.Errorf("known rule: ruleIndex = %v, want 3", result.RuleIndex)
+	}
+	// RULESに無いルールは先頭のルールを指さないようにruleIndexを省く
+	result := (Log{Rule: "third-party.rule", Level: Error}).sarifResult(ruleIndex, "en")
+	bytes, err := json.Marshal(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.RuleIndex != nil || strings.Contains(string(bytes), "ruleIndex") {
+		t.Errorf("unknown rule: got = %s", bytes)
+	}
+}
+
+func TestPathToUri(t *testing.T) {
+	abs, err := filepath.Abs(filepath.Join("曲 #1", "a%.bms"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		path string
+		want string
+	}{
+		{filepath.Join("song", "test.bms"), "song/test.bms"},
+		{filepath.Join("曲 #1", "a%.bms"), "%E6%9B%B2%20%231/a%25.bms"},
+	}
+	for _, tt := range tests {
+		if got := pathToUri(tt.path); got != tt.want {
+			t.Errorf("pathToUri(%s) = %s, want %s", tt.path, got, tt.want)
+		}
+	}
+	if got := pathToUri(abs); !strings.HasPrefix(got, "file:///") || !strings.HasSuffix(got, "/%E6%9B%B2%20%231/a%25.bms") {
+		t.Errorf("pathToUri(%s) = %s", abs, got)
+	}
+}
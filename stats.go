@@ -0,0 +1,219 @@
+package checkbms
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// 譜面の統計情報
+
+type ChartStats struct {
+	Path           string         `json:"path"`
+	Sha256         string         `json:"sha256"`
+	Keymode        int            `json:"keymode"`
+	TotalNotes     int            `json:"totalNotes"`
+	Length         float64        `json:"length"` // 最後のノーツ(LNの終端を含む)までの秒数
+	MinBpm         float64        `json:"minBpm"`
+	MaxBpm         float64        `json:"maxBpm"`
+	MainBpm        float64        `json:"mainBpm"` // Lengthまでで最も長く続くBPM
+	Notes          NoteCounts     `json:"notes"`
+	NotesPerLane   map[string]int `json:"notesPerLane"` // BMS: ノーツのチャンネル(LNは1x/2xにまとめる)、bmson: x
+	PeakNps        float64        `json:"peakNps"`      // 1秒間のノーツ数の最大
+	AverageNps     float64        `json:"averageNps"`
+	BpmChanges     int            `json:"bpmChanges"`
+	Stops          int            `json:"stops"`
+	WavDefinitions int            `json:"wavDefinitions"` // bmson: sound_channelsの数
+	BmpDefinitions int            `json:"bmpDefinitions"` // bmson: bga_headerの数
+}
+
+// LNは始点と終点で1つと数える。スクラッチのノーツはNormal, LNに含めない
+type NoteCounts struct {
+	Normal    int `json:"normal"`
+	LN        int `json:"ln"`
+	Scratch   int `json:"scratch"`
+	Mine      int `json:"mine"`
+	Invisible int `json:"invisible"`
+}
+
+type statsNote struct {
+	lane      string
+	time      float64 // ミリ秒
+	endTime   float64 // LNの終端の時間。LNでなければ0
+	isScratch bool
+}
+
+func hasScratch(keymode int) bool {
+	return keymode == 5 || keymode == 7 || keymode == 10 || keymode == 14
+}
+
+// BMSの統計情報を求める。#RANDOMがある場合は全ての値が最初の分岐の組み合わせのもの
+func CalculateStats(bmsFile *BmsFile) ChartStats {
+	if len(bmsFile.Branches) > 0 {
+		bmsFile = &bmsFile.Branches[0]
+	}
+	stats := ChartStats{Path: bmsFile.Path, Sha256: bmsFile.Sha256, Keymode: bmsFile.Keymode, TotalNotes: bmsFile.TotalNotes,
+		WavDefinitions: len(bmsFile.HeaderWav), BmpDefinitions: len(bmsFile.HeaderBmp)}
+	timeline := NewTimeline(bmsFile)
+
+	notes := []statsNote{}
+	lastNotes := map[string]int{} // レーンごとの最後のノーツのnotesの添字
+	for _, obj := range timeline.Objects {
+		channel := strings.ToLower(obj.Channel)
+		switch obj.Kind {
+		case MineObject:
+			stats.Notes.Mine++
+		case BpmObject:
+			stats.BpmChanges++
+		case StopObject:
+			stats.Stops++
+		case SoundObject:
+			if matchChannel(channel, INVISIBLENOTE_CHANNELS) {
+				stats.Notes.Invisible++
+				continue
+			}
+			isLN := matchChannel(channel, LN_CHANNELS)
+			if !isLN && !matchChannel(channel, NORMALNOTE_CHANNELS) {
+				continue
+			}
+			lane := channel
+			if isLN {
+				// 5x -> 1x, 6x -> 2x
+				lane = strconv.Itoa(int(channel[0]-'0')-4) + channel[1:]
+			}
+			if obj.IsLNEnd {
+				if i, ok := lastNotes[lane]; ok && notes[i].endTime == 0 {
+					notes[i].endTime = obj.Time
+				}
+				continue
+			}
+			lastNotes[lane] = len(notes)
+			notes = append(notes, statsNote{lane: strings.ToUpper(lane), time: obj.Time,
+				isScratch: lane[1] == '6' && hasScratch(bmsFile.Keymode)})
+		}
+	}
+
+	stats.setNotes(notes, timeline)
+	return stats
+}
+
+// bmsonの統計情報を求める。xが1以上のノーツを演奏するノーツとする
+func CalculateStatsBmson(bmsonFile *BmsonFile) ChartStats {
+	stats := ChartStats{Path: bmsonFile.Path, Sha256: bmsonFile.Sha256, Keymode: bmsonFile.Keymode, TotalNotes: bmsonFile.TotalNotes,
+		WavDefinitions: len(bmsonFile.Sound_channels)}
+	if bmsonFile.Bga != nil {
+		stats.BmpDefinitions = len(bmsonFile.Bga.Bga_header)
+	}
+	timeline := NewTimelineBmson(bmsonFile)
+
+	notes := []statsNote{}
+	for _, obj := range timeline.Objects {
+		switch obj.Kind {
+		case BpmObject:
+			stats.BpmChanges++
+		case StopObject:
+			stats.Stops++
+		case SoundObject:
+			if obj.Lane <= 0 {
+				continue
+			}
+			notes = append(notes, statsNote{lane: strconv.Itoa(obj.Lane), time: obj.Time, endTime: obj.EndTime,
+				isScratch: hasScratch(bmsonFile.Keymode) && (obj.Lane == 8 || obj.Lane == 16)})
+		}
+	}
+
+	stats.setNotes(notes, timeline)
+	return stats
+}
+
+func (stats *ChartStats) setNotes(notes []statsNote, timeline *Timeline) {
+	stats.NotesPerLane = map[string]int{}
+	times := []float64{}
+	endTime := 0.0
+	for _, note := range notes {
+		stats.NotesPerLane[note.lane]++
+		switch {
+		case note.isScratch:
+			stats.Notes.Scratch++
+		case note.endTime > 0:
+			stats.Notes.LN++
+		default:
+			stats.Notes.Normal++
+		}
+		times = append(times, note.time)
+		endTime = math.Max(endTime, math.Max(note.time, note.endTime))
+	}
+	stats.Length = endTime / 1000
+
+	// ノーツ数の多い1秒間
+	sort.Float64s(times)
+	for i, j := 0, 0; j < len(times); j++ {
+		for times[j]-times[i] >= 1000 {
+			i++
+		}
+		stats.PeakNps = math.Max(stats.PeakNps, float64(j-i+1))
+	}
+	if stats.Length > 0 {
+		stats.AverageNps = float64(len(notes)) / stats.Length
+	}
+
+	stats.setBpms(timeline, endTime)
+}
+
+// endTimeまでのBPMの最小、最大、最も長く続くBPMを求める
+func (stats *ChartStats) setBpms(timeline *Timeline, endTime float64) {
+	stats.MinBpm, stats.MaxBpm, stats.MainBpm = timeline.InitialBpm, timeline.InitialBpm, timeline.InitialBpm
+	durations := map[float64]float64{}
+	for i, point := range timeline.Points {
+		if i > 0 && point.Time > endTime {
+			break
+		}
+		stats.MinBpm = math.Min(stats.MinBpm, point.Bpm)
+		stats.MaxBpm = math.Max(stats.MaxBpm, point.Bpm)
+		end := endTime
+		if i+1 < len(timeline.Points) {
+			end = math.Min(end, timeline.Points[i+1].Time)
+		}
+		// 停止している時間はBPMの長さに含めない
+		if duration := end - (point.Time + point.Stop); duration > 0 {
+			durations[point.Bpm] += duration
+		}
+	}
+	longest := 0.0
+	for bpm, duration := range durations {
+		if duration > longest || duration == longest && bpm > stats.MainBpm {
+			stats.MainBpm, longest = bpm, duration
+		}
+	}
+}
+
+func (stats ChartStats) String() string {
+	lanes := []string{}
+	for lane := range stats.NotesPerLane {
+		lanes = append(lanes, lane)
+	}
+	sort.Slice(lanes, func(i, j int) bool {
+		if len(lanes[i]) != len(lanes[j]) {
+			return len(lanes[i]) < len(lanes[j])
+		}
+		return lanes[i] < lanes[j]
+	})
+	perLane := []string{}
+	for _, lane := range lanes {
+		perLane = append(perLane, fmt.Sprintf("%s:%d", lane, stats.NotesPerLane[lane]))
+	}
+
+	str := fmt.Sprintf("# %s\n", stats.Path)
+	str += fmt.Sprintf("Keymode: %d\n", stats.Keymode)
+	str += fmt.Sprintf("Length: %.1fsec\n", stats.Length)
+	str += fmt.Sprintf("BPM: %s-%s (main %s)\n", formatFloat(stats.MinBpm), formatFloat(stats.MaxBpm), formatFloat(stats.MainBpm))
+	str += fmt.Sprintf("TotalNotes: %d (normal %d, LN %d, scratch %d, mine %d, invisible %d)\n",
+		stats.TotalNotes, stats.Notes.Normal, stats.Notes.LN, stats.Notes.Scratch, stats.Notes.Mine, stats.Notes.Invisible)
+	str += fmt.Sprintf("NotesPerLane: %s\n", strings.Join(perLane, " "))
+	str += fmt.Sprintf("NPS: peak %s, average %.2f\n", formatFloat(stats.PeakNps), stats.AverageNps)
+	str += fmt.Sprintf("BpmChanges: %d, Stops: %d\n", stats.BpmChanges, stats.Stops)
+	str += fmt.Sprintf("Definitions: WAV %d, BMP %d\n", stats.WavDefinitions, stats.BmpDefinitions)
+	return str
+}
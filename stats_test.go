@@ -0,0 +1,103 @@
+package checkbms
+
+import (
+	"testing"
+
+	"github.com/Shimi9999/checkbms/bmson"
+)
+
+func TestCalculateStats(t *testing.T) {
+	bmsFile := newTestBmsFile("test.bms",
+		"#BPM 120",
+		"#BPM01 240",
+		"#LNOBJ ZZ",
+		"#WAV01 a.wav",
+		"#WAV02 b.wav",
+		"#BMP01 a.bmp",
+		"#00011:01010101",
+		"#00016:01",
+		"#00131:01",
+		"#000D1:01",
+		"#00108:01",
+		"#00112:0101",
+		"#00262:0101",
+		"#00213:01ZZ",
+	)
+	if err := bmsFile.ScanBmsFile(); err != nil {
+		t.Fatal(err)
+	}
+	stats := CalculateStats(bmsFile)
+
+	want := NoteCounts{Normal: 6, LN: 2, Scratch: 1, Mine: 1, Invisible: 1}
+	if stats.Notes != want {
+		t.Errorf("Notes = %+v, want %+v", stats.Notes, want)
+	}
+	wantLanes := map[string]int{"11": 4, "12": 2, "13": 1, "16": 1, "22": 1}
+	for lane, count := range wantLanes {
+		if stats.NotesPerLane[lane] != count {
+			t.Errorf("NotesPerLane[%s] = %d, want %d", lane, stats.NotesPerLane[lane], count)
+		}
+	}
+	if len(stats.NotesPerLane) != len(wantLanes) {
+		t.Errorf("NotesPerLane = %v, want %v", stats.NotesPerLane, wantLanes)
+	}
+	// 0小節は120BPMで2000ms、1小節からは240BPMで1小節1000ms。最後のノーツは2小節の1/2(LNの終端)
+	if stats.Length != 3.5 {
+		t.Errorf("Length = %g, want 3.5", stats.Length)
+	}
+	if stats.MinBpm != 120 || stats.MaxBpm != 240 || stats.MainBpm != 120 {
+		t.Errorf("BPM = %g-%g (main %g), want 120-240 (main 120)", stats.MinBpm, stats.MaxBpm, stats.MainBpm)
+	}
+	// 0ms(11, 16)と500ms(11)、2500ms(12)と3000ms(62, 13)
+	if stats.PeakNps != 3 {
+		t.Errorf("PeakNps = %g, want 3", stats.PeakNps)
+	}
+	if stats.BpmChanges != 1 || stats.Stops != 0 {
+		t.Errorf("BpmChanges, Stops = %d, %d, want 1, 0", stats.BpmChanges, stats.Stops)
+	}
+	if stats.WavDefinitions != 2 || stats.BmpDefinitions != 1 {
+		t.Errorf("Definitions = %d, %d, want 2, 1", stats.WavDefinitions, stats.BmpDefinitions)
+	}
+}
+
+func TestCalculateStatsWithBranches(t *testing.T) {
+	bmsFile := newTestBmsFile("test.bms",
+		"#WAV01 a.wav",
+		"#RANDOM 2",
+		"#IF 1", "#WAV02 b.wav", "#00111:01010101", "#ENDIF",
+		"#IF 2", "#WAV03 c.wav", "#00112:01010101", "#ENDIF",
+		"#ENDRANDOM",
+	)
+	if err := bmsFile.ScanBmsFile(); err != nil {
+		t.Fatal(err)
+	}
+	stats := CalculateStats(bmsFile)
+	if stats.TotalNotes != 4 || stats.Notes.Normal != 4 || stats.NotesPerLane["11"] != 4 || len(stats.NotesPerLane) != 1 {
+		t.Errorf("TotalNotes = %d, Notes = %+v, NotesPerLane = %v, want 4 notes in lane 11", stats.TotalNotes, stats.Notes, stats.NotesPerLane)
+	}
+	if stats.WavDefinitions != 2 {
+		t.Errorf("WavDefinitions = %d, want 2", stats.WavDefinitions)
+	}
+}
+
+func TestCalculateStatsBmson(t *testing.T) {
+	bmsonFile := &BmsonFile{BmsFileBase: BmsFileBase{Keymode: 7}}
+	bmsonFile.Info = &bmson.BmsonInfo{Init_bpm: 60, Resolution: 240}
+	bmsonFile.Sound_channels = []bmson.SoundChannel{
+		{Name: "a.wav", Notes: []bmson.Note{{X: float64(1), Y: 0}, {X: float64(8), Y: 240}, {X: float64(2), Y: 480, L: 480}, {X: nil, Y: 0}}},
+	}
+	bmsonFile.Bpm_events = []bmson.BpmEvent{{Y: 480, Bpm: 120}}
+	stats := CalculateStatsBmson(bmsonFile)
+
+	want := NoteCounts{Normal: 1, LN: 1, Scratch: 1}
+	if stats.Notes != want {
+		t.Errorf("Notes = %+v, want %+v", stats.Notes, want)
+	}
+	// 60BPMで2拍(2000ms)、120BPMで2拍(1000ms)
+	if stats.Length != 3 {
+		t.Errorf("Length = %g, want 3", stats.Length)
+	}
+	if stats.MainBpm != 60 || stats.MaxBpm != 120 {
+		t.Errorf("BPM = %g-%g (main %g), want 60-120 (main 60)", stats.MinBpm, stats.MaxBpm, stats.MainBpm)
+	}
+}
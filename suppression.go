@@ -0,0 +1,150 @@
+package checkbms
+
+import (
+	"fmt"
+	"strings"
+)
+
+// BMSファイル内のコメントでログを抑制する
+//   %checkbms-disable bms.wav-duplicate            ファイル全体で抑制
+//   %checkbms-disable-next-line bms.note-overlap   次の行(コメント行を除く)で抑制
+// ルールIDの代わりにチェック関数名も書ける。空白区切りで複数指定できる
+
+const (
+	SUPPRESSION_DIRECTIVE           = "%checkbms-disable"
+	SUPPRESSION_NEXT_LINE_DIRECTIVE = "%checkbms-disable-next-line"
+)
+
+type suppression struct {
+	line     int    // 抑制コメントの行番号
+	rule     string // ルールIDかチェック関数名
+	nextLine int    // 抑制する行番号。0ならファイル全体
+	used     bool
+}
+
+func (s suppression) matches(log Log) bool {
+	if log.Rule != s.rule {
+		rule, ok := RuleByID(log.Rule)
+		if !ok || rule.Check != s.rule {
+			return false
+		}
+	}
+	return s.nextLine == 0 || s.nextLine == log.Line
+}
+
+func isSuppressionRule(id string) bool {
+	return id == "bms.suppression-unused" || id == "bms.suppression-invalid"
+}
+
+type invalidSuppression struct {
+	lineNumber int
+	line       string
+}
+
+func (is invalidSuppression) Log() Log {
+	return Log{
+		Rule:       "bms.suppression-invalid",
+		Level:      Warning,
+		Message:    fmt.Sprintf("Suppression comment has no valid rule ID: %s", is.line),
+		Message_ja: fmt.Sprintf("抑制コメントに有効なルールIDがありません: %s", is.line),
+		Line:       is.lineNumber,
+	}
+}
+
+type unusedSuppression struct {
+	suppression
+}
+
+func (us unusedSuppression) Log() Log {
+	return Log{
+		Rule:       "bms.suppression-unused",
+		Level:      Notice,
+		Message:    fmt.Sprintf("Suppression of %s is not used", us.rule),
+		Message_ja: fmt.Sprintf("%sの抑制が使われていません", us.rule),
+		Line:       us.line,
+	}
+}
+
+// 抑制コメントを読み込む
+func parseSuppressions(lines []bmsLine) (sps []suppression, iss []invalidSuppression) {
+	for i, line := range lines {
+		fields := strings.Fields(line.text)
+		if len(fields) == 0 {
+			continue
+		}
+		nextLine := 0
+		switch strings.ToLower(fields[0]) {
+		case SUPPRESSION_DIRECTIVE:
+		case SUPPRESSION_NEXT_LINE_DIRECTIVE:
+			nextLine = -1 // 次の行が無い場合
+			for _, next := range lines[i+1:] {
+				if !strings.HasPrefix(next.text, "*") && !strings.HasPrefix(next.text, "%") {
+					nextLine = next.number
+					break
+				}
+			}
+		default:
+			continue
+		}
+
+		rules := []string{}
+		for _, rule := range fields[1:] {
+			if _, ok := RuleByID(rule); (ok || isCheckName(rule)) && !isSuppressionRule(rule) {
+				rules = append(rules, rule)
+			}
+		}
+		if len(rules) == 0 || len(rules) != len(fields)-1 {
+			iss = append(iss, invalidSuppression{lineNumber: line.number, line: line.text})
+		}
+		for _, rule := range rules {
+			sps = append(sps, suppression{line: line.number, rule: rule, nextLine: nextLine})
+		}
+	}
+	return sps, iss
+}
+
+// 抑制されたログを取り除く。pathが空でなければ、Pathがpathのログだけを対象にする
+func (bmsFile *BmsFile) suppress(logs Logs, path string) (remained Logs) {
+	if logs == nil {
+		return nil
+	}
+	if configOrDefault(bmsFile.Config).IgnoreSuppressions {
+		return logs
+	}
+	remained = Logs{}
+	for _, log := range logs {
+		isSuppressed := false
+		if !isSuppressionRule(log.Rule) && (path == "" || log.Path == path) {
+			for i := range bmsFile.suppressions {
+				if bmsFile.suppressions[i].matches(log) {
+					bmsFile.suppressions[i].used = true
+					isSuppressed = true
+				}
+			}
+		}
+		if !isSuppressed {
+			remained = append(remained, log)
+		}
+	}
+	return remained
+}
+
+// bmsFile.Logsから抑制されたログを取り除き、使われていない抑制コメントのログを付け直す
+func (bmsFile *BmsFile) applySuppressions() {
+	if len(bmsFile.suppressions) == 0 || configOrDefault(bmsFile.Config).IgnoreSuppressions {
+		return
+	}
+	logs := Logs{}
+	for _, log := range bmsFile.suppress(bmsFile.Logs, "") {
+		if log.Rule != "bms.suppression-unused" {
+			logs = append(logs, log)
+		}
+	}
+	for _, s := range bmsFile.suppressions {
+		if !s.used {
+			logs.add(unusedSuppression{suppression: s}.Log())
+		}
+	}
+	bmsFile.Logs = logs
+	bmsFile.Logs.setPath(bmsFile.Path)
+}
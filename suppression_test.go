@@ -0,0 +1,82 @@
+package checkbms
+
+import (
+	"testing"
+)
+
+func TestSuppressions(t *testing.T) {
+	bmsFile := newTestBmsFile("test.bms",
+		"#RANK 0",
+		"%checkbms-disable bms.rank-unusual CheckSoundOfMineExplosionIsUsed",
+		"#WAV01 a.wav",
+		"#WAV02 b.wav",
+		"#00111:01",
+		"%checkbms-disable-next-line bms.note-overlap",
+		"* comment",
+		"#00111:02",
+		"#00112:01",
+		"#00112:02",
+		"%checkbms-disable-next-line bms.wav-duplicate",
+		"#00213:01",
+		"%checkbms-disable bms.unknown",
+	)
+	if err := bmsFile.ScanBmsFile(); err != nil {
+		t.Fatal(err)
+	}
+	CheckBmsFile(bmsFile)
+
+	type ruleLine struct {
+		rule string
+		line int
+	}
+	got := map[ruleLine]bool{}
+	for _, log := range bmsFile.Logs {
+		got[ruleLine{log.Rule, log.Line}] = true
+	}
+	for _, want := range []ruleLine{
+		{"bms.note-overlap", 10},
+		{"bms.suppression-unused", 2},  // CheckSoundOfMineExplosionIsUsed
+		{"bms.suppression-unused", 11}, // bms.wav-duplicate
+		{"bms.suppression-invalid", 13},
+	} {
+		if !got[want] {
+			t.Errorf("log is missing: %+v", want)
+		}
+	}
+	for _, notWant := range []ruleLine{
+		{"bms.rank-unusual", 1},
+		{"bms.note-overlap", 8},
+		{"bms.suppression-unused", 6},
+	} {
+		if got[notWant] {
+			t.Errorf("log is not suppressed: %+v", notWant)
+		}
+	}
+}
+
+func TestIgnoreSuppressions(t *testing.T) {
+	bmsFile := newTestBmsFile("test.bms",
+		"#RANK 0",
+		"%checkbms-disable bms.rank-unusual",
+	)
+	if err := bmsFile.ScanBmsFile(); err != nil {
+		t.Fatal(err)
+	}
+	config := DefaultConfig()
+	config.IgnoreSuppressions = true
+	bmsFile.Config = config
+	CheckBmsFile(bmsFile)
+
+	found := false
+	for _, log := range bmsFile.Logs {
+		if log.Rule == "bms.rank-unusual" {
+			found = true
+		}
+		if log.Rule == "bms.suppression-unused" {
+			t.Errorf("suppression-unused is reported while suppressions are ignored: %+v", log)
+		}
+	}
+	if !found {
+		t.Errorf("bms.rank-unusual is suppressed while suppressions are ignored")
+	}
+}
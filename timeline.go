@@ -0,0 +1,288 @@
+package checkbms
+
+import (
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Shimi9999/checkbms/bmson"
+)
+
+// BPM変化、停止、小節長を考慮して、譜面の全てのオブジェの拍と時間(ミリ秒)を求める
+
+type ObjectKind string
+
+const (
+	SoundObject  = ObjectKind("sound")  // BMS: WAVチャンネル(BGM、不可視ノーツ、LNを含む)、bmson: sound_channelsのノーツ
+	MineObject   = ObjectKind("mine")   // BMS: 地雷チャンネル
+	BgaObject    = ObjectKind("bga")    // BMS: BMPチャンネル、bmson: bga_events, layer_events, poor_events
+	BpmObject    = ObjectKind("bpm")    // BMS: 03, 08チャンネル、bmson: bpm_events
+	StopObject   = ObjectKind("stop")   // BMS: 09チャンネル、bmson: stop_events
+	ScrollObject = ObjectKind("scroll") // BMS: SCチャンネル、bmson: scroll_events
+)
+
+type TimedObject struct {
+	Kind        ObjectKind
+	Channel     string // BMS: チャンネル(大文字)
+	Lane        int    // bmson: ノーツのx
+	Measure     int
+	Numerator   int    // BMS: 小節内の位置
+	Denominator int    // BMS: 小節内の位置
+	Y           int    // bmson: パルス
+	Value       string // BMS: オブジェの値(大文字の36進数)、bmson: サウンドチャンネル名など
+	IsLNEnd     bool   // BMS: LNの終端
+	Line        int    // BMS: 配置されている行番号
+	Beat        float64
+	Time        float64 // ミリ秒。同じ拍の停止の前の時間
+	EndBeat     float64 // bmson: LNの終端の拍。LNでなければ0
+	EndTime     float64 // bmson: LNの終端の時間
+}
+
+// BPMが変化する、または停止する拍
+type TimelinePoint struct {
+	Beat float64
+	Time float64 // ミリ秒。停止の前の時間
+	Bpm  float64 // この拍以降のBPM
+	Stop float64 // この拍で停止する時間(ミリ秒)
+}
+
+type Timeline struct {
+	InitialBpm float64
+	Points     []TimelinePoint // 拍順。先頭は0拍
+	Objects    []TimedObject   // 拍順
+}
+
+const DEFAULT_BPM = 130.0
+const DEFAULT_BMSON_RESOLUTION = 240
+
+// 拍の時間(ミリ秒)を返す。拍と同じ位置の停止は含まない
+func (t *Timeline) TimeAt(beat float64) float64 {
+	i := sort.Search(len(t.Points), func(i int) bool { return t.Points[i].Beat > beat }) - 1
+	if i < 0 {
+		return beat * 60000.0 / t.InitialBpm
+	}
+	p := t.Points[i]
+	if p.Beat == beat {
+		return p.Time
+	}
+	return p.Time + p.Stop + (beat-p.Beat)*60000.0/p.Bpm
+}
+
+// 拍のBPMを返す
+func (t *Timeline) BpmAt(beat float64) float64 {
+	i := sort.Search(len(t.Points), func(i int) bool { return t.Points[i].Beat > beat }) - 1
+	if i < 0 {
+		return t.InitialBpm
+	}
+	return t.Points[i].Bpm
+}
+
+// 最後のオブジェ(LNの終端を含む)の時間
+func (t *Timeline) EndTime() (endTime float64) {
+	for _, obj := range t.Objects {
+		if obj.Time > endTime {
+			endTime = obj.Time
+		}
+		if obj.EndTime > endTime {
+			endTime = obj.EndTime
+		}
+	}
+	return endTime
+}
+
+type timelineEvent struct {
+	beat      float64
+	bpm       float64 // 0ならBPM変化なし
+	stopBeats float64 // 停止する拍数
+}
+
+// BPM変化と停止からPointsを作る。BPMが0以下の変化は無視する
+func (t *Timeline) setPoints(events []timelineEvent) {
+	sort.SliceStable(events, func(i, j int) bool { return events[i].beat < events[j].beat })
+	t.Points = []TimelinePoint{{Beat: 0, Time: 0, Bpm: t.InitialBpm}}
+	for _, event := range events {
+		if event.beat < 0 {
+			continue
+		}
+		last := &t.Points[len(t.Points)-1]
+		if event.beat != last.Beat {
+			t.Points = append(t.Points, TimelinePoint{
+				Beat: event.beat,
+				Time: last.Time + last.Stop + (event.beat-last.Beat)*60000.0/last.Bpm,
+				Bpm:  last.Bpm,
+			})
+			last = &t.Points[len(t.Points)-1]
+		}
+		if event.bpm > 0 {
+			last.Bpm = event.bpm
+		}
+		// 停止時間は同じ拍のBPM変化の後のBPMで求める
+		last.Stop += event.stopBeats * 60000.0 / last.Bpm
+	}
+}
+
+func (t *Timeline) setObjectTimes() {
+	sort.SliceStable(t.Objects, func(i, j int) bool { return t.Objects[i].Beat < t.Objects[j].Beat })
+	for i := range t.Objects {
+		t.Objects[i].Time = t.TimeAt(t.Objects[i].Beat)
+		if t.Objects[i].EndBeat > 0 {
+			t.Objects[i].EndTime = t.TimeAt(t.Objects[i].EndBeat)
+		}
+	}
+}
+
+// 小節の長さ(拍数)。#xxx02が複数あれば最後の定義を使う
+func (bmsFile *BmsFile) measureBeats() map[int]*big.Rat {
+	beats := map[int]*big.Rat{}
+	for _, ml := range bmsFile.BmsMeasureLengths {
+		if length := ml.rat(); length.Sign() > 0 {
+			beats[ml.Measure] = length.Mul(length, big.NewRat(4, 1))
+		}
+	}
+	return beats
+}
+
+func (bmsFile *BmsFile) initialBpm() float64 {
+	if bpm, err := strconv.ParseFloat(bmsFile.Header["bpm"], 64); err == nil && bpm > 0 {
+		return bpm
+	}
+	return DEFAULT_BPM
+}
+
+// BMSの全てのオブジェの拍と時間を求める。#RANDOMがある場合はBranchesの要素を渡す
+func NewTimeline(bmsFile *BmsFile) *Timeline {
+	t := &Timeline{InitialBpm: bmsFile.initialBpm()}
+
+	// 小節長の誤差が積み重ならないように、拍は有理数で求める
+	lengths := bmsFile.measureBeats()
+	measureStarts := []*big.Rat{new(big.Rat)}
+	measureStart := func(measure int) *big.Rat {
+		for len(measureStarts) <= measure {
+			m := len(measureStarts) - 1
+			beats, ok := lengths[m]
+			if !ok {
+				beats = big.NewRat(4, 1)
+			}
+			measureStarts = append(measureStarts, new(big.Rat).Add(measureStarts[m], beats))
+		}
+		return measureStarts[measure]
+	}
+	beatOf := func(obj bmsObj) float64 {
+		beats := new(big.Rat).Sub(measureStart(obj.Measure+1), measureStart(obj.Measure))
+		beat, _ := beats.Mul(beats, obj.Position.rat()).Add(beats, measureStart(obj.Measure)).Float64()
+		return beat
+	}
+
+	events := []timelineEvent{}
+	kinds := []struct {
+		objType objType
+		kind    ObjectKind
+	}{{Wav, SoundObject}, {Mine, MineObject}, {Bmp, BgaObject}, {Bpm, BpmObject}, {ExtendedBpm, BpmObject}, {Stop, StopObject}, {Scroll, ScrollObject}}
+	for _, k := range kinds {
+		for _, obj := range bmsFile.bmsObjs(k.objType) {
+			beat := beatOf(obj)
+			switch k.objType {
+			case Bpm:
+				if bpm, err := strconv.ParseInt(obj.value36(), 16, 64); err == nil {
+					events = append(events, timelineEvent{beat: beat, bpm: float64(bpm)})
+				}
+			case ExtendedBpm:
+				if bpm, err := strconv.ParseFloat(bmsFile.definedValue(ExtendedBpm, obj.value36()), 64); err == nil {
+					events = append(events, timelineEvent{beat: beat, bpm: bpm})
+				}
+			case Stop:
+				// #STOPxxは4/4拍子の1小節を192とした長さ
+				if stop, err := strconv.ParseFloat(bmsFile.definedValue(Stop, obj.value36()), 64); err == nil && stop > 0 {
+					events = append(events, timelineEvent{beat: beat, stopBeats: stop / 48})
+				}
+			}
+			t.Objects = append(t.Objects, TimedObject{
+				Kind:        k.kind,
+				Channel:     strings.ToUpper(obj.Channel),
+				Measure:     obj.Measure,
+				Numerator:   obj.Position.Numerator,
+				Denominator: obj.Position.Denominator,
+				Value:       strings.ToUpper(obj.value36()),
+				IsLNEnd:     obj.IsLNEnd,
+				Line:        obj.Line,
+				Beat:        beat,
+			})
+		}
+	}
+
+	t.setPoints(events)
+	t.setObjectTimes()
+	return t
+}
+
+// bmsonの全てのオブジェの拍と時間を求める
+func NewTimelineBmson(bmsonFile *BmsonFile) *Timeline {
+	t := &Timeline{InitialBpm: DEFAULT_BPM}
+	resolution := float64(DEFAULT_BMSON_RESOLUTION)
+	if bmsonFile.Info != nil {
+		if bmsonFile.Info.Init_bpm > 0 {
+			t.InitialBpm = bmsonFile.Info.Init_bpm
+		}
+		if bmsonFile.Info.Resolution > 0 {
+			resolution = float64(bmsonFile.Info.Resolution)
+		}
+	}
+
+	lines := []int{}
+	for _, line := range bmsonFile.Lines {
+		lines = append(lines, line.Y)
+	}
+	sort.Ints(lines)
+	measureOf := func(y int) int {
+		if len(lines) == 0 {
+			return int(float64(y) / (resolution * 4))
+		}
+		measure := sort.Search(len(lines), func(i int) bool { return lines[i] > y }) - 1
+		if measure < 0 {
+			return 0
+		}
+		return measure
+	}
+	newObj := func(kind ObjectKind, y int, value string) TimedObject {
+		return TimedObject{Kind: kind, Measure: measureOf(y), Y: y, Value: value, Beat: float64(y) / resolution}
+	}
+
+	events := []timelineEvent{}
+	for _, event := range bmsonFile.Bpm_events {
+		events = append(events, timelineEvent{beat: float64(event.Y) / resolution, bpm: event.Bpm})
+		t.Objects = append(t.Objects, newObj(BpmObject, event.Y, formatFloat(event.Bpm)))
+	}
+	for _, event := range bmsonFile.Stop_events {
+		if event.Duration > 0 {
+			events = append(events, timelineEvent{beat: float64(event.Y) / resolution, stopBeats: float64(event.Duration) / resolution})
+		}
+		t.Objects = append(t.Objects, newObj(StopObject, event.Y, strconv.Itoa(event.Duration)))
+	}
+	for _, event := range bmsonFile.Scroll_events {
+		t.Objects = append(t.Objects, newObj(ScrollObject, event.Y, formatFloat(event.Rate)))
+	}
+	for _, soundChannel := range bmsonFile.Sound_channels {
+		for _, note := range soundChannel.Notes {
+			obj := newObj(SoundObject, note.Y, soundChannel.Name)
+			if x, ok := note.X.(float64); ok {
+				obj.Lane = int(x)
+			}
+			if note.L > 0 {
+				obj.EndBeat = float64(note.Y+note.L) / resolution
+			}
+			t.Objects = append(t.Objects, obj)
+		}
+	}
+	if bmsonFile.Bga != nil {
+		for _, bgaEvents := range [][]bmson.BGAEvent{bmsonFile.Bga.Bga_events, bmsonFile.Bga.Layer_events, bmsonFile.Bga.Poor_events} {
+			for _, event := range bgaEvents {
+				t.Objects = append(t.Objects, newObj(BgaObject, event.Y, strconv.Itoa(event.Id)))
+			}
+		}
+	}
+
+	t.setPoints(events)
+	t.setObjectTimes()
+	return t
+}
@@ -0,0 +1,101 @@
+package checkbms
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/Shimi9999/checkbms/bmson"
+)
+
+func TestNewTimeline(t *testing.T) {
+	bmsFile := newTestBmsFile("test.bms",
+		"#BPM 120",
+		"#BPM01 240",
+		"#STOP01 192",
+		"#WAV01 a.wav",
+		"#00011:01",
+		"#00102:0.5",
+		"#00108:01",
+		"#00109:0001",
+		"#00111:0001",
+		"#00211:01",
+	)
+	if err := bmsFile.ScanBmsFile(); err != nil {
+		t.Fatal(err)
+	}
+	timeline := NewTimeline(bmsFile)
+
+	// 0小節: 120BPMで4拍(2000ms)、1小節: 240BPMで2拍、1/2の位置で4拍(1000ms)停止
+	want := []struct {
+		kind ObjectKind
+		beat float64
+		time float64
+	}{
+		{SoundObject, 0, 0},
+		{BpmObject, 4, 2000},
+		{SoundObject, 5, 2250},
+		{StopObject, 5, 2250},
+		{SoundObject, 6, 3500},
+	}
+	if len(timeline.Objects) != len(want) {
+		t.Fatalf("objects count: got = %d, want = %d", len(timeline.Objects), len(want))
+	}
+	for i, w := range want {
+		obj := timeline.Objects[i]
+		if obj.Kind != w.kind || obj.Beat != w.beat || math.Abs(obj.Time-w.time) > 1e-9 {
+			t.Errorf("objects[%d]: got = %s %g %g, want = %s %g %g", i, obj.Kind, obj.Beat, obj.Time, w.kind, w.beat, w.time)
+		}
+	}
+	if bpm := timeline.BpmAt(5.5); bpm != 240 {
+		t.Errorf("BpmAt: got = %g, want = 240", bpm)
+	}
+	if endTime := timeline.EndTime(); endTime != 3500 {
+		t.Errorf("EndTime: got = %g, want = 3500", endTime)
+	}
+}
+
+func TestNewTimelineMeasureLengthsAreExact(t *testing.T) {
+	lines := []string{"#WAV01 a.wav", "#01011:01"}
+	for measure := 0; measure < 10; measure++ {
+		lines = append(lines, fmt.Sprintf("#%03d02:0.1", measure))
+	}
+	bmsFile := newTestBmsFile("test.bms", lines...)
+	if err := bmsFile.ScanBmsFile(); err != nil {
+		t.Fatal(err)
+	}
+	// 0.4拍の小節が10個続いた後は、誤差無く4拍
+	if beat := NewTimeline(bmsFile).Objects[0].Beat; beat != 4 {
+		t.Errorf("beat: got = %v, want = 4", beat)
+	}
+}
+
+func TestNewTimelineBmson(t *testing.T) {
+	bmsonFile := &BmsonFile{Bmson: bmson.Bmson{
+		Info:        &bmson.BmsonInfo{Init_bpm: 120, Resolution: 240},
+		Lines:       []bmson.BarLine{{Y: 0}, {Y: 960}, {Y: 1440}},
+		Bpm_events:  []bmson.BpmEvent{{Y: 960, Bpm: 240}},
+		Stop_events: []bmson.StopEvent{{Y: 1200, Duration: 960}},
+		Sound_channels: []bmson.SoundChannel{{Name: "a.wav", Notes: []bmson.Note{
+			{X: 1.0, Y: 0, L: 480},
+			{X: 2.0, Y: 1440},
+		}}},
+	}}
+	timeline := NewTimelineBmson(bmsonFile)
+
+	var notes []TimedObject
+	for _, obj := range timeline.Objects {
+		if obj.Kind == SoundObject {
+			notes = append(notes, obj)
+		}
+	}
+	if len(notes) != 2 {
+		t.Fatalf("notes count: got = %d, want = 2", len(notes))
+	}
+	if notes[0].EndBeat != 2 || notes[0].EndTime != 1000 || notes[0].Lane != 1 {
+		t.Errorf("ln: got = %+v", notes[0])
+	}
+	if notes[1].Beat != 6 || notes[1].Time != 3500 || notes[1].Measure != 2 {
+		t.Errorf("note: got = %+v", notes[1])
+	}
+}
@@ -0,0 +1,211 @@
+package checkbms
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"unicode/utf8"
+)
+
+// 展開後のサイズが上限を超えた
+var ErrZipTooLarge = errors.New("extracted size of zip exceeds the limit")
+
+func IsZipFile(path string) bool {
+	return hasExts(path, []string{".zip"})
+}
+
+// 日本語版Windowsで展開すると文字化けするzipのエントリの名前
+type garbledZipName struct {
+	name   string // zipの中の名前(fs.FSの形式)
+	path   string // ログなどに使うパス(zipファイルのパス/zipの中の名前)
+	isUTF8 bool   // UTF-8フラグの無いUTF-8の名前。falseならShift_JISとしてデコードできない名前
+}
+
+// zipのエントリの名前。UTF-8フラグの無い名前はShift_JISとしてデコードする。
+// ただしUTF-8として正しいマルチバイト文字を含む名前は、フラグを付けずに作られたUTF-8の名前とみなす。
+// 日本語版WindowsはUTF-8フラグの無い名前をShift_JISとして展開するので、どちらの場合もgarbledをtrueにする。
+// archive/zipは~や\を含むASCIIのみの名前もNonUTF8にするが、それらはそのまま展開されるので対象外
+func zipEntryName(f *zip.File) (name string, garbled, isUTF8 bool) {
+	name = f.Name
+	if f.NonUTF8 && containsNonASCII(name) {
+		if utf8.ValidString(name) {
+			garbled, isUTF8 = true, true
+		} else {
+			// デコードできない部分は置換文字になる
+			decoded, err := ShiftJIS.decodeLine(ShiftJIS.decoder(), name)
+			name, garbled = decoded, err != nil
+		}
+	}
+	// Windowsのツールで作られたzipは区切り文字が\のことがある
+	return strings.ReplaceAll(name, `\`, "/"), garbled, isUTF8
+}
+
+func containsNonASCII(text string) bool {
+	for i := 0; i < len(text); i++ {
+		if text[i] >= 0x80 {
+			return true
+		}
+	}
+	return false
+}
+
+// pathがzipファイルか、zipファイルの中のパスなら、zipファイルのパスとzipの中の名前(fs.FSの形式)を返す
+func splitZipPath(path string) (zipPath, name string, ok bool) {
+	names := []string{}
+	for p := filepath.Clean(path); ; p = filepath.Dir(p) {
+		if IsZipFile(p) {
+			if fInfo, err := os.Stat(p); err == nil && fInfo.Mode().IsRegular() {
+				name = "."
+				if len(names) > 0 {
+					for i, j := 0, len(names)-1; i < j; i, j = i+1, j-1 {
+						names[i], names[j] = names[j], names[i]
+					}
+					name = strings.Join(names, "/")
+				}
+				return p, name, true
+			}
+		}
+		if filepath.Dir(p) == p {
+			return "", "", false
+		}
+		names = append(names, filepath.Base(p))
+	}
+}
+
+// エントリの名前をデコードしたzip。fs.FSとして読む。
+// 読み込んだフォルダ(Directory)からも使うので、開いている利用者がいなくなったら閉じる
+type zipArchive struct {
+	*zip.ReadCloser
+	garbledNames []garbledZipName
+	refs         atomic.Int32
+}
+
+func openZipArchive(path string) (*zipArchive, error) {
+	rc, err := zip.OpenReader(path)
+	// GODEBUG=zipinsecurepath=0の場合も、../などの名前はzip.ReaderのOpenが取り除くので読み込む
+	if err != nil && !errors.Is(err, zip.ErrInsecurePath) {
+		return nil, err
+	}
+	archive := &zipArchive{ReadCloser: rc}
+	archive.refs.Store(1)
+	for _, f := range rc.File {
+		name, garbled, isUTF8 := zipEntryName(f)
+		// zip.Readerは最初にOpenされたときにNameからファイルの一覧を作るので、その前に置き換える
+		f.Name = name
+		if garbled {
+			name = strings.TrimSuffix(name, "/")
+			archive.garbledNames = append(archive.garbledNames,
+				garbledZipName{name: name, path: filepath.Join(path, filepath.FromSlash(name)), isUTF8: isUTF8})
+		}
+	}
+	return archive, nil
+}
+
+func (za *zipArchive) retain() {
+	za.refs.Add(1)
+}
+
+// 利用者を1つ減らし、いなくなったらzipファイルを閉じる
+func (za *zipArchive) Close() error {
+	if za.refs.Add(-1) == 0 {
+		return za.ReadCloser.Close()
+	}
+	return nil
+}
+
+// fsysがzipなら、その中のnameのファイル
+func zipFileOf(fsys fs.FS, name string) *zip.File {
+	var files []*zip.File
+	switch zr := fsys.(type) {
+	case *zipArchive:
+		files = zr.File
+	case *zip.Reader:
+		files = zr.File
+	}
+	for _, f := range files {
+		if f.Name == name {
+			return f
+		}
+	}
+	return nil
+}
+
+// zipの中のnameのフォルダ以下にある、文字化けする名前
+func (za *zipArchive) garbledNamesIn(name string) (gns []garbledZipName) {
+	for _, gn := range za.garbledNames {
+		if name == "." || strings.HasPrefix(gn.name, name+"/") {
+			gns = append(gns, gn)
+		}
+	}
+	return gns
+}
+
+// zipをdestに展開する。展開後の合計サイズがmaxSizeを超えたらErrZipTooLargeを返す(maxSizeが0以下なら上限無し)。
+// destの外を指すエントリはエラーにして、シンボリックリンクなど通常のファイル以外のエントリは展開しない
+func ExtractZip(r *zip.Reader, dest string, maxSize int64) error {
+	var total int64
+	for _, f := range r.File {
+		name, _, _ := zipEntryName(f)
+		if !filepath.IsLocal(filepath.FromSlash(strings.TrimSuffix(name, "/"))) {
+			return fmt.Errorf("invalid entry name in zip: %s", name)
+		}
+		path := filepath.Join(dest, filepath.FromSlash(name))
+		if f.Mode().IsDir() {
+			if err := os.MkdirAll(path, 0755); err != nil {
+				return err
+			}
+			continue
+		}
+		if !f.Mode().IsRegular() {
+			continue
+		}
+
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		// ヘッダーのサイズは信用せず、実際に展開したサイズで上限を判定する
+		limit := int64(-1)
+		if maxSize > 0 {
+			limit = maxSize - total
+		}
+		written, err := extractZipFile(f, path, limit)
+		total += written
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// limitが負なら上限無し
+func extractZipFile(f *zip.File, path string, limit int64) (int64, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %s", f.Name, err.Error())
+	}
+	defer rc.Close()
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, fs.FileMode(0644))
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	var reader io.Reader = rc
+	if limit >= 0 {
+		reader = io.LimitReader(rc, limit+1)
+	}
+	written, err := io.Copy(file, reader)
+	if err != nil {
+		return written, fmt.Errorf("%s: %s", f.Name, err.Error())
+	}
+	if limit >= 0 && written > limit {
+		return written, ErrZipTooLarge
+	}
+	return written, nil
+}
@@ -0,0 +1,245 @@
+package checkbms
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/text/encoding/japanese"
+)
+
+type testZipEntry struct {
+	name    string
+	body    string
+	nonUTF8 bool
+}
+
+func newTestZip(t *testing.T, entries ...testZipEntry) *zip.Reader {
+	data := newTestZipBytes(t, entries...)
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return zr
+}
+
+func newTestZipBytes(t *testing.T, entries ...testZipEntry) []byte {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, entry := range entries {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: entry.name, NonUTF8: entry.nonUTF8, Method: zip.Deflate})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(entry.body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestExtractZip(t *testing.T) {
+	sjisName := string(encodeText(t, japanese.ShiftJIS, "曲/ソ.wav"))
+	zr := newTestZip(t,
+		testZipEntry{name: "pack/song/a.bms", body: "#TITLE a"},
+		testZipEntry{name: `pack\song\b.ogg`, body: "ogg"},
+		testZipEntry{name: "pack/" + sjisName, body: "wav", nonUTF8: true},
+		testZipEntry{name: "pack/empty/"},
+	)
+	dest := t.TempDir()
+	if err := ExtractZip(zr, dest, 0); err != nil {
+		t.Fatal(err)
+	}
+	for path, want := range map[string]string{
+		filepath.Join("pack", "song", "a.bms"): "#TITLE a",
+		filepath.Join("pack", "song", "b.ogg"): "ogg",
+		filepath.Join("pack", "曲", "ソ.wav"):    "wav",
+	} {
+		got, err := os.ReadFile(filepath.Join(dest, path))
+		if err != nil || string(got) != want {
+			t.Errorf("%s: got = %q, %v, want = %q", path, got, err, want)
+		}
+	}
+	if fInfo, err := os.Stat(filepath.Join(dest, "pack", "empty")); err != nil || !fInfo.IsDir() {
+		t.Errorf("empty directory is not extracted: %v", err)
+	}
+}
+
+func TestExtractZipRejectsUnsafeEntries(t *testing.T) {
+	for _, name := range []string{"../evil.bms", "song/../../evil.bms", "/abs/evil.bms", `..\evil.bms`} {
+		dest := filepath.Join(t.TempDir(), "dest")
+		if err := ExtractZip(newTestZip(t, testZipEntry{name: name, body: "x"}), dest, 0); err == nil {
+			t.Errorf("%s: error is not returned", name)
+		}
+		if _, err := os.Stat(filepath.Join(filepath.Dir(dest), "evil.bms")); err == nil {
+			t.Errorf("%s: extracted outside of dest", name)
+		}
+	}
+}
+
+func TestExtractZipSizeLimit(t *testing.T) {
+	zr := newTestZip(t,
+		testZipEntry{name: "a.wav", body: string(make([]byte, 60))},
+		testZipEntry{name: "b.wav", body: string(make([]byte, 60))},
+	)
+	if err := ExtractZip(zr, t.TempDir(), 100); !errors.Is(err, ErrZipTooLarge) {
+		t.Errorf("got = %v, want = %v", err, ErrZipTooLarge)
+	}
+	if err := ExtractZip(zr, t.TempDir(), 120); err != nil {
+		t.Errorf("got = %v, want = nil", err)
+	}
+}
+
+func TestScanDirectoryZip(t *testing.T) {
+	sjis := func(text string) string { return string(encodeText(t, japanese.ShiftJIS, text)) }
+	zipPath := filepath.Join(t.TempDir(), "pack.zip")
+	data := newTestZipBytes(t,
+		testZipEntry{name: "pack/readme.txt", body: "readme"},
+		testZipEntry{name: "pack/song/a.bms", body: sjis("#WAV01 曲.wav\r\n#WAV02 b.ogg\r\n#00111:0102")},
+		testZipEntry{name: "pack/song/" + sjis("曲.wav"), body: "wav", nonUTF8: true},
+		testZipEntry{name: "pack/song/b.ogg", body: "ogg"},
+		testZipEntry{name: "pack/song/画像.png", body: "png", nonUTF8: true}, // UTF-8でフラグが無い
+		testZipEntry{name: "pack/song/" + string([]byte{0xff, 0xfe}) + ".png", body: "png", nonUTF8: true},
+	)
+	if err := os.WriteFile(zipPath, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	songPath := filepath.Join(zipPath, "pack", "song")
+
+	bmsDirs, err := ScanDirectory(zipPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bmsDirs) != 1 || bmsDirs[0].Path != songPath {
+		t.Fatalf("ScanDirectory: got = %+v", bmsDirs)
+	}
+	bmsDirs[0].Close()
+	if dirPaths, err := FindBmsDirectories(zipPath); err != nil || len(dirPaths) != 1 || dirPaths[0] != songPath {
+		t.Errorf("FindBmsDirectories: got = %v, %v", dirPaths, err)
+	}
+	if !IsBmsDirectory(songPath) {
+		t.Errorf("IsBmsDirectory(%s) = false", songPath)
+	}
+	bmsDir, err := ScanBmsDirectory(zipPath, true, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bmsDir.Close()
+	if bmsDir.Path != songPath || len(bmsDir.BmsFiles) != 1 || bmsDir.BmsFiles[0].Path != filepath.Join(songPath, "a.bms") {
+		t.Fatalf("ScanBmsDirectory: got = %+v", bmsDir)
+	}
+	if bmsFileBase, err := ReadBmsFileBase(filepath.Join(songPath, "a.bms")); err != nil || bmsFileBase.Sha256 != bmsDir.BmsFiles[0].Sha256 {
+		t.Errorf("ReadBmsFileBase: got = %+v, %v", bmsFileBase, err)
+	}
+
+	CheckBmsDirectory(bmsDir, false)
+	garbled := []string{}
+	for _, log := range bmsDir.Logs {
+		switch log.Rule {
+		case "dir.file-not-found":
+			t.Errorf("defined file is not found: %s", log.Message)
+		case "dir.zip-filename-garbled":
+			garbled = append(garbled, log.Message)
+		}
+	}
+	if len(garbled) != 2 || !strings.Contains(garbled[0], "画像.png (UTF-8 without the UTF-8 flag)") || !strings.Contains(garbled[1], "(not Shift_JIS)") {
+		t.Errorf("garbled filename logs: got = %v", garbled)
+	}
+}
+
+func TestScanBmsDirectoryZipWithMultipleSongs(t *testing.T) {
+	zipPath := filepath.Join(t.TempDir(), "pack.zip")
+	data := newTestZipBytes(t,
+		testZipEntry{name: "song1/a.bms", body: "#TITLE a"},
+		testZipEntry{name: "song2/b.bms", body: "#TITLE b"},
+	)
+	if err := os.WriteFile(zipPath, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ScanBmsDirectory(zipPath, true, true); err == nil {
+		t.Errorf("error is not returned")
+	}
+	bmsDir, err := ScanBmsDirectory(filepath.Join(zipPath, "song2"), true, true)
+	if err != nil || len(bmsDir.BmsFiles) != 1 {
+		t.Fatalf("ScanBmsDirectory(song2): got = %+v, %v", bmsDir, err)
+	}
+	bmsDir.Close()
+}
+
+func TestZipEntryName(t *testing.T) {
+	sjisName := string(encodeText(t, japanese.ShiftJIS, "song/曲.wav"))
+	zr := newTestZip(t,
+		testZipEntry{name: "song/a~b.wav", nonUTF8: true},
+		testZipEntry{name: `song\c.wav`, nonUTF8: true},
+		testZipEntry{name: "song/曲.wav"},
+		testZipEntry{name: sjisName, nonUTF8: true},
+		testZipEntry{name: "song/画像.png", nonUTF8: true},
+	)
+	tests := []struct {
+		name            string
+		garbled, isUTF8 bool
+	}{
+		{"song/a~b.wav", false, false},
+		{"song/c.wav", false, false},
+		{"song/曲.wav", false, false},
+		{"song/曲.wav", false, false},
+		{"song/画像.png", true, true},
+	}
+	for i, tt := range tests {
+		name, garbled, isUTF8 := zipEntryName(zr.File[i])
+		if name != tt.name || garbled != tt.garbled || isUTF8 != tt.isUTF8 {
+			t.Errorf("%q: got = %q, %t, %t, want = %q, %t, %t", zr.File[i].Name, name, garbled, isUTF8, tt.name, tt.garbled, tt.isUTF8)
+		}
+	}
+}
+
+func TestDirectoryKeepsZipOpen(t *testing.T) {
+	zipPath := filepath.Join(t.TempDir(), "pack.zip")
+	data := newTestZipBytes(t,
+		testZipEntry{name: "song/a.bms", body: "#WAV01 a.wav\r\n#00111:01"},
+		testZipEntry{name: "song/a.wav", body: "wav"},
+	)
+	if err := os.WriteFile(zipPath, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	bmsDir, err := ScanBmsDirectory(zipPath, true, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	archive := bmsDir.zip
+	if archive == nil || archive.refs.Load() != 1 {
+		t.Fatalf("zip is not kept open: %+v", archive)
+	}
+	wavPath := filepath.Join(zipPath, "song", "a.wav")
+	loc, err := bmsDir.fileLocation(wavPath)
+	if err != nil || loc.fsys != fs.FS(archive) || loc.zip != nil {
+		t.Errorf("fileLocation does not use the open zip: %+v, %v", loc, err)
+	}
+	if f := zipFileOf(loc.fsys, loc.name); f == nil || f.Name != "song/a.wav" {
+		t.Errorf("zipFileOf: got = %+v", f)
+	}
+
+	if err := bmsDir.Close(); err != nil || archive.refs.Load() != 0 {
+		t.Errorf("Close: refs = %d, %v", archive.refs.Load(), err)
+	}
+	if err := bmsDir.Close(); err != nil || archive.refs.Load() != 0 {
+		t.Errorf("second Close: refs = %d, %v", archive.refs.Load(), err)
+	}
+	// 閉じた後はzipを開き直す
+	loc, err = bmsDir.fileLocation(wavPath)
+	if err != nil || loc.zip == nil {
+		t.Fatalf("fileLocation after Close: %+v, %v", loc, err)
+	}
+	if _, err := fs.ReadFile(loc.fsys, loc.name); err != nil {
+		t.Errorf("ReadFile after Close: %v", err)
+	}
+	loc.close()
+}